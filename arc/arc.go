@@ -0,0 +1,612 @@
+// Package arc provides a thread-safe Adaptive Replacement Cache (ARC) implementation.
+//
+// # When to Use ARC
+//
+// Use ARC when the balance between recency and frequency in your workload
+// changes over time and no fixed split fits all day. ARC tunes that split by
+// itself, which makes it a good fit for:
+//   - Caches whose traffic alternates between scans and hot-key reads
+//   - Services where slru.NewWithRatio needs a different ratio at different hours
+//   - Storage and database buffer caches
+//
+// # How ARC Works
+//
+// The cache keeps two lists of resident entries:
+//   - T1: entries seen once recently
+//   - T2: entries seen at least twice recently
+//
+// and two "ghost" lists that remember only the keys recently evicted from them:
+//   - B1: keys evicted from T1
+//   - B2: keys evicted from T2
+//
+// A target size p for T1 decides which list gives up an entry when the cache
+// is full: T1 if it holds more than p entries, T2 otherwise. Setting a key
+// found in B1 means T1 was too small, so p grows; setting a key found in B2
+// means T2 was too small, so p shrinks. Ghost keys take no room in the cache,
+// but the index remembers up to capacity of them.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1).
+//
+// # Weighted Capacity
+//
+// ARC does not support [cache.WithWeigher], and [New] panics if given one.
+// A ghost hit tells ARC that T1 or T2 would have needed one more key, and it
+// moves p by the ratio of the ghost lists' lengths; nothing in that signal
+// says whether one large entry is worth several small ones. When entries vary
+// widely in size, use a cache that supports weights, such as
+// [github.com/serroba/cache/slru].
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+// Expired and deleted entries do not leave a ghost behind.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// [Cache.Target] reports the current adaptation target.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := arc.New[string, int](1000)
+//	cache.Set("key", 42)  // Enters T1
+//	cache.Get("key")      // Moves to T2
+//	cache.Target()        // Current target size of T1
+package arc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+// location identifies which of the four ARC lists a node is on.
+type location uint8
+
+const (
+	t1 location = iota
+	t2
+	b1
+	b2
+)
+
+type node[K comparable, V any] struct {
+	key        K
+	value      V // zero while the node is a ghost
+	location   location
+	expiresAt  int64 // unix nanoseconds, 0 means no expiration
+	timer      wheel.Timer[*node[K, V]]
+	prev, next *node[K, V]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+func (n *node[K, V]) resident() bool {
+	return n.location == t1 || n.location == t2
+}
+
+// list is a doubly linked list of nodes between two sentinels, most recently
+// used first.
+type list[K comparable, V any] struct {
+	head, tail *node[K, V]
+	len        uint64
+}
+
+func newList[K comparable, V any]() list[K, V] {
+	head, tail := &node[K, V]{}, &node[K, V]{}
+	head.next = tail
+	tail.prev = head
+
+	return list[K, V]{head: head, tail: tail}
+}
+
+// Cache implements the Adaptive Replacement Cache algorithm.
+//
+// Entries seen once live in T1 and entries seen again move to T2. Keys recently
+// evicted from either list are remembered in a ghost list, and setting one of
+// them again shifts the target split between T1 and T2 towards the list it was
+// evicted from.
+//
+// The zero value is not usable; create instances with [New].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	items map[K]*node[K, V] // resident and ghost nodes
+	lists [4]list[K, V]     // indexed by location
+
+	capacity uint64
+	target   uint64 // p: the target size of T1
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new ARC cache that holds up to capacity items.
+//
+// The cache starts with a target of zero for T1, favoring entries that have
+// been seen more than once, and adapts from there. Options such as
+// [cache.WithDefaultTTL] are applied in order. New panics if the options
+// include [cache.WithWeigher].
+//
+// Example:
+//
+//	cache := arc.New[string, *Page](10000)
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+	if o.Weigher != nil {
+		panic("arc: cache.WithWeigher is not supported")
+	}
+
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		lists:      [4]list[K, V]{newList[K, V](), newList[K, V](), newList[K, V](), newList[K, V]()},
+		capacity:   capacity,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - New keys: added to T1
+//   - Keys remembered in a ghost list: the target adapts towards that list and
+//     the entry is added to T2
+//   - Existing keys: value updated in place and moved to the front of T2, like
+//     a [Cache.Get] hit
+//
+// When the cache is full, one entry is evicted from T1 or T2 according to the
+// current target. The overwritten value of an existing key is reported to the
+// [cache.OnEvict] listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set("page:1", pageData)   // Enters T1
+//	cache.Set("page:1", newData)    // Updates value, moves to T2
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("page:1", pageData, 5*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if c.capacity == 0 {
+		c.stats.RecordSet()
+		c.removals.Push(key, value, cache.ReasonEvicted)
+		c.stats.RecordRemoval(cache.ReasonEvicted)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		n.value = value
+		n.expiresAt = expiresAt
+		c.schedule(n)
+		c.move(n, t2)
+
+		return
+	}
+
+	c.stats.RecordSet()
+
+	if n, ok := c.items[key]; ok { // a ghost
+		c.adapt(n.location)
+		c.makeRoom(n.location == b2)
+
+		n.value = value
+		n.expiresAt = expiresAt
+		c.schedule(n)
+		c.move(n, t2)
+
+		return
+	}
+
+	c.makeRoomForNew()
+
+	n := &node[K, V]{key: key, value: value, expiresAt: expiresAt}
+	c.items[key] = n
+	c.schedule(n)
+	c.pushFront(n, t1)
+}
+
+// Get retrieves a value and marks it as frequently used.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// A hit moves the entry to the front of T2, whether it was in T1 or T2. A miss
+// on a key remembered in a ghost list does not adapt the target; that happens
+// when the key is set again. Use [Cache.Peek] to read without affecting eviction.
+//
+// Example:
+//
+//	if page, ok := cache.Get("page:1"); ok {
+//	    render(page)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	c.move(n, t2)
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// Peek retrieves a value without marking it as used.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Unlike [Cache.Get], this does not move the entry between T1 and T2.
+//
+// Example:
+//
+//	if data, ok := cache.Peek("page:1"); ok {
+//	    // Item found, eviction order unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		return n.value, true
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted] and is not remembered in a ghost list.
+//
+// Example:
+//
+//	cache.Delete("page:1")
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the number of entries in T1 and T2.
+//
+// Ghost keys are not counted. Expired entries that have not been removed yet are.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return int(c.lists[t1].len + c.lists[t2].len)
+}
+
+// Target returns the current target size of T1, between 0 and the capacity.
+//
+// The rest of the capacity is the target for T2. A target that keeps rising
+// means recently added keys are being evicted too early and asked for again;
+// one that keeps falling means the same of frequently used keys. Exporting it
+// as a gauge shows how the workload shifts.
+//
+// Example:
+//
+//	metrics.Gauge("cache.arc.target").Set(float64(cache.Target()))
+func (c *Cache[K, V]) Target() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.target
+}
+
+// Clear removes every entry, forgets all ghost keys and resets the target to zero.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], T2 entries first.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for _, loc := range []location{t2, t1} {
+		l := &c.lists[loc]
+		for n := l.head.next; n != l.tail; n = n.next {
+			c.removeEntry(n, cache.ReasonCleared)
+		}
+	}
+
+	for _, loc := range []location{b1, b2} {
+		l := &c.lists[loc]
+		for n := l.head.next; n != l.tail; n = n.next {
+			c.forget(n)
+		}
+	}
+
+	c.target = 0
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+//
+// The adaptation target is not affected.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the resident node for key, removing it first if it has
+// expired. Ghost nodes are not returned.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok || !n.resident() {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// adapt shifts the target after a ghost hit in ghost, by the ratio of the
+// other ghost list's size to this one's, but at least one.
+func (c *Cache[K, V]) adapt(ghost location) {
+	b1Len, b2Len := c.lists[b1].len, c.lists[b2].len
+
+	if ghost == b1 {
+		c.target = min(c.capacity, c.target+max(1, b2Len/b1Len))
+
+		return
+	}
+
+	c.target -= min(c.target, max(1, b1Len/b2Len))
+}
+
+// makeRoomForNew bounds the ghost lists and frees a slot before a key that is
+// in no list is added to T1.
+// Must be called with lock held.
+func (c *Cache[K, V]) makeRoomForNew() {
+	t1Len, b1Len := c.lists[t1].len, c.lists[b1].len
+	total := t1Len + b1Len + c.lists[t2].len + c.lists[b2].len
+
+	switch {
+	case t1Len+b1Len >= c.capacity && t1Len < c.capacity:
+		c.forget(c.lists[b1].tail.prev)
+		c.makeRoom(false)
+	case t1Len+b1Len >= c.capacity:
+		c.removeEntry(c.lists[t1].tail.prev, cache.ReasonEvicted)
+	case total >= c.capacity:
+		if total >= 2*c.capacity {
+			c.forget(c.lists[b2].tail.prev)
+		}
+
+		c.makeRoom(false)
+	}
+}
+
+// makeRoom evicts one resident entry to its ghost list if the cache is full:
+// from T1 if T1 is over target, or at target after a B2 hit, and from T2
+// otherwise. This is the REPLACE step of ARC.
+// Must be called with lock held.
+func (c *Cache[K, V]) makeRoom(afterB2Hit bool) {
+	t1Len, t2Len := c.lists[t1].len, c.lists[t2].len
+	if t1Len+t2Len < c.capacity {
+		return
+	}
+
+	from, to := t2, b2
+	if t1Len > 0 && (t1Len > c.target || (afterB2Hit && t1Len == c.target) || t2Len == 0) {
+		from, to = t1, b1
+	}
+
+	n := c.lists[from].tail.prev
+	c.removals.Push(n.key, n.value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	var zero V
+
+	n.value = zero
+	n.expiresAt = 0
+	c.move(n, to)
+}
+
+// removeEntry unlinks a resident node, drops it from the index, cancels its
+// expiration and queues a removal notification.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.forget(n)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// forget unlinks a node and drops it from the index without notifying anyone.
+func (c *Cache[K, V]) forget(n *node[K, V]) {
+	c.unlink(n)
+	delete(c.items, n.key)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
+
+// move relinks a node at the front of the given list.
+func (c *Cache[K, V]) move(n *node[K, V], to location) {
+	c.unlink(n)
+	c.pushFront(n, to)
+}
+
+// unlink removes a node from its list.
+func (c *Cache[K, V]) unlink(n *node[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	c.lists[n.location].len--
+}
+
+// pushFront adds a node to the front of the given list.
+func (c *Cache[K, V]) pushFront(n *node[K, V], loc location) {
+	l := &c.lists[loc]
+
+	n.location = loc
+	n.next = l.head.next
+	n.prev = l.head
+	l.head.next.prev = n
+	l.head.next = n
+	l.len++
+}
@@ -0,0 +1,493 @@
+package arc_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/arc"
+	"github.com/serroba/cache/lru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestARCCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Target())
+}
+
+func TestARCCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Get("a") // now in T2
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestARCCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestARCCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("b")
+
+	assert.True(t, c.Delete("a"))
+	assert.True(t, c.Delete("b"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestARCCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := arc.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestARCCache_EvictsOldestWhenOnlyT1(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := arc.New[string, int](3, record(&log))
+
+	for i, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, i)
+	}
+
+	assert.Equal(t, 3, c.Len())
+	assert.Equal(t, []removal{{"a", 0, cache.ReasonEvicted}}, log)
+}
+
+func TestARCCache_ScanDoesNotEvictFrequentItems(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[string, int](10)
+	plain := lru.New[string, int](10)
+
+	for _, c := range []cache.Cache[string, int]{c, plain} {
+		for i := range 5 {
+			key := fmt.Sprintf("hot%d", i)
+			c.Set(key, i)
+			c.Get(key)
+		}
+
+		for i := range 100 {
+			c.Set(fmt.Sprintf("scan%d", i), i)
+		}
+	}
+
+	for i := range 5 {
+		key := fmt.Sprintf("hot%d", i)
+
+		_, ok := c.Peek(key)
+		assert.True(t, ok, "expected %q to survive the scan", key)
+
+		_, ok = plain.Peek(key)
+		assert.False(t, ok, "a scan larger than the cache flushes LRU")
+	}
+}
+
+func TestARCCache_GhostHitsAdaptTarget(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := arc.New[string, int](4, record(&log))
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Get("b") // T2: b a
+	c.Set("c", 3)
+	c.Set("d", 4) // T1: d c
+	c.Set("e", 5) // full: T1 is over its target of 0, so "c" moves to B1
+
+	assert.Equal(t, []removal{{"c", 3, cache.ReasonEvicted}}, log)
+	assert.Equal(t, uint64(0), c.Target())
+
+	c.Set("c", 30) // B1 hit: T1 was too small
+	assert.Equal(t, uint64(1), c.Target())
+	assert.Equal(t, removal{"d", 4, cache.ReasonEvicted}, log[1], "T1 still over target")
+
+	c.Set("f", 6) // T1 at target, so T2's LRU "a" moves to B2
+	assert.Equal(t, removal{"a", 1, cache.ReasonEvicted}, log[2])
+
+	c.Set("a", 10) // B2 hit: T2 was too small
+	assert.Equal(t, uint64(0), c.Target())
+	assert.Equal(t, removal{"e", 5, cache.ReasonEvicted}, log[3])
+
+	assert.Equal(t, 4, c.Len())
+
+	for key, want := range map[string]int{"a": 10, "b": 2, "c": 30, "f": 6} {
+		v, ok := c.Peek(key)
+		require.True(t, ok, "expected %q to be cached", key)
+		assert.Equal(t, want, v)
+	}
+}
+
+func TestARCCache_TargetAdaptsToRecencyWorkload(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[int, int](100)
+
+	// A frequently used set fills T2 first.
+	for i := range 100 {
+		c.Set(i, i)
+		c.Get(i)
+	}
+
+	// Then the working set moves to a loop of new keys. Each key is evicted
+	// from T1 by the next one and comes back while B1 still remembers it.
+	for round := range 5 {
+		for i := range 90 {
+			c.Set(1000+i, round)
+		}
+	}
+
+	assert.Greater(t, c.Target(), uint64(50))
+	assert.LessOrEqual(t, c.Target(), uint64(100))
+	assert.Equal(t, 100, c.Len())
+}
+
+func TestARCCache_GhostsAreNotReturned(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[string, int](1)
+	c.Set("a", 1)
+	c.Get("a")    // T2
+	c.Set("b", 2) // "a" moves to B2
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("a")
+	assert.False(t, ok)
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestARCCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := arc.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestARCCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := arc.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestARCCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := arc.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestARCCache_JanitorIgnoresGhosts(t *testing.T) {
+	t.Parallel()
+
+	var (
+		now atomic.Int64
+		log []removal
+		mu  sync.Mutex
+	)
+
+	c := arc.New[string, int](2,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+		cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			log = append(log, removal{key, value, reason})
+		}),
+	)
+	defer c.Close()
+
+	c.Set("x", 0)
+	c.Get("x") // T2
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour) // "a" moves to B1
+
+	now.Store(int64(2 * time.Second))
+
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestARCCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	arc.New[string, int](10).Close()
+}
+
+func TestARCCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := arc.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestARCCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := arc.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Get("a")
+	c.Set("b", 2)
+	c.Set("c", 3) // "b" moves to B1
+	c.Set("b", 2) // B1 hit raises the target
+	require.Equal(t, uint64(1), c.Target())
+
+	log = nil
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Target())
+	assert.Len(t, log, 2)
+
+	for _, r := range log {
+		assert.Equal(t, cache.ReasonCleared, r.reason)
+	}
+
+	c.Set("c", 3) // a fresh key again, not a ghost hit
+	assert.Equal(t, uint64(0), c.Target())
+}
+
+func TestARCCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *arc.Cache[string, int]
+
+	c = arc.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestARCCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := arc.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestARCCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := arc.New[string, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Target()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+	assert.LessOrEqual(t, c.Target(), uint64(100))
+}
+
+func TestARCCache_WeigherPanics(t *testing.T) {
+	t.Parallel()
+
+	weigher := cache.WithWeigher(func(string, int) uint64 { return 1 })
+
+	assert.PanicsWithValue(t, "arc: cache.WithWeigher is not supported", func() {
+		arc.New[string, int](10, weigher)
+	})
+}
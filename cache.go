@@ -0,0 +1,36 @@
+// Package cache defines the API shared by every cache implementation in this module.
+//
+// The eviction policies live in their own packages (lru, slru, fifo, clock) and
+// all satisfy [Cache], so code can depend on the interface and choose a policy
+// at construction time:
+//
+//	var c cache.Cache[string, *User]
+//
+//	switch cfg.Policy {
+//	case "lru":
+//	    c = lru.New[string, *User](cfg.Size)
+//	case "fifo":
+//	    c = fifo.New[string, *User](cfg.Size)
+//	}
+package cache
+
+// Cache is the common interface implemented by every eviction policy.
+//
+// Implementations are safe for concurrent use. How Get and Set affect eviction
+// order depends on the policy; Peek never does.
+type Cache[K comparable, V any] interface {
+	// Set adds or updates a key-value pair.
+	Set(key K, value V)
+
+	// Get retrieves a value, possibly affecting eviction order.
+	Get(key K) (V, bool)
+
+	// Peek retrieves a value without affecting eviction order.
+	Peek(key K) (V, bool)
+
+	// Delete removes a key, reporting whether it was present.
+	Delete(key K) bool
+
+	// Len returns the current number of items.
+	Len() int
+}
@@ -0,0 +1,96 @@
+package cache_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/clock"
+	"github.com/serroba/cache/fifo"
+	"github.com/serroba/cache/loading"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/slru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func implementations() map[string]func(capacity uint64) cache.Cache[string, int] {
+	return map[string]func(capacity uint64) cache.Cache[string, int]{
+		"lru":   func(capacity uint64) cache.Cache[string, int] { return lru.New[string, int](capacity) },
+		"slru":  func(capacity uint64) cache.Cache[string, int] { return slru.New[string, int](capacity) },
+		"fifo":  func(capacity uint64) cache.Cache[string, int] { return fifo.New[string, int](capacity) },
+		"clock": func(capacity uint64) cache.Cache[string, int] { return clock.New[string, int](capacity) },
+		"loading": func(capacity uint64) cache.Cache[string, int] {
+			return loading.New[string, int](lru.New[string, int](capacity))
+		},
+	}
+}
+
+func TestCache_CommonBehavior(t *testing.T) {
+	t.Parallel()
+
+	for name, newCache := range implementations() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newCache(10)
+
+			_, ok := c.Get("missing")
+			assert.False(t, ok)
+
+			c.Set("a", 1)
+			c.Set("b", 2)
+			c.Set("a", 3)
+
+			v, ok := c.Get("a")
+			require.True(t, ok)
+			assert.Equal(t, 3, v)
+
+			v, ok = c.Peek("b")
+			require.True(t, ok)
+			assert.Equal(t, 2, v)
+
+			assert.Equal(t, 2, c.Len())
+
+			assert.True(t, c.Delete("a"))
+			assert.False(t, c.Delete("a"))
+			assert.Equal(t, 1, c.Len())
+		})
+	}
+}
+
+func TestCache_LenNeverExceedsCapacity(t *testing.T) {
+	t.Parallel()
+
+	for name, newCache := range implementations() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newCache(5)
+
+			for i := range 100 {
+				c.Set(fmt.Sprintf("key%d", i), i)
+				assert.LessOrEqual(t, c.Len(), 5)
+			}
+		})
+	}
+}
+
+func TestRemovalReason_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "evicted", cache.ReasonEvicted.String())
+	assert.Equal(t, "deleted", cache.ReasonDeleted.String())
+	assert.Equal(t, "replaced", cache.ReasonReplaced.String())
+	assert.Equal(t, "expired", cache.ReasonExpired.String())
+	assert.Equal(t, "cleared", cache.ReasonCleared.String())
+	assert.Equal(t, "unknown", cache.RemovalReason(0).String())
+}
+
+func TestStats_HitRatio(t *testing.T) {
+	t.Parallel()
+
+	assert.InDelta(t, 0.0, cache.Stats{}.HitRatio(), 0)
+	assert.InDelta(t, 0.75, cache.Stats{Hits: 3, Misses: 1}.HitRatio(), 1e-9)
+	assert.Equal(t, uint64(4), cache.Stats{Hits: 3, Misses: 1}.Requests())
+}
@@ -19,6 +19,15 @@
 // This approximates LRU: frequently accessed items keep getting their bit set,
 // surviving eviction sweeps.
 //
+// # Generalized Clock
+//
+// A reference bit cannot tell an item read once from one read a thousand times.
+// [NewGeneralized] creates a GCLOCK cache, where the bit becomes a saturating
+// counter: each access increments it up to a configurable maximum, and each
+// pass of the hand decrements it, evicting the item once it reaches zero. An
+// item accessed n times since the hand last saw it survives n sweeps, so the
+// cache keeps frequently used items through bursts of one-off accesses.
+//
 // # Thread Safety
 //
 // All methods are safe for concurrent use. The cache uses a mutex internally.
@@ -27,6 +36,50 @@
 //
 // All operations (Get, Set, Delete, Peek, Len) are O(1) amortized.
 //
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and a single Set may evict several entries to make room.
+// The ring then grows to fit however many entries the weight limit allows.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// Counters are updated atomically, so reading them never contends with cache
+// operations.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Persistence
+//
+// [Cache.Snapshot] writes the entries together with the ring order, hand
+// position and reference bits to an [io.Writer], and [Cache.Restore] loads them
+// back, so a restarted process can start warm. Keys and values are encoded with
+// a [codec.Codec].
+//
+// # CLOCK-Pro
+//
+// [ProCache], created with [NewPro], runs the CLOCK-Pro algorithm on the same
+// ring layout. It tells hot pages from cold ones and keeps recently evicted
+// keys on the clock as non-resident test pages: a key set again during its
+// test period comes back hot. Three hands sweep the clock, one each for cold,
+// hot and test pages, and the number of resident pages allotted to cold pages
+// adapts to how often test pages are hit. This makes it resistant to scans
+// and to loops slightly larger than the cache, where plain second chance
+// evicts the working set. Operations stay O(1) amortized; [ProCache] counts
+// entries only and does not support weights, resizing or snapshots.
+//
 // # Example Usage
 //
 //	cache := clock.New[string, int](100)
@@ -35,12 +88,33 @@
 //	// On eviction, "key" gets a second chance
 package clock
 
-import "sync"
+import (
+	"io"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
+	"github.com/serroba/cache/internal/iterate"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/snapshot"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
 
 type entry[K comparable, V any] struct {
-	key        K
-	value      V
-	referenced bool
+	key       K
+	value     V
+	weight    uint64
+	count     uint8 // reference counter, saturating at the cache's maxCount
+	expiresAt int64 // unix nanoseconds, 0 means no expiration
+	timer     wheel.Timer[*entry[K, V]]
+}
+
+func (e *entry[K, V]) expired(now int64) bool {
+	return e.expiresAt != 0 && now >= e.expiresAt
 }
 
 // Cache implements a Clock cache (also known as Second Chance).
@@ -51,7 +125,10 @@ type entry[K comparable, V any] struct {
 // bits get a "second chance" (bit cleared), while items with cleared bits
 // are evicted.
 //
-// The zero value is not usable; create instances with [New].
+// With [NewGeneralized] the reference bit is a saturating counter instead,
+// incremented on access and decremented by the hand (GCLOCK).
+//
+// The zero value is not usable; create instances with [New] or [NewGeneralized].
 type Cache[K comparable, V any] struct {
 	mu       sync.Mutex
 	items    map[K]uint64
@@ -59,22 +136,77 @@ type Cache[K comparable, V any] struct {
 	hand     uint64
 	capacity uint64
 	size     uint64
+	weight   uint64
+	weigher  func(K, V) uint64
+	maxCount uint8 // 1 for second chance, higher for GCLOCK
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*entry[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
 }
 
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
 // New creates a new Clock cache with the specified maximum capacity.
 //
-// The capacity determines how many key-value pairs the cache can hold.
-// When this limit is exceeded, items are evicted using the clock algorithm.
+// The capacity determines how many key-value pairs the cache can hold, or their
+// total weight when [cache.WithWeigher] is used. When this limit is exceeded,
+// items are evicted using the clock algorithm. With a weigher the ring starts
+// empty and grows to fit the number of entries.
+// Options such as [cache.WithDefaultTTL] are applied in order.
 //
 // Example:
 //
 //	cache := clock.New[string, *Session](1000)
-func New[K comparable, V any](capacity uint64) *Cache[K, V] {
-	return &Cache[K, V]{
-		items:    make(map[K]uint64),
-		ring:     make([]*entry[K, V], capacity),
-		capacity: capacity,
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	return NewGeneralized(capacity, 1, opts...)
+}
+
+// NewGeneralized creates a new GCLOCK cache with the specified maximum capacity
+// whose reference counters saturate at maxCount.
+//
+// Each [Cache.Get], and each [Cache.Set] of an existing key, increments the
+// entry's counter up to maxCount; each time the clock hand passes the entry
+// during eviction it decrements the counter, and the entry is evicted when the
+// hand finds it at zero. New entries start at zero. A maxCount of 1 is the
+// plain second chance algorithm of [New], and 0 is treated as 1. Capacity and
+// options behave as for [New].
+//
+// Example:
+//
+//	// Entries read often survive up to four sweeps of the hand
+//	cache := clock.NewGeneralized[string, *Session](1000, 4)
+func NewGeneralized[K comparable, V any](capacity uint64, maxCount uint8, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	c := &Cache[K, V]{
+		items:      make(map[K]uint64),
+		capacity:   capacity,
+		weigher:    o.Weigher,
+		maxCount:   max(1, maxCount),
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if c.weigher == nil {
+		c.ring = make([]*entry[K, V], capacity)
 	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*entry[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
 }
 
 // Set adds or updates a key-value pair in the cache.
@@ -83,47 +215,119 @@ func New[K comparable, V any](capacity uint64) *Cache[K, V] {
 //   - If the key exists: updates the value and sets the reference bit (second chance)
 //   - If the key is new and cache is full: evicts an item using clock algorithm first
 //   - If the key is new and cache has space: simply adds the item
+//   - If the entry outweighs the whole cache: it is not stored (see [cache.WithWeigher])
 //
 // New items start with their reference bit cleared, making them eligible for
-// eviction until they are accessed via [Cache.Get].
+// eviction until they are accessed via [Cache.Get]. The overwritten value of an
+// existing key is reported to the [cache.OnEvict] listener with [cache.ReasonReplaced].
 //
 // Example:
 //
 //	cache.Set("config", configData)
 //	cache.Set("config", newConfig)  // Updates and sets reference bit
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
 func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("config", configData, time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+
+	weight := c.weigh(key, value)
+	if c.weigher != nil && weight > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
 
 	// Update existing
-	if idx, ok := c.items[key]; ok {
-		c.ring[idx].value = value
-		c.ring[idx].referenced = true
+	if idx, ok := c.lookup(key); ok {
+		e := c.ring[idx]
+		c.removals.Push(key, e.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+		c.weight = c.weight - e.weight + weight
+		e.value = value
+		e.weight = weight
+		c.touch(e)
+		e.expiresAt = expiresAt
+		c.schedule(e)
+
+		for c.weight > c.capacity && c.size > 1 {
+			c.evict(e)
+		}
 
 		return
 	}
 
 	// Need to evict if at capacity
-	if c.size >= c.capacity {
-		c.evict()
+	for c.size > 0 && c.weight+weight > c.capacity {
+		c.evict(nil)
 	}
 
 	// Find empty slot (after eviction or if not full)
 	idx := c.findEmptySlot()
 	c.ring[idx] = &entry[K, V]{
-		key:        key,
-		value:      value,
-		referenced: false,
+		key:       key,
+		value:     value,
+		weight:    weight,
+		expiresAt: expiresAt,
 	}
 	c.items[key] = idx
 	c.size++
+	c.weight += weight
+	c.schedule(c.ring[idx])
+	c.stats.RecordSet()
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// touch records an access by incrementing the entry's reference counter, up to
+// the cache's maxCount. Must be called with lock held.
+func (c *Cache[K, V]) touch(e *entry[K, V]) {
+	if e.count < c.maxCount {
+		e.count++
+	}
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if idx, ok := c.lookup(key); ok {
+		c.removeAt(idx, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
 }
 
 // Get retrieves a value from the cache and sets its reference bit.
 //
 // Returns:
 //   - (value, true) if the key exists
-//   - (zero value, false) if the key does not exist
+//   - (zero value, false) if the key does not exist or has expired
 //
 // Setting the reference bit gives the item a "second chance" during eviction.
 // Use [Cache.Peek] if you need to check a value without affecting eviction.
@@ -135,16 +339,19 @@ func (c *Cache[K, V]) Set(key K, value V) {
 //	}
 func (c *Cache[K, V]) Get(key K) (V, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	idx, ok := c.items[key]
+	idx, ok := c.lookup(key)
 	if !ok {
+		c.stats.RecordMiss()
+
 		var zero V
 
 		return zero, false
 	}
 
-	c.ring[idx].referenced = true
+	c.touch(c.ring[idx])
+	c.stats.RecordHit()
 
 	return c.ring[idx].value, true
 }
@@ -153,7 +360,7 @@ func (c *Cache[K, V]) Get(key K) (V, bool) {
 //
 // Returns:
 //   - (value, true) if the key exists
-//   - (zero value, false) if the key does not exist
+//   - (zero value, false) if the key does not exist or has expired
 //
 // Unlike [Cache.Get], this does not give the item a "second chance" during
 // eviction. Use Peek when you need to check a value without affecting the
@@ -167,9 +374,9 @@ func (c *Cache[K, V]) Get(key K) (V, bool) {
 //	}
 func (c *Cache[K, V]) Peek(key K) (V, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	idx, ok := c.items[key]
+	idx, ok := c.lookup(key)
 	if !ok {
 		var zero V
 
@@ -181,52 +388,338 @@ func (c *Cache[K, V]) Peek(key K) (V, bool) {
 
 // Delete removes a key from the cache.
 //
-// Returns true if the key existed and was removed, false if the key was not found.
-// The slot in the ring buffer is marked as empty and can be reused.
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted]. The slot in the ring buffer is marked as empty and can be reused.
 //
 // Example:
 //
 //	cache.Delete("invalidated-token")
 func (c *Cache[K, V]) Delete(key K) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	idx, ok := c.items[key]
+	idx, ok := c.lookup(key)
 	if !ok {
 		return false
 	}
 
-	c.ring[idx] = nil
-	delete(c.items, key)
-	c.size--
+	c.removeAt(idx, cache.ReasonDeleted)
 
 	return true
 }
 
 // Len returns the current number of items in the cache.
 //
-// This value is always <= the capacity specified in [New].
+// Without a weigher, this value is always <= the capacity specified in [New].
+// Expired entries that have not been removed yet are still counted.
 //
 // Example:
 //
 //	fmt.Printf("Cache contains %d items\n", cache.Len())
-func (c *Cache[K, V]) Len() uint64 {
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// Weight returns the total weight of the items in the cache.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weight
+}
+
+// Resize changes the capacity of the cache.
+//
+// Shrinking sweeps the clock hand as usual, clearing reference bits (or
+// decrementing counters) and evicting unreferenced items until the cache fits; each is reported to the
+// [cache.OnEvict] listener with [cache.ReasonEvicted]. The ring is then
+// reallocated to the new size. Growing keeps every item in place and extends
+// the ring. With [cache.WithWeigher], capacity is a weight and the ring is
+// compacted to the number of entries instead.
+//
+// Example:
+//
+//	cache.Resize(cfg.CacheSize) // apply a config reload without a cold start
+func (c *Cache[K, V]) Resize(capacity uint64) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.capacity = capacity
+	c.fit()
+}
+
+// Clear removes every entry from the cache.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], in ring order starting at the clock hand.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.removeAll(cache.ReasonCleared)
+}
+
+// Snapshot writes the cache's entries to w, preserving their ring order, the
+// hand position and every reference bit or counter.
+//
+// Keys and values are encoded with the given codecs into a versioned binary
+// format with a checksum, which [Cache.Restore] reads back. Expired entries are
+// skipped and TTLs are kept as absolute deadlines. Entries are copied under the
+// lock and encoded after it is released, so a slow writer does not block the cache.
+//
+// Example:
+//
+//	f, err := os.Create("sessions.snap")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//
+//	return cache.Snapshot(f, keyCodec, sessionCodec)
+func (c *Cache[K, V]) Snapshot(w io.Writer, keys codec.Codec[K], values codec.Codec[V]) error {
+	return snapshot.Write(w, snapshot.PolicyClock, c.export(), keys, values)
+}
+
+// Restore replaces the cache's contents with a snapshot written by [Cache.Snapshot].
+//
+// The whole snapshot is read and verified before the cache is touched. A
+// corrupt, truncated or mismatched snapshot is rejected with a
+// [*cache.SnapshotError] and leaves the cache as it was.
+//
+// On success, existing entries are removed with [cache.ReasonCleared], entries
+// that expired since the snapshot was taken are dropped, and the rest are laid
+// out in their saved ring order with the hand on the first of them and their
+// reference bits or counters intact, capped at this cache's maximum count. If
+// they exceed the current capacity, the clock hand sweeps and evicts as by
+// [Cache.Resize].
+//
+// Example:
+//
+//	f, err := os.Open("sessions.snap")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//
+//	return cache.Restore(f, keyCodec, sessionCodec)
+func (c *Cache[K, V]) Restore(r io.Reader, keys codec.Codec[K], values codec.Codec[V]) error {
+	entries, err := snapshot.Read(r, snapshot.PolicyClock, keys, values)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.removeAll(cache.ReasonCleared)
+
+	now := c.now().UnixNano()
+	c.ring = make([]*entry[K, V], 0, len(entries))
+	c.hand = 0
+
+	for _, s := range entries {
+		e := &entry[K, V]{key: s.Key, value: s.Value, count: min(s.Flags, c.maxCount), expiresAt: s.ExpiresAt}
+		if e.expired(now) {
+			continue
+		}
+
+		e.weight = c.weigh(e.key, e.value)
+		c.items[e.key] = uint64(len(c.ring))
+		c.ring = append(c.ring, e)
+		c.size++
+		c.weight += e.weight
+		c.schedule(e)
+	}
+
+	c.fit()
+
+	return nil
+}
+
+// All returns an iterator over the cache's entries in ring order, starting at
+// the clock hand. Unreferenced entries early in this order are the next
+// eviction candidates.
+//
+// The entries are copied under the lock when iteration starts and yielded after
+// it is released, so the loop body may call back into the cache; changes made
+// during iteration are not reflected. Expired entries are skipped. Iterating
+// does not set reference bits.
+//
+// Example:
+//
+//	for key, session := range cache.All() {
+//	    fmt.Println(key, session.User)
+//	}
+func (c *Cache[K, V]) All() iter.Seq2[K, V] {
+	return iterate.Seq(c.collect)
+}
+
+// Keys returns an iterator over the cache's keys, in the order of [Cache.All].
+func (c *Cache[K, V]) Keys() iter.Seq[K] {
+	return iterate.Keys(c.All())
+}
+
+// Values returns an iterator over the cache's values, in the order of [Cache.All].
+func (c *Cache[K, V]) Values() iter.Seq[V] {
+	return iterate.Values(c.All())
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the ring index for key, removing the entry first if it has expired.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (uint64, bool) {
+	idx, ok := c.items[key]
+	if !ok {
+		return 0, false
+	}
+
+	if e := c.ring[idx]; e.expiresAt != 0 && e.expired(c.now().UnixNano()) {
+		c.removeAt(idx, cache.ReasonExpired)
+
+		return 0, false
+	}
+
+	return idx, true
+}
+
+// schedule registers the entry's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(e *entry[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if e.expiresAt == 0 {
+		c.wheel.Cancel(&e.timer)
+
+		return
+	}
+
+	e.timer.Value = e
+	c.wheel.Schedule(&e.timer, e.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(e *entry[K, V]) {
+		c.removeAt(c.items[e.key], cache.ReasonExpired)
+	})
+}
+
+// removeAt empties the slot at idx, drops its entry from the index, cancels its
+// expiration and queues a removal notification. Must be called with lock held
+// and when the slot is occupied.
+func (c *Cache[K, V]) removeAt(idx uint64, reason cache.RemovalReason) {
+	e := c.ring[idx]
+
+	delete(c.items, e.key)
+	c.ring[idx] = nil
+	c.size--
+	c.weight -= e.weight
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&e.timer)
+	}
+
+	c.removals.Push(e.key, e.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// collect copies the live entries in ring order, starting at the hand.
+func (c *Cache[K, V]) collect() []iterate.Entry[K, V] {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return c.size
+	now := c.now().UnixNano()
+	entries := make([]iterate.Entry[K, V], 0, len(c.items))
+
+	for i := range uint64(len(c.ring)) {
+		e := c.ring[(c.hand+i)%uint64(len(c.ring))]
+		if e != nil && !e.expired(now) {
+			entries = append(entries, iterate.Entry[K, V]{Key: e.key, Value: e.value})
+		}
+	}
+
+	return entries
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
 }
 
-// evict removes an item using the clock algorithm.
-// Must be called with lock held and when size >= capacity (cache is full).
-// Since the cache is full, all slots are occupied; no nil checks needed.
-func (c *Cache[K, V]) evict() {
+// evict removes an item using the clock algorithm, skipping empty slots.
+// The entry keep is never chosen, so that an update cannot evict itself.
+// Must be called with lock held and when the cache holds an entry other than keep.
+func (c *Cache[K, V]) evict(keep *entry[K, V]) {
 	for {
 		e := c.ring[c.hand]
 
-		if e.referenced {
+		if e == nil || e == keep {
+			c.advanceHand()
+
+			continue
+		}
+
+		if e.count > 0 {
 			// Give second chance
-			e.referenced = false
+			e.count--
 
 			c.advanceHand()
 
@@ -234,18 +727,23 @@ func (c *Cache[K, V]) evict() {
 		}
 
 		// Evict this entry
-		delete(c.items, e.key)
-		c.ring[c.hand] = nil
-		c.size--
+		c.removeAt(c.hand, cache.ReasonEvicted)
 
 		return
 	}
 }
 
-// findEmptySlot finds an empty slot in the ring.
-// Must be called with lock held and when there's guaranteed to be an empty slot.
-// This is always called after evict() has freed a slot, so an empty slot exists.
+// findEmptySlot finds an empty slot in the ring, growing the ring when every
+// slot is occupied. Without a weigher the ring is sized to capacity and evict()
+// has always freed a slot by now, so it only grows for weighted caches or a
+// zero capacity. Must be called with lock held.
 func (c *Cache[K, V]) findEmptySlot() uint64 {
+	if c.size == uint64(len(c.ring)) {
+		c.ring = append(c.ring, nil)
+
+		return uint64(len(c.ring) - 1)
+	}
+
 	for {
 		if c.ring[c.hand] == nil {
 			idx := c.hand
@@ -258,7 +756,82 @@ func (c *Cache[K, V]) findEmptySlot() uint64 {
 	}
 }
 
+// fit evicts with the clock hand until the cache fits its capacity, then sizes
+// the ring: to capacity without a weigher, or to the number of entries with one.
+// Must be called with lock held.
+func (c *Cache[K, V]) fit() {
+	for c.size > 0 && c.weight > c.capacity {
+		c.evict(nil)
+	}
+
+	size := c.size
+	if c.weigher == nil {
+		size = c.capacity
+	}
+
+	switch n := uint64(len(c.ring)); {
+	case size < n:
+		c.compact(size)
+	case size > n:
+		c.ring = append(c.ring, make([]*entry[K, V], size-n)...)
+	}
+}
+
+// removeAll removes every entry for reason, in ring order starting at the hand.
+// Must be called with lock held.
+func (c *Cache[K, V]) removeAll(reason cache.RemovalReason) {
+	for range c.ring {
+		if c.ring[c.hand] != nil {
+			c.removeAt(c.hand, reason)
+		}
+
+		c.advanceHand()
+	}
+}
+
+// export copies the live entries for a snapshot in ring order starting at the
+// hand, recording each reference counter in the entry's flags.
+func (c *Cache[K, V]) export() []snapshot.Entry[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixNano()
+	entries := make([]snapshot.Entry[K, V], 0, len(c.items))
+
+	for i := range uint64(len(c.ring)) {
+		e := c.ring[(c.hand+i)%uint64(len(c.ring))]
+		if e == nil || e.expired(now) {
+			continue
+		}
+
+		entries = append(entries, snapshot.Entry[K, V]{Key: e.key, Value: e.value, ExpiresAt: e.expiresAt, Flags: e.count})
+	}
+
+	return entries
+}
+
+// compact moves every entry into a new ring of length n, keeping their order
+// starting from the hand, which is reset to the first slot. Must be called with
+// lock held and n >= size.
+func (c *Cache[K, V]) compact(n uint64) {
+	ring := make([]*entry[K, V], n)
+	idx := uint64(0)
+
+	for range c.ring {
+		if e := c.ring[c.hand]; e != nil {
+			ring[idx] = e
+			c.items[e.key] = idx
+			idx++
+		}
+
+		c.advanceHand()
+	}
+
+	c.ring = ring
+	c.hand = 0
+}
+
 // advanceHand moves the clock hand forward.
 func (c *Cache[K, V]) advanceHand() {
-	c.hand = (c.hand + 1) % c.capacity
+	c.hand = (c.hand + 1) % uint64(len(c.ring))
 }
@@ -1,11 +1,19 @@
 package clock_test
 
 import (
+	"bytes"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/serroba/cache"
 	"github.com/serroba/cache/clock"
+	"github.com/serroba/cache/codec"
+	"github.com/serroba/cache/fifo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -52,7 +60,7 @@ func TestClockCache_Eviction(t *testing.T) {
 	c.Set("c", 3)
 	c.Set("d", 4) // should evict one item
 
-	assert.Equal(t, uint64(3), c.Len())
+	assert.Equal(t, 3, c.Len())
 
 	// At least d should exist
 	v, ok := c.Get("d")
@@ -142,17 +150,17 @@ func TestClockCache_Len(t *testing.T) {
 
 	c := clock.New[string, int](10)
 
-	assert.Equal(t, uint64(0), c.Len())
+	assert.Equal(t, 0, c.Len())
 
 	c.Set("a", 1)
-	assert.Equal(t, uint64(1), c.Len())
+	assert.Equal(t, 1, c.Len())
 
 	c.Set("b", 2)
 	c.Set("c", 3)
-	assert.Equal(t, uint64(3), c.Len())
+	assert.Equal(t, 3, c.Len())
 
 	c.Delete("b")
-	assert.Equal(t, uint64(2), c.Len())
+	assert.Equal(t, 2, c.Len())
 }
 
 func TestClockCache_LenAtCapacity(t *testing.T) {
@@ -163,10 +171,10 @@ func TestClockCache_LenAtCapacity(t *testing.T) {
 	c.Set("b", 2)
 	c.Set("c", 3)
 
-	assert.Equal(t, uint64(3), c.Len())
+	assert.Equal(t, 3, c.Len())
 
 	c.Set("d", 4)
-	assert.Equal(t, uint64(3), c.Len())
+	assert.Equal(t, 3, c.Len())
 }
 
 func TestClockCache_CapacityOne(t *testing.T) {
@@ -180,7 +188,7 @@ func TestClockCache_CapacityOne(t *testing.T) {
 	assert.Equal(t, 1, v)
 
 	c.Set("b", 2)
-	assert.Equal(t, uint64(1), c.Len())
+	assert.Equal(t, 1, c.Len())
 
 	_, ok = c.Get("a")
 	assert.False(t, ok)
@@ -372,7 +380,7 @@ func TestClockCache_DeleteAndReuseSlot(t *testing.T) {
 	// Add a new item - should use the empty slot
 	c.Set("d", 4)
 
-	assert.Equal(t, uint64(3), c.Len())
+	assert.Equal(t, 3, c.Len())
 
 	v, ok := c.Get("d")
 	require.True(t, ok)
@@ -389,12 +397,691 @@ func TestClockCache_EvictAfterDelete(t *testing.T) {
 
 	// Delete one item
 	c.Delete("a")
-	assert.Equal(t, uint64(2), c.Len())
+	assert.Equal(t, 2, c.Len())
 
 	// Add two more items - second one should trigger eviction
 	c.Set("d", 4)
-	assert.Equal(t, uint64(3), c.Len())
+	assert.Equal(t, 3, c.Len())
 
 	c.Set("e", 5)
-	assert.Equal(t, uint64(3), c.Len())
+	assert.Equal(t, 3, c.Len())
+}
+
+func TestClockCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	now = now.Add(time.Second)
+
+	_, ok = c.Get("a")
+	assert.False(t, ok, "expected 'a' to be expired")
+	assert.Equal(t, 1, c.Len(), "expired entry should be removed on access")
+
+	v, ok = c.Get("b")
+	require.True(t, ok, "entries without TTL never expire")
+	assert.Equal(t, 2, v)
+}
+
+func TestClockCache_PeekExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(time.Minute + 1)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestClockCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.New[string, int](10,
+		cache.WithDefaultTTL[string, int](time.Minute),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, 0) // overrides the default: never expires
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok, "expected 'a' to expire after the default TTL")
+
+	_, ok = c.Get("b")
+	assert.True(t, ok, "expected 'b' to ignore the default TTL")
+}
+
+func TestClockCache_UpdateRefreshesTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(30 * time.Second)
+	c.SetWithTTL("a", 2, time.Minute)
+
+	now = now.Add(45 * time.Second)
+
+	v, ok := c.Get("a")
+	require.True(t, ok, "expected update to reset the expiration")
+	assert.Equal(t, 2, v)
+
+	c.Set("a", 3) // no default TTL, so expiration is cleared
+
+	now = now.Add(time.Hour)
+
+	v, ok = c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestClockCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := clock.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	for _, key := range []string{"b", "c", "d"} {
+		_, ok = c.Peek(key)
+		assert.True(t, ok, "expected %q to survive the janitor", key)
+	}
+}
+
+func TestClockCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close() // safe to call twice
+
+	// The cache stays usable after Close.
+	c.SetWithTTL("a", 1, time.Hour)
+	c.Delete("a")
+	c.Set("b", 2)
+
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+
+	// Close is a no-op without a janitor.
+	clock.New[string, int](10).Close()
+}
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestClockCache_OnEvictCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	require.NotEmpty(t, log)
+	assert.Equal(t, removal{"a", 1, cache.ReasonEvicted}, log[0])
+}
+
+func TestClockCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := clock.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestClockCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.ElementsMatch(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"b", 2, cache.ReasonCleared},
+	}, log)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("c", 3)
+
+	v, ok := c.Get("c")
+	require.True(t, ok, "cache should be usable after Clear")
+	assert.Equal(t, 3, v)
+}
+
+func TestClockCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *clock.Cache[string, int]
+
+	c = clock.New[string, int](2, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestClockCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	s := c.Stats()
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, s)
+	assert.InDelta(t, 1.0/3, s.HitRatio(), 1e-9)
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestClockCache_StatsEvictions(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[int, int](4)
+
+	for i := range 20 {
+		c.Set(i, i)
+	}
+
+	s := c.Stats()
+	assert.Equal(t, uint64(20), s.Sets)
+	assert.Equal(t, s.Sets-uint64(c.Len()), s.Evictions)
+}
+
+func TestClockCache_ConcurrentStats(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[int, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 10 {
+		wg.Add(2)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 100 {
+				c.Set(id*100+j, j)
+				c.Get(j)
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				c.Stats()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, uint64(1000), c.Stats().Requests())
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+func TestClockCache_WeightedEvictsUntilFits(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[string, int](10, weighByValue())
+	c.Set("a", 3)
+	c.Set("b", 3)
+	c.Set("c", 3)
+	c.Get("c") // second chance
+
+	c.Set("d", 7)
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(10), c.Weight())
+
+	_, ok := c.Peek("c")
+	assert.True(t, ok, "referenced entry should survive")
+	_, ok = c.Peek("d")
+	assert.True(t, ok)
+}
+
+func TestClockCache_WeightedGrowsRing(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[string, int](100, weighByValue())
+
+	for i := range 50 {
+		c.Set(fmt.Sprintf("key%d", i), 1)
+	}
+
+	assert.Equal(t, 50, c.Len())
+
+	// Two heavy entries push out most of the small ones.
+	c.Set("x", 40)
+	c.Set("y", 40)
+
+	assert.Equal(t, uint64(100), c.Weight())
+	assert.Equal(t, 22, c.Len())
+}
+
+func TestClockCache_WeightedUpdate(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[string, int](10, weighByValue())
+	c.Set("a", 4)
+	c.Set("b", 4)
+
+	c.Set("a", 8)
+
+	v, ok := c.Peek("a")
+	require.True(t, ok, "an update must never evict the entry itself")
+	assert.Equal(t, 8, v)
+
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(8), c.Weight())
+}
+
+func TestClockCache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 2)
+	c.Set("big", 11)
+	c.Set("a", 20)
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"big", 11, cache.ReasonEvicted},
+		{"a", 2, cache.ReasonReplaced},
+		{"a", 20, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestClockCache_Resize(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.New[string, int](4, record(&log))
+
+	for i, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, i)
+	}
+
+	c.Get("b")
+
+	c.Resize(2)
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, []removal{
+		{"a", 0, cache.ReasonEvicted},
+		{"c", 2, cache.ReasonEvicted},
+	}, log)
+
+	// The compacted ring keeps working at its new size.
+	c.Set("e", 4)
+	assert.Equal(t, 2, c.Len())
+
+	_, ok := c.Peek("b")
+	assert.True(t, ok)
+
+	c.Resize(4)
+	c.Set("f", 5)
+	c.Set("g", 6)
+
+	assert.Equal(t, 4, c.Len(), "growing should make room without evicting")
+	assert.Len(t, log, 3)
+}
+
+func TestClockCache_ResizeWeighted(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[string, int](10, weighByValue())
+	c.Set("a", 5)
+	c.Set("b", 3)
+	c.Set("c", 2)
+
+	c.Resize(6)
+
+	assert.LessOrEqual(t, c.Weight(), uint64(6))
+
+	c.Resize(20)
+	c.Set("d", 10)
+
+	assert.LessOrEqual(t, c.Weight(), uint64(20))
+	_, ok := c.Peek("d")
+	assert.True(t, ok)
+}
+
+func TestClockCache_All(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[string, int](4)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	assert.Equal(t, []string{"a", "b", "c"}, slices.Collect(c.Keys()))
+	assert.Equal(t, []int{1, 2, 3}, slices.Collect(c.Values()))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 3}, maps.Collect(c.All()))
+
+	// Fill the ring, then evict a; e takes its slot and the hand moves on to b.
+	c.Get("b")
+	c.Set("d", 4)
+	c.Set("e", 5)
+
+	assert.Equal(t, []string{"b", "c", "d", "e"}, slices.Collect(c.Keys()))
+}
+
+func TestClockCache_AllDoesNotReference(t *testing.T) {
+	t.Parallel()
+
+	c := clock.New[string, int](2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	_ = maps.Collect(c.All())
+
+	c.Set("c", 3)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok, "iteration must not give a a second chance")
+}
+
+func TestClockCache_AllSkipsExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	for k := range c.Keys() {
+		c.Delete(k)
+	}
+
+	assert.Equal(t, 1, c.Len(), "only the live entry is yielded and deleted")
+}
+
+func TestClockCache_SnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	src := clock.New[string, int](3)
+	src.Set("a", 1)
+	src.Set("b", 2)
+	src.Set("c", 3)
+	src.Get("a")
+	src.Set("d", 4) // a gets a second chance, b is evicted, hand rests on c
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	dst := clock.New[string, int](3)
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, slices.Collect(src.Keys()), slices.Collect(dst.Keys()), "ring order from the hand")
+
+	// Both caches make the same eviction decision from here.
+	src.Get("c")
+	dst.Get("c")
+	src.Set("e", 5)
+	dst.Set("e", 5)
+
+	assert.Equal(t, slices.Collect(src.Keys()), slices.Collect(dst.Keys()))
+}
+
+func TestClockCache_RestoreIntoSmallerCache(t *testing.T) {
+	t.Parallel()
+
+	src := clock.New[string, int](4)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		src.Set(key, i)
+	}
+
+	src.Get("a")
+	src.Get("c")
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	dst := clock.New[string, int](2)
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.ElementsMatch(t, []string{"a", "c"}, slices.Collect(dst.Keys()), "referenced entries survive")
+
+	dst.Set("e", 4)
+	assert.Equal(t, 2, dst.Len())
+}
+
+func TestClockCache_RestoreRejectsOtherPolicy(t *testing.T) {
+	t.Parallel()
+
+	src := fifo.New[string, int](10)
+	src.Set("a", 1)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	dst := clock.New[string, int](10)
+	err := dst.Restore(&buf, codec.String{}, codec.Varint[int]{})
+	require.ErrorIs(t, err, cache.ErrSnapshotPolicy)
+	assert.Equal(t, 0, dst.Len())
+}
+
+func TestClockCache_GeneralizedCounterSurvivesSweeps(t *testing.T) {
+	t.Parallel()
+
+	survivors := func(c *clock.Cache[string, int]) []string {
+		c.Set("a", 1)
+		c.Set("b", 2)
+		c.Set("c", 3)
+
+		for range 3 {
+			c.Get("a")
+		}
+
+		c.Set("d", 4) // the hand passes "a" and evicts "b"
+		c.Set("e", 5) // evicts "c"
+		c.Set("f", 6) // the hand passes "a" again
+
+		return slices.Sorted(c.Keys())
+	}
+
+	assert.Equal(t, []string{"d", "e", "f"}, survivors(clock.New[string, int](3)),
+		"a reference bit buys a single second chance")
+	assert.Equal(t, []string{"a", "e", "f"}, survivors(clock.NewGeneralized[string, int](3, 3)),
+		"three hits buy three passes of the hand")
+}
+
+func TestClockCache_GeneralizedCounterSaturates(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.NewGeneralized[string, int](2, 2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	for range 10 {
+		c.Get("a")
+	}
+
+	c.Set("c", 3) // "a" drops to 1, "b" is evicted
+	c.Set("d", 4) // "a" drops to 0, "c" is evicted
+	c.Set("e", 5) // "a" is evicted
+
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonEvicted},
+		{"a", 1, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestClockCache_GeneralizedZeroMaxCount(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewGeneralized[string, int](2, 0)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Get("a")
+
+	c.Set("c", 3) // "a" gets a second chance, "b" is evicted
+	c.Set("d", 4) // a maxCount of 0 behaves like 1: "a" is evicted
+
+	assert.Equal(t, []string{"c", "d"}, slices.Sorted(c.Keys()))
+}
+
+func TestClockCache_GeneralizedSnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	src := clock.NewGeneralized[string, int](3, 3)
+	src.Set("a", 1)
+	src.Set("b", 2)
+	src.Set("c", 3)
+
+	for range 3 {
+		src.Get("a")
+	}
+
+	src.Get("b")
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	snap := buf.Bytes()
+
+	dst := clock.NewGeneralized[string, int](3, 3)
+	require.NoError(t, dst.Restore(bytes.NewReader(snap), codec.String{}, codec.Varint[int]{}))
+
+	for _, key := range []string{"d", "e", "f"} {
+		src.Set(key, 0)
+		dst.Set(key, 0)
+	}
+
+	assert.Equal(t, slices.Collect(src.Keys()), slices.Collect(dst.Keys()), "counters are preserved")
+
+	plain := clock.New[string, int](3)
+	require.NoError(t, plain.Restore(bytes.NewReader(snap), codec.String{}, codec.Varint[int]{}))
+
+	plain.Set("d", 4) // "a" and "b" are capped at 1: both are passed, "c" is evicted
+	plain.Set("e", 5) // "a" is evicted
+
+	assert.Equal(t, []string{"b", "d", "e"}, slices.Sorted(plain.Keys()))
 }
@@ -0,0 +1,609 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+// pageStatus is the CLOCK-Pro classification of a page on the clock.
+type pageStatus uint8
+
+const (
+	pageCold pageStatus = iota // resident, in its test period
+	pageHot                    // resident, frequently used
+	pageTest                   // non-resident: key only, test period still running
+)
+
+type proEntry[K comparable, V any] struct {
+	key        K
+	value      V // zero for test pages
+	status     pageStatus
+	referenced bool
+	expiresAt  int64 // unix nanoseconds, 0 means no expiration
+	timer      wheel.Timer[*proEntry[K, V]]
+	prev, next uint64 // ring indices of the neighbors on the clock
+}
+
+func (e *proEntry[K, V]) expired(now int64) bool {
+	return e.expiresAt != 0 && now >= e.expiresAt
+}
+
+// ProCache implements the CLOCK-Pro algorithm.
+//
+// Like [Cache], it keeps its entries in a ring of slots indexed by key, but
+// the slots are linked into a circular list so new pages can be placed at the
+// head of the clock, and three hands sweep it:
+//   - HAND_cold evicts unreferenced cold pages, leaving their keys behind as
+//     non-resident test pages, and promotes referenced cold pages to hot
+//   - HAND_hot demotes unreferenced hot pages to cold, clearing reference bits
+//     as it goes, whenever there are more hot pages than allowed
+//   - HAND_test removes test pages whose test period has run out
+//
+// Setting a key while its test page is still on the clock brings it back as a
+// hot page and grows the share of memory given to cold pages; a test page
+// expiring unused shrinks it. Up to capacity test pages are kept.
+//
+// The zero value is not usable; create instances with [NewPro].
+type ProCache[K comparable, V any] struct {
+	mu    sync.Mutex
+	items map[K]uint64 // ring index of every page, resident or not
+	ring  []*proEntry[K, V]
+	free  []uint64 // empty ring slots
+
+	handHot, handCold, handTest uint64
+
+	capacity                       uint64
+	coldTarget                     uint64 // adaptive number of resident cold pages
+	countHot, countCold, countTest uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*proEntry[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*ProCache[string, any])(nil)
+	_ cache.StatsReporter      = (*ProCache[string, any])(nil)
+)
+
+// NewPro creates a new CLOCK-Pro cache with the specified maximum capacity.
+//
+// The capacity determines how many key-value pairs the cache can hold. Up to
+// as many evicted keys are remembered as test pages, so the ring grows to at
+// most twice the capacity. As in the CLOCK-Pro paper, the cold page target
+// starts at 1% of the capacity, so a warm working set can stay hot, and
+// adapts to the workload from there. Options such as [cache.WithDefaultTTL]
+// are applied in order.
+//
+// Unlike [New], NewPro does not support [cache.WithWeigher] and panics if
+// given one. CLOCK-Pro, like the paging systems it was designed for, assumes
+// pages of one size: a test page hit grows the cold target by one page, and
+// the ring keeps at most as many test pages as there are resident ones.
+//
+// Example:
+//
+//	cache := clock.NewPro[string, *Page](10000)
+func NewPro[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *ProCache[K, V] {
+	o := cache.NewOptions(opts...)
+	if o.Weigher != nil {
+		panic("clock: cache.WithWeigher is not supported by NewPro")
+	}
+
+	c := &ProCache[K, V]{
+		items:      make(map[K]uint64),
+		capacity:   capacity,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	c.setColdTarget(capacity / 100)
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*proEntry[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - If the key exists: updates the value and sets the reference bit
+//   - If the key has a test page: it comes back as a hot page, and HAND_hot
+//     demotes others to cold if that leaves too many hot pages
+//   - If the key is new: it is added as a cold page with its reference bit cleared
+//
+// When the cache is full, HAND_cold runs until a cold page is evicted. The
+// overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set("page:1", page)
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *ProCache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [ProCache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("page:1", page, time.Minute)
+func (c *ProCache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if c.capacity == 0 {
+		c.stats.RecordSet()
+		c.removals.Push(key, value, cache.ReasonEvicted)
+		c.stats.RecordRemoval(cache.ReasonEvicted)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if idx, ok := c.lookup(key); ok {
+		e := c.ring[idx]
+		c.removals.Push(key, e.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		e.value = value
+		e.referenced = true
+		e.expiresAt = expiresAt
+		c.schedule(e)
+
+		return
+	}
+
+	c.stats.RecordSet()
+
+	status := pageCold
+
+	// Re-accessed during its test period: the page would have stayed had
+	// the cold area been larger.
+	if idx, ok := c.items[key]; ok {
+		c.setColdTarget(c.coldTarget + 1)
+		c.remove(idx)
+
+		status = pageHot
+	}
+
+	for c.countHot+c.countCold >= c.capacity {
+		c.runHandCold()
+	}
+
+	e := &proEntry[K, V]{key: key, value: value, status: status, expiresAt: expiresAt}
+	c.insert(e)
+	c.schedule(e)
+
+	// A page that comes back hot may leave more hot pages than allowed.
+	c.fitHot()
+}
+
+// Get retrieves a value from the cache and sets its reference bit.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist, has expired or only has
+//     a test page
+//
+// A referenced cold page is promoted to hot when HAND_cold reaches it; a
+// referenced hot page survives the next pass of HAND_hot. Use [ProCache.Peek]
+// to read without setting the bit.
+//
+// Example:
+//
+//	if page, ok := cache.Get("page:1"); ok {
+//	    render(page)
+//	}
+func (c *ProCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	idx, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	c.ring[idx].referenced = true
+	c.stats.RecordHit()
+
+	return c.ring[idx].value, true
+}
+
+// Peek retrieves a value without setting the reference bit.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist, has expired or only has
+//     a test page
+//
+// Example:
+//
+//	if page, ok := cache.Peek("page:1"); ok {
+//	    // Item found, reference bit unchanged
+//	}
+func (c *ProCache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	idx, ok := c.lookup(key)
+	if !ok {
+		var zero V
+
+		return zero, false
+	}
+
+	return c.ring[idx].value, true
+}
+
+// Delete removes a key from the cache.
+//
+// Returns true if the key existed and was removed, false if the key was not found,
+// had already expired or only had a test page. The removed entry is reported to
+// the [cache.OnEvict] listener with [cache.ReasonDeleted] and leaves no test page.
+//
+// Example:
+//
+//	cache.Delete("page:1")
+func (c *ProCache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	idx, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(idx, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the number of hot and cold pages in the cache.
+//
+// Test pages are not counted. Expired entries that have not been removed yet
+// are.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *ProCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return int(c.countHot + c.countCold)
+}
+
+// ColdTarget returns the number of resident pages currently allotted to cold
+// pages. The rest of the capacity may hold hot pages.
+//
+// It starts at 1% of the capacity, grows by one each time a key is set again
+// during its test period, and shrinks by one each time a test period ends
+// without one. It stays between 1 and the capacity minus 1, so both cold and
+// hot pages always have room.
+//
+// Example:
+//
+//	metrics.Gauge("pages.clockpro.cold_target").Set(float64(cache.ColdTarget()))
+func (c *ProCache[K, V]) ColdTarget() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.coldTarget
+}
+
+// Clear removes every entry, forgets all test pages and resets the cold page
+// target to its initial 1% of the capacity.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], in clock order starting at HAND_hot.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *ProCache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for c.pages() > 0 {
+		idx := c.handHot
+
+		if c.ring[idx].status == pageTest {
+			c.remove(idx)
+		} else {
+			c.removeEntry(idx, cache.ReasonCleared)
+		}
+	}
+
+	c.ring = nil
+	c.free = nil
+	c.setColdTarget(c.capacity / 100)
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *ProCache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *ProCache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *ProCache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *ProCache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the ring index of the resident page for key, removing it
+// first if it has expired. Test pages are not returned.
+// Must be called with lock held.
+func (c *ProCache[K, V]) lookup(key K) (uint64, bool) {
+	idx, ok := c.items[key]
+	if !ok || c.ring[idx].status == pageTest {
+		return 0, false
+	}
+
+	if e := c.ring[idx]; e.expiresAt != 0 && e.expired(c.now().UnixNano()) {
+		c.removeEntry(idx, cache.ReasonExpired)
+
+		return 0, false
+	}
+
+	return idx, true
+}
+
+// schedule registers the entry's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *ProCache[K, V]) schedule(e *proEntry[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if e.expiresAt == 0 {
+		c.wheel.Cancel(&e.timer)
+
+		return
+	}
+
+	e.timer.Value = e
+	c.wheel.Schedule(&e.timer, e.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *ProCache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(e *proEntry[K, V]) {
+		c.removeEntry(c.items[e.key], cache.ReasonExpired)
+	})
+}
+
+// runHandCold moves HAND_cold one page forward, evicting the page it leaves
+// if it is an unreferenced cold page, or promoting it to hot if it is a
+// referenced one. Afterwards it calls fitHot. Must be called with lock held.
+func (c *ProCache[K, V]) runHandCold() {
+	idx := c.handCold
+	e := c.ring[idx]
+	c.handCold = e.next
+
+	if e.status == pageCold {
+		if e.referenced {
+			e.status = pageHot
+			e.referenced = false
+			c.countCold--
+			c.countHot++
+		} else {
+			c.demote(e)
+
+			for c.countTest > c.capacity {
+				c.runHandTest()
+			}
+		}
+	}
+
+	c.fitHot()
+}
+
+// fitHot runs HAND_hot until hot pages fit in the memory not allotted to cold
+// pages. Must be called with lock held.
+func (c *ProCache[K, V]) fitHot() {
+	for c.countHot > c.capacity-c.coldTarget {
+		c.runHandHot()
+	}
+}
+
+// runHandHot moves HAND_hot one page forward, demoting the page it leaves to
+// cold if it is an unreferenced hot page and clearing its reference bit
+// otherwise. Must be called with lock held.
+func (c *ProCache[K, V]) runHandHot() {
+	e := c.ring[c.handHot]
+	c.handHot = e.next
+
+	if e.status != pageHot {
+		return
+	}
+
+	if e.referenced {
+		e.referenced = false
+
+		return
+	}
+
+	e.status = pageCold
+	c.countHot--
+	c.countCold++
+}
+
+// runHandTest moves HAND_test one page forward, ending the test period of the
+// page it leaves if it is a test page. A test period that ends without the
+// key being set again shrinks the cold page target.
+// Must be called with lock held.
+func (c *ProCache[K, V]) runHandTest() {
+	idx := c.handTest
+	c.handTest = c.ring[idx].next
+
+	if c.ring[idx].status == pageTest {
+		c.remove(idx)
+		c.setColdTarget(c.coldTarget - 1)
+	}
+}
+
+// setColdTarget sets the cold page target, keeping it between 1 and the
+// capacity minus 1. A cache of capacity 1 has room for a cold page only.
+func (c *ProCache[K, V]) setColdTarget(target uint64) {
+	c.coldTarget = max(1, min(target, c.capacity-1))
+}
+
+// demote evicts a cold page, leaving its key on the clock as a test page.
+func (c *ProCache[K, V]) demote(e *proEntry[K, V]) {
+	c.removals.Push(e.key, e.value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&e.timer)
+	}
+
+	var zero V
+
+	e.value = zero
+	e.expiresAt = 0
+	e.status = pageTest
+	c.countCold--
+	c.countTest++
+}
+
+// insert places a page at the head of the clock, just behind HAND_hot, so
+// every hand reaches it last.
+func (c *ProCache[K, V]) insert(e *proEntry[K, V]) {
+	var idx uint64
+
+	if n := len(c.free); n > 0 {
+		idx = c.free[n-1]
+		c.free = c.free[:n-1]
+		c.ring[idx] = e
+	} else {
+		idx = uint64(len(c.ring))
+		c.ring = append(c.ring, e)
+	}
+
+	if c.pages() == 0 {
+		e.prev, e.next = idx, idx
+		c.handHot, c.handCold, c.handTest = idx, idx, idx
+	} else {
+		next := c.ring[c.handHot]
+		e.prev, e.next = next.prev, c.handHot
+		c.ring[next.prev].next = idx
+		next.prev = idx
+	}
+
+	c.items[e.key] = idx
+
+	if e.status == pageHot {
+		c.countHot++
+	} else {
+		c.countCold++
+	}
+}
+
+// removeEntry removes a resident page, cancels its expiration and queues a
+// removal notification. Must be called with lock held.
+func (c *ProCache[K, V]) removeEntry(idx uint64, reason cache.RemovalReason) {
+	e := c.ring[idx]
+	c.remove(idx)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&e.timer)
+	}
+
+	c.removals.Push(e.key, e.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// remove unlinks the page at idx from the clock, frees its slot and drops it
+// from the index. Hands pointing at it move on to the next page.
+func (c *ProCache[K, V]) remove(idx uint64) {
+	e := c.ring[idx]
+
+	c.ring[e.prev].next = e.next
+	c.ring[e.next].prev = e.prev
+
+	for _, hand := range []*uint64{&c.handHot, &c.handCold, &c.handTest} {
+		if *hand == idx {
+			*hand = e.next
+		}
+	}
+
+	switch e.status {
+	case pageHot:
+		c.countHot--
+	case pageCold:
+		c.countCold--
+	case pageTest:
+		c.countTest--
+	}
+
+	delete(c.items, e.key)
+	c.ring[idx] = nil
+	c.free = append(c.free, idx)
+}
+
+// pages returns the number of pages on the clock, resident or not.
+func (c *ProCache[K, V]) pages() uint64 {
+	return c.countHot + c.countCold + c.countTest
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *ProCache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
@@ -0,0 +1,570 @@
+package clock_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockProCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewPro[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestClockProCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewPro[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestClockProCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewPro[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestClockProCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewPro[string, int](10)
+	c.Set("a", 1)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 0, c.Len())
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+}
+
+func TestClockProCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.NewPro[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestClockProCache_EvictsUnreferencedColdPages(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.NewPro[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+
+	c.Set("d", 4) // "a" is referenced and passed over, "b" is evicted
+
+	assert.Equal(t, []removal{{"b", 2, cache.ReasonEvicted}}, log)
+
+	for _, key := range []string{"a", "c", "d"} {
+		_, ok := c.Peek(key)
+		assert.True(t, ok, "expected %q to be resident", key)
+	}
+}
+
+func TestClockProCache_TestPagesAreNotReturned(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.NewPro[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3) // "a" leaves a test page behind
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("a")
+	assert.False(t, ok)
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestClockProCache_ColdTargetAdapts(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewPro[string, int](4)
+	assert.Equal(t, uint64(1), c.ColdTarget(), "the cold target starts at 1% of the capacity, at least 1")
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		c.Set(key, 0) // "e" evicts "a", leaving its test page behind
+	}
+
+	c.Set("a", 10) // set again during its test period
+
+	assert.Equal(t, uint64(2), c.ColdTarget(), "a test page hit grows the cold target")
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 10, v)
+
+	for i := range 20 {
+		c.Set(fmt.Sprintf("new%d", i), i)
+	}
+
+	assert.Equal(t, uint64(1), c.ColdTarget(), "unused test pages shrink the cold target")
+	assert.Equal(t, 4, c.Len())
+}
+
+func TestClockProCache_TestPageHitRebalancesHotPages(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.NewPro[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Get("a")
+	c.Set("b", 2)
+	c.Get("b")
+	c.Set("c", 3)
+	c.Set("d", 4) // "a" and "b" turn hot, "c" is evicted
+	c.Set("e", 5) // "d" is evicted
+	c.Delete("e") // leaves room, so the next Set runs no cold hand
+
+	// "c" comes back hot and the cold target grows to 2, leaving room for a
+	// single hot page: "a" and "b" are demoted at once, in clock order.
+	c.Set("c", 30)
+	assert.Equal(t, uint64(2), c.ColdTarget())
+
+	log = nil
+	c.Set("f", 6)
+	c.Set("g", 7)
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonEvicted},
+		{"b", 2, cache.ReasonEvicted},
+	}, log)
+
+	_, ok := c.Peek("c")
+	assert.True(t, ok)
+}
+
+func TestClockProCache_ColdTargetLeavesRoomForHotPages(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewPro[int, int](4)
+
+	// Every evicted key is set again during its test period.
+	for i := range 100 {
+		c.Set(i%6, i)
+	}
+
+	assert.Equal(t, uint64(3), c.ColdTarget())
+	assert.Equal(t, uint64(1), clock.NewPro[int, int](1).ColdTarget())
+	assert.Equal(t, uint64(50), clock.NewPro[int, int](5000).ColdTarget())
+}
+
+func TestClockProCache_WorkingSetStaysHot(t *testing.T) {
+	t.Parallel()
+
+	// A working set half the size of the cache is read every round, with a
+	// scan of twice the capacity in between. HAND_cold promotes its
+	// referenced pages to hot, and with the cold target kept small they are
+	// never demoted again, so the scans only ever evict each other.
+	c := clock.NewPro[int, int](100)
+
+	for k := range 50 {
+		c.Set(k, k)
+	}
+
+	n := 1000
+
+	for round := range 5 {
+		for k := range 50 {
+			_, ok := c.Get(k)
+			assert.True(t, ok, "round %d: expected %d to stay resident", round, k)
+		}
+
+		for range 200 {
+			c.Set(n, n)
+			n++
+		}
+	}
+
+	assert.Equal(t, uint64(1), c.ColdTarget())
+}
+
+func TestClockProCache_TestPagesAreBounded(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewPro[int, int](3)
+
+	for i := range 100 {
+		c.Set(i, i)
+	}
+
+	assert.Equal(t, 3, c.Len())
+	assert.Equal(t, uint64(1), c.ColdTarget())
+
+	c.Set(0, 0) // long forgotten: a plain insert
+
+	assert.Equal(t, uint64(1), c.ColdTarget())
+
+	c.Set(96, 96) // among the last three evicted keys
+
+	assert.Equal(t, uint64(2), c.ColdTarget())
+}
+
+func TestClockProCache_ScanResistance(t *testing.T) {
+	t.Parallel()
+
+	// Five hot keys are read once per round, with ten one-off keys set in
+	// between. Plain second chance lets each scan sweep the hot keys out;
+	// CLOCK-Pro sees them come back during their test period and keeps them
+	// as hot pages.
+	run := func(c cache.Cache[string, int]) int {
+		hits, n := 0, 0
+
+		for round := range 10 {
+			for k := range 5 {
+				key := fmt.Sprintf("hot%d", k)
+
+				_, ok := c.Get(key)
+				if !ok {
+					c.Set(key, k)
+				} else if round == 9 {
+					hits++
+				}
+			}
+
+			for range 10 {
+				c.Set(fmt.Sprintf("scan%d", n), n)
+				n++
+			}
+		}
+
+		return hits
+	}
+
+	assert.Equal(t, 0, run(clock.New[string, int](10)))
+	assert.Equal(t, 5, run(clock.NewPro[string, int](10)))
+}
+
+func TestClockProCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.NewPro[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	now = now.Add(time.Second)
+
+	_, ok = c.Get("a")
+	assert.False(t, ok, "expected 'a' to be expired")
+	assert.Equal(t, 1, c.Len(), "expired entry should be removed on access")
+
+	v, ok = c.Get("b")
+	require.True(t, ok, "entries without TTL never expire")
+	assert.Equal(t, 2, v)
+}
+
+func TestClockProCache_PeekExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.NewPro[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(time.Minute + 1)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestClockProCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.NewPro[string, int](10,
+		cache.WithDefaultTTL[string, int](time.Minute),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, 0) // overrides the default: never expires
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok, "expected 'a' to expire after the default TTL")
+
+	_, ok = c.Get("b")
+	assert.True(t, ok, "expected 'b' to ignore the default TTL")
+}
+
+func TestClockProCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := clock.NewPro[string, int](3,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.SetWithTTL("c", 3, time.Second)
+	c.Set("d", 4) // evicts "a": its test page must not expire
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 2 }, time.Second, time.Millisecond)
+
+	for _, key := range []string{"b", "d"} {
+		_, ok := c.Peek(key)
+		assert.True(t, ok, "expected %q to survive the janitor", key)
+	}
+}
+
+func TestClockProCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := clock.NewPro[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close() // safe to call twice
+
+	c.SetWithTTL("a", 1, time.Hour)
+	c.Delete("a")
+	c.Set("b", 2)
+
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+
+	clock.NewPro[string, int](10).Close()
+}
+
+func TestClockProCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := clock.NewPro[string, int](2,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+	c.Set("c", 4)
+	c.Set("d", 5) // evicts "b"
+
+	c.SetWithTTL("e", 6, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("e")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonEvicted},
+		{"c", 4, cache.ReasonEvicted},
+		{"e", 6, cache.ReasonExpired},
+	}, log)
+}
+
+func TestClockProCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := clock.NewPro[string, int](4, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4)
+	c.Set("e", 5) // "a" becomes a test page
+	c.Set("f", 6) // "b" becomes a test page
+	c.Set("a", 1) // set again during its test period
+
+	require.Equal(t, uint64(2), c.ColdTarget())
+
+	log = nil
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(1), c.ColdTarget())
+	assert.ElementsMatch(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"d", 4, cache.ReasonCleared},
+		{"e", 5, cache.ReasonCleared},
+		{"f", 6, cache.ReasonCleared},
+	}, log)
+
+	c.Set("b", 2) // its test page is gone too
+
+	assert.Equal(t, uint64(1), c.ColdTarget())
+
+	v, ok := c.Get("b")
+	require.True(t, ok, "cache should be usable after Clear")
+	assert.Equal(t, 2, v)
+}
+
+func TestClockProCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *clock.ProCache[string, int]
+
+	c = clock.NewPro[string, int](2, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestClockProCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := clock.NewPro[string, int](2, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a")   // not counted
+	c.Set("c", 4) // evicts "b"
+	c.Delete("a")
+	c.SetWithTTL("d", 5, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("d")
+
+	s := c.Stats()
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        4,
+		Updates:     1,
+		Evictions:   1,
+		Deletions:   1,
+		Expirations: 1,
+	}, s)
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestClockProCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+
+	var nanos atomic.Int64
+
+	c := clock.NewPro[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return now.Add(time.Duration(nanos.Add(1))) }),
+	)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				if j%3 == 0 {
+					c.SetWithTTL(key, j, time.Duration(j%50))
+				}
+
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.ColdTarget()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
+
+func TestClockProCache_WeigherPanics(t *testing.T) {
+	t.Parallel()
+
+	weigher := cache.WithWeigher(func(string, int) uint64 { return 1 })
+
+	assert.PanicsWithValue(t, "clock: cache.WithWeigher is not supported by NewPro", func() {
+		clock.NewPro[string, int](10, weigher)
+	})
+}
@@ -0,0 +1,136 @@
+package codec
+
+import "encoding/binary"
+
+// Bytes encodes byte slices as a uvarint length followed by the raw bytes.
+//
+// Decode returns a copy, so the result never aliases the input buffer. A nil
+// slice and an empty slice both decode as an empty, non-nil slice.
+type Bytes struct{}
+
+// Append implements [Codec].
+func (Bytes) Append(dst []byte, v []byte) ([]byte, error) {
+	return appendFramed(dst, v), nil
+}
+
+// Decode implements [Codec].
+func (Bytes) Decode(src []byte) ([]byte, int, error) {
+	payload, n, err := framed(src)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return append([]byte{}, payload...), n, nil
+}
+
+// String encodes strings as a uvarint length followed by the raw bytes.
+type String struct{}
+
+// Append implements [Codec].
+func (String) Append(dst []byte, v string) ([]byte, error) {
+	dst = binary.AppendUvarint(dst, uint64(len(v)))
+
+	return append(dst, v...), nil
+}
+
+// Decode implements [Codec].
+func (String) Decode(src []byte) (string, int, error) {
+	payload, n, err := framed(src)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return string(payload), n, nil
+}
+
+// FixedSize is the set of numeric types with a fixed encoded width.
+//
+// int, uint and uintptr are excluded because their size depends on the
+// platform; use [Varint] or [Uvarint] for them.
+type FixedSize interface {
+	~int8 | ~int16 | ~int32 | ~int64 |
+		~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64 |
+		~complex64 | ~complex128
+}
+
+// Fixed encodes fixed-size numbers in little-endian byte order.
+//
+// Every value of T takes the same number of bytes, which makes Fixed the
+// fastest codec for numbers whose magnitude is spread across their full range,
+// such as hashes and floats.
+type Fixed[T FixedSize] struct{}
+
+// Append implements [Codec].
+func (Fixed[T]) Append(dst []byte, v T) ([]byte, error) {
+	return binary.Append(dst, binary.LittleEndian, v)
+}
+
+// Decode implements [Codec].
+func (Fixed[T]) Decode(src []byte) (T, int, error) {
+	var v T
+
+	if len(src) < binary.Size(v) {
+		return v, 0, ErrTruncated
+	}
+
+	n, err := binary.Decode(src, binary.LittleEndian, &v)
+
+	return v, n, err
+}
+
+// Signed is the set of signed integer types.
+type Signed interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+// Unsigned is the set of unsigned integer types.
+type Unsigned interface {
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// Varint encodes signed integers as zig-zag varints, so small magnitudes take
+// one or two bytes regardless of the width of T.
+type Varint[T Signed] struct{}
+
+// Append implements [Codec].
+func (Varint[T]) Append(dst []byte, v T) ([]byte, error) {
+	return binary.AppendVarint(dst, int64(v)), nil
+}
+
+// Decode implements [Codec].
+func (Varint[T]) Decode(src []byte) (T, int, error) {
+	v, n := binary.Varint(src)
+
+	switch {
+	case n == 0:
+		return 0, 0, ErrTruncated
+	case n < 0 || int64(T(v)) != v:
+		return 0, 0, ErrOverflow
+	}
+
+	return T(v), n, nil
+}
+
+// Uvarint encodes unsigned integers as varints, so small values take one or two
+// bytes regardless of the width of T.
+type Uvarint[T Unsigned] struct{}
+
+// Append implements [Codec].
+func (Uvarint[T]) Append(dst []byte, v T) ([]byte, error) {
+	return binary.AppendUvarint(dst, uint64(v)), nil
+}
+
+// Decode implements [Codec].
+func (Uvarint[T]) Decode(src []byte) (T, int, error) {
+	v, n := binary.Uvarint(src)
+
+	switch {
+	case n == 0:
+		return 0, 0, ErrTruncated
+	case n < 0 || uint64(T(v)) != v:
+		return 0, 0, ErrOverflow
+	}
+
+	return T(v), n, nil
+}
@@ -0,0 +1,92 @@
+// Package codec defines how cache keys and values are turned into bytes.
+//
+// Anything that moves entries out of process, such as the Snapshot and Restore
+// methods of the caches in this module, takes a [Codec] for the key type and
+// one for the value type.
+//
+// # Built-in Codecs
+//
+//   - [String], [Bytes]: length-prefixed raw bytes
+//   - [Fixed]: fixed-size numbers (int32, uint64, float64, ...), little-endian
+//   - [Varint], [Uvarint]: integers of any width, including int and uint, as varints
+//   - [JSON]: any type encoding/json can handle, length-prefixed
+//   - [Gob]: any type encoding/gob can handle, length-prefixed
+//
+// The binary codecs are the fastest and most compact; JSON and Gob work for
+// arbitrary structs. Every codec is a zero-size struct, so it is used as a
+// value: codec.String{}, codec.JSON[*User]{}.
+//
+// # Writing a Codec
+//
+// Encodings must be self-delimiting: Decode is handed the rest of a stream and
+// must report how many bytes it consumed, so entries can be laid out back to
+// back without extra framing. A codec for variable-length data therefore
+// usually writes a length prefix.
+//
+// # Example Usage
+//
+//	err := users.Snapshot(f, codec.String{}, codec.JSON[*User]{})
+//
+// A hand-written codec for a hot path:
+//
+//	type userCodec struct{}
+//
+//	func (userCodec) Append(dst []byte, u *User) ([]byte, error) {
+//	    dst = binary.AppendUvarint(dst, uint64(len(u.Name)))
+//	    return append(dst, u.Name...), nil
+//	}
+//
+//	func (userCodec) Decode(src []byte) (*User, int, error) {
+//	    n, k := binary.Uvarint(src)
+//	    if k <= 0 || uint64(len(src)-k) < n {
+//	        return nil, 0, io.ErrUnexpectedEOF
+//	    }
+//	    return &User{Name: string(src[k : k+int(n)])}, k + int(n), nil
+//	}
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	// ErrTruncated is returned by Decode when src ends before a complete value.
+	ErrTruncated = errors.New("codec: truncated input")
+
+	// ErrOverflow is returned by Decode when the encoded number does not fit the
+	// target type.
+	ErrOverflow = errors.New("codec: value overflows target type")
+)
+
+// Codec encodes and decodes values of type T.
+//
+// Implementations must be safe for concurrent use.
+type Codec[T any] interface {
+	// Append appends the encoding of v to dst and returns the extended slice.
+	Append(dst []byte, v T) ([]byte, error)
+
+	// Decode decodes one value from the start of src and returns it along with
+	// the number of bytes consumed. Bytes after the value are left untouched.
+	Decode(src []byte) (T, int, error)
+}
+
+// appendFramed appends payload to dst behind a uvarint length prefix.
+func appendFramed(dst, payload []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(payload)))
+
+	return append(dst, payload...)
+}
+
+// framed returns the length-prefixed payload at the start of src and the total
+// number of bytes it occupies, prefix included. The payload aliases src.
+func framed(src []byte) ([]byte, int, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > uint64(len(src)-n) {
+		return nil, 0, ErrTruncated
+	}
+
+	end := n + int(size)
+
+	return src[n:end], end, nil
+}
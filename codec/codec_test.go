@@ -0,0 +1,230 @@
+package codec_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/serroba/cache/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	Name  string
+	Age   int
+	Roles []string
+}
+
+// roundTrip encodes values back to back into one buffer and decodes them again,
+// checking that each Decode consumes exactly its own bytes.
+func roundTrip[T any](t *testing.T, c codec.Codec[T], values ...T) []T {
+	t.Helper()
+
+	var (
+		buf   []byte
+		sizes []int
+		err   error
+	)
+
+	for _, v := range values {
+		before := len(buf)
+		buf, err = c.Append(buf, v)
+		require.NoError(t, err)
+
+		sizes = append(sizes, len(buf)-before)
+	}
+
+	got := make([]T, 0, len(values))
+
+	for i := range values {
+		v, n, err := c.Decode(buf)
+		require.NoError(t, err)
+		require.Equal(t, sizes[i], n, "value %d", i)
+
+		got = append(got, v)
+		buf = buf[n:]
+	}
+
+	assert.Empty(t, buf)
+
+	return got
+}
+
+func TestString_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	values := []string{"", "a", "héllo", string(make([]byte, 300))}
+	assert.Equal(t, values, roundTrip[string](t, codec.String{}, values...))
+}
+
+func TestBytes_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	values := [][]byte{{}, {0}, []byte("payload"), make([]byte, 200)}
+	assert.Equal(t, values, roundTrip[[]byte](t, codec.Bytes{}, values...))
+}
+
+func TestBytes_DecodeDoesNotAliasInput(t *testing.T) {
+	t.Parallel()
+
+	buf, err := codec.Bytes{}.Append(nil, []byte("abc"))
+	require.NoError(t, err)
+
+	got, _, err := codec.Bytes{}.Decode(buf)
+	require.NoError(t, err)
+
+	buf[1] = 'x'
+
+	assert.Equal(t, []byte("abc"), got)
+}
+
+func TestFixed_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []int8{math.MinInt8, 0, math.MaxInt8},
+		roundTrip[int8](t, codec.Fixed[int8]{}, math.MinInt8, 0, math.MaxInt8))
+	assert.Equal(t, []uint32{0, 1, math.MaxUint32},
+		roundTrip[uint32](t, codec.Fixed[uint32]{}, 0, 1, math.MaxUint32))
+	assert.Equal(t, []int64{math.MinInt64, -1, math.MaxInt64},
+		roundTrip[int64](t, codec.Fixed[int64]{}, math.MinInt64, -1, math.MaxInt64))
+	assert.Equal(t, []float64{-1.5, 0, math.Inf(1)},
+		roundTrip[float64](t, codec.Fixed[float64]{}, -1.5, 0, math.Inf(1)))
+
+	type celsius float32
+
+	assert.Equal(t, []celsius{-40, 21.5}, roundTrip[celsius](t, codec.Fixed[celsius]{}, -40, 21.5))
+}
+
+func TestFixed_EncodedWidth(t *testing.T) {
+	t.Parallel()
+
+	buf, err := codec.Fixed[uint16]{}.Append(nil, 0x0102)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x02, 0x01}, buf)
+
+	buf, err = codec.Fixed[float64]{}.Append(nil, 1)
+	require.NoError(t, err)
+	assert.Len(t, buf, 8)
+}
+
+func TestVarint_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []int{math.MinInt, -1, 0, 1, math.MaxInt},
+		roundTrip[int](t, codec.Varint[int]{}, math.MinInt, -1, 0, 1, math.MaxInt))
+	assert.Equal(t, []uint{0, 127, 128, math.MaxUint},
+		roundTrip[uint](t, codec.Uvarint[uint]{}, 0, 127, 128, math.MaxUint))
+
+	buf, err := codec.Varint[int64]{}.Append(nil, -1)
+	require.NoError(t, err)
+	assert.Len(t, buf, 1)
+}
+
+func TestVarint_DecodeOverflow(t *testing.T) {
+	t.Parallel()
+
+	buf, err := codec.Varint[int]{}.Append(nil, 1000)
+	require.NoError(t, err)
+
+	_, _, err = codec.Varint[int8]{}.Decode(buf)
+	require.ErrorIs(t, err, codec.ErrOverflow)
+
+	buf, err = codec.Uvarint[uint]{}.Append(nil, 300)
+	require.NoError(t, err)
+
+	_, _, err = codec.Uvarint[uint8]{}.Decode(buf)
+	require.ErrorIs(t, err, codec.ErrOverflow)
+
+	tooLong := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+
+	_, _, err = codec.Uvarint[uint64]{}.Decode(tooLong)
+	require.ErrorIs(t, err, codec.ErrOverflow)
+}
+
+func TestJSON_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	values := []user{{Name: "ana", Age: 31, Roles: []string{"admin"}}, {Name: "bo"}}
+	assert.Equal(t, values, roundTrip[user](t, codec.JSON[user]{}, values...))
+
+	ptrs := roundTrip[*user](t, codec.JSON[*user]{}, &values[0], nil)
+	assert.Equal(t, &values[0], ptrs[0])
+	assert.Nil(t, ptrs[1])
+}
+
+func TestJSON_AppendError(t *testing.T) {
+	t.Parallel()
+
+	dst := []byte{1, 2}
+
+	got, err := codec.JSON[float64]{}.Append(dst, math.NaN())
+	require.Error(t, err)
+	assert.Equal(t, dst, got)
+}
+
+func TestGob_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	values := []user{{Name: "ana", Age: 31, Roles: []string{"admin"}}, {Name: "bo", Age: 7}}
+	assert.Equal(t, values, roundTrip[user](t, codec.Gob[user]{}, values...))
+
+	ints := roundTrip[map[string]int](t, codec.Gob[map[string]int]{}, map[string]int{"a": 1})
+	assert.Equal(t, map[string]int{"a": 1}, ints[0])
+}
+
+func TestGob_AppendNilPointer(t *testing.T) {
+	t.Parallel()
+
+	_, err := codec.Gob[*user]{}.Append(nil, nil)
+	require.Error(t, err)
+
+	_, err = codec.Gob[any]{}.Append(nil, nil)
+	require.Error(t, err)
+}
+
+func TestDecode_Truncated(t *testing.T) {
+	t.Parallel()
+
+	str, err := codec.String{}.Append(nil, "hello")
+	require.NoError(t, err)
+
+	js, err := codec.JSON[user]{}.Append(nil, user{Name: "ana"})
+	require.NoError(t, err)
+
+	gb, err := codec.Gob[user]{}.Append(nil, user{Name: "ana"})
+	require.NoError(t, err)
+
+	fixed, err := codec.Fixed[uint64]{}.Append(nil, 42)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		decode func([]byte) error
+		buf    []byte
+	}{
+		{"string", decodeErr[string](codec.String{}), str},
+		{"bytes", decodeErr[[]byte](codec.Bytes{}), str},
+		{"json", decodeErr[user](codec.JSON[user]{}), js},
+		{"gob", decodeErr[user](codec.Gob[user]{}), gb},
+		{"fixed", decodeErr[uint64](codec.Fixed[uint64]{}), fixed},
+		{"varint", decodeErr[int](codec.Varint[int]{}), []byte{0x80}},
+		{"uvarint", decodeErr[uint](codec.Uvarint[uint]{}), []byte{0x80}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.ErrorIs(t, tc.decode(nil), codec.ErrTruncated)
+			require.ErrorIs(t, tc.decode(tc.buf[:len(tc.buf)-1]), codec.ErrTruncated)
+		})
+	}
+}
+
+func decodeErr[T any](c codec.Codec[T]) func([]byte) error {
+	return func(src []byte) error {
+		_, _, err := c.Decode(src)
+
+		return err
+	}
+}
@@ -1,11 +1,19 @@
 package fifo_test
 
 import (
+	"bytes"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
 	"github.com/serroba/cache/fifo"
+	"github.com/serroba/cache/lru"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -421,3 +429,532 @@ func TestFIFOCache_ZeroCapacity(t *testing.T) {
 	require.True(t, ok)
 	assert.Equal(t, 2, v)
 }
+
+func TestFIFOCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := fifo.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	now = now.Add(time.Second)
+
+	_, ok = c.Get("a")
+	assert.False(t, ok, "expected 'a' to be expired")
+	assert.Equal(t, 1, c.Len(), "expired entry should be removed on access")
+
+	v, ok = c.Get("b")
+	require.True(t, ok, "entries without TTL never expire")
+	assert.Equal(t, 2, v)
+}
+
+func TestFIFOCache_PeekExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := fifo.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(time.Minute + 1)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestFIFOCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := fifo.New[string, int](10,
+		cache.WithDefaultTTL[string, int](time.Minute),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, 0) // overrides the default: never expires
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok, "expected 'a' to expire after the default TTL")
+
+	_, ok = c.Get("b")
+	assert.True(t, ok, "expected 'b' to ignore the default TTL")
+}
+
+func TestFIFOCache_UpdateRefreshesTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := fifo.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(30 * time.Second)
+	c.SetWithTTL("a", 2, time.Minute)
+
+	now = now.Add(45 * time.Second)
+
+	v, ok := c.Get("a")
+	require.True(t, ok, "expected update to reset the expiration")
+	assert.Equal(t, 2, v)
+
+	c.Set("a", 3) // no default TTL, so expiration is cleared
+
+	now = now.Add(time.Hour)
+
+	v, ok = c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestFIFOCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := fifo.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	for _, key := range []string{"b", "c", "d"} {
+		_, ok = c.Peek(key)
+		assert.True(t, ok, "expected %q to survive the janitor", key)
+	}
+}
+
+func TestFIFOCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := fifo.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close() // safe to call twice
+
+	// The cache stays usable after Close.
+	c.SetWithTTL("a", 1, time.Hour)
+	c.Delete("a")
+	c.Set("b", 2)
+
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+
+	// Close is a no-op without a janitor.
+	fifo.New[string, int](10).Close()
+}
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestFIFOCache_OnEvictCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := fifo.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	require.NotEmpty(t, log)
+	assert.Equal(t, removal{"a", 1, cache.ReasonEvicted}, log[0])
+}
+
+func TestFIFOCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := fifo.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestFIFOCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := fifo.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.ElementsMatch(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"b", 2, cache.ReasonCleared},
+	}, log)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("c", 3)
+
+	v, ok := c.Get("c")
+	require.True(t, ok, "cache should be usable after Clear")
+	assert.Equal(t, 3, v)
+}
+
+func TestFIFOCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *fifo.Cache[string, int]
+
+	c = fifo.New[string, int](2, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestFIFOCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := fifo.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	s := c.Stats()
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, s)
+	assert.InDelta(t, 1.0/3, s.HitRatio(), 1e-9)
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestFIFOCache_StatsEvictions(t *testing.T) {
+	t.Parallel()
+
+	c := fifo.New[int, int](4)
+
+	for i := range 20 {
+		c.Set(i, i)
+	}
+
+	s := c.Stats()
+	assert.Equal(t, uint64(20), s.Sets)
+	assert.Equal(t, s.Sets-uint64(c.Len()), s.Evictions)
+}
+
+func TestFIFOCache_ConcurrentStats(t *testing.T) {
+	t.Parallel()
+
+	c := fifo.New[int, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 10 {
+		wg.Add(2)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 100 {
+				c.Set(id*100+j, j)
+				c.Get(j)
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				c.Stats()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, uint64(1000), c.Stats().Requests())
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+func TestFIFOCache_WeightedEvictsUntilFits(t *testing.T) {
+	t.Parallel()
+
+	c := fifo.New[string, int](10, weighByValue())
+	c.Set("a", 3)
+	c.Set("b", 3)
+	c.Set("c", 3)
+	c.Get("a") // access does not protect in FIFO
+
+	c.Set("d", 7)
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(10), c.Weight())
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	_, ok = c.Peek("c")
+	assert.True(t, ok)
+}
+
+func TestFIFOCache_WeightedUpdateKeepsEntry(t *testing.T) {
+	t.Parallel()
+
+	c := fifo.New[string, int](10, weighByValue())
+	c.Set("a", 4)
+	c.Set("b", 4)
+
+	// "a" is the oldest entry, but growing it must evict "b" instead.
+	c.Set("a", 8)
+
+	v, ok := c.Peek("a")
+	require.True(t, ok)
+	assert.Equal(t, 8, v)
+
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(8), c.Weight())
+}
+
+func TestFIFOCache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := fifo.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 2)
+	c.Set("big", 11)
+	c.Set("a", 20)
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"big", 11, cache.ReasonEvicted},
+		{"a", 2, cache.ReasonReplaced},
+		{"a", 20, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestFIFOCache_Resize(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := fifo.New[string, int](5, record(&log))
+
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		c.Set(key, i)
+	}
+
+	c.Get("a") // access does not protect in FIFO
+
+	c.Resize(2)
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, []removal{
+		{"a", 0, cache.ReasonEvicted},
+		{"b", 1, cache.ReasonEvicted},
+		{"c", 2, cache.ReasonEvicted},
+	}, log)
+
+	c.Resize(4)
+	c.Set("f", 5)
+	c.Set("g", 6)
+
+	assert.Equal(t, 4, c.Len(), "growing should make room without evicting")
+	assert.Len(t, log, 3)
+
+	c.Set("h", 7)
+
+	_, ok := c.Peek("d")
+	assert.False(t, ok, "oldest entry is still evicted first after resizing")
+}
+
+func TestFIFOCache_All(t *testing.T) {
+	t.Parallel()
+
+	c := fifo.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a") // access does not reorder FIFO
+
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 3}, maps.Collect(c.All()))
+	assert.Equal(t, []string{"c", "b", "a"}, slices.Collect(c.Keys()))
+	assert.Equal(t, []int{3, 2, 1}, slices.Collect(c.Values()))
+
+	var backward []string
+	for k := range c.Backward() {
+		backward = append(backward, k)
+	}
+
+	assert.Equal(t, []string{"a", "b", "c"}, backward)
+}
+
+func TestFIFOCache_AllSkipsExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := fifo.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	assert.Equal(t, []string{"b"}, slices.Collect(c.Keys()))
+	assert.Equal(t, 2, c.Len(), "iterating should not remove expired entries")
+}
+
+func TestFIFOCache_AllCanReenter(t *testing.T) {
+	t.Parallel()
+
+	c := fifo.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	for k, v := range c.All() {
+		c.Set(k, v*10)
+	}
+
+	assert.Equal(t, map[string]int{"a": 10, "b": 20}, maps.Collect(c.All()))
+}
+
+func TestFIFOCache_SnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	clock := cache.WithTimeSource[string, int](func() time.Time { return now })
+
+	src := fifo.New[string, int](10, clock)
+	src.Set("a", 1)
+	src.SetWithTTL("gone", 2, time.Second)
+	src.Set("b", 3)
+	src.Set("a", 4) // updates keep insertion order
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	now = now.Add(time.Second)
+
+	dst := fifo.New[string, int](10, clock)
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, []string{"b", "a"}, slices.Collect(dst.Keys()))
+	assert.Equal(t, []int{3, 4}, slices.Collect(dst.Values()))
+}
+
+func TestFIFOCache_RestoreIntoSmallerCache(t *testing.T) {
+	t.Parallel()
+
+	src := fifo.New[string, int](10)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		src.Set(key, i)
+	}
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	dst := fifo.New[string, int](3)
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, []string{"d", "c", "b"}, slices.Collect(dst.Keys()), "the oldest entry is evicted")
+}
+
+func TestFIFOCache_RestoreRejectsOtherPolicy(t *testing.T) {
+	t.Parallel()
+
+	src := lru.New[string, int](10)
+	src.Set("a", 1)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	dst := fifo.New[string, int](10)
+	dst.Set("keep", 1)
+
+	err := dst.Restore(&buf, codec.String{}, codec.Varint[int]{})
+	require.ErrorIs(t, err, cache.ErrSnapshotPolicy)
+	assert.Equal(t, []string{"keep"}, slices.Collect(dst.Keys()))
+}
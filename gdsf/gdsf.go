@@ -0,0 +1,621 @@
+// Package gdsf provides a thread-safe GreedyDual-Size-Frequency (GDSF) cache
+// implementation.
+//
+// # When to Use GDSF
+//
+// Use GDSF when entries differ widely in size and in how expensive they are to
+// fetch again, and the cache is bounded by bytes rather than entries. This is
+// ideal for:
+//   - HTTP object and reverse proxy caches
+//   - Caches in front of origins with very different latencies
+//   - Blob and thumbnail caches where many small objects beat one large one
+//
+// # How GDSF Works
+//
+// Every entry has a priority:
+//
+//	priority = inflation + frequency × cost / size
+//
+// where frequency counts its Get hits and Sets, cost is what a miss would
+// cost (origin latency, for example) and size is what it occupies. When the
+// cache is over capacity, the entry with the lowest priority is evicted and
+// the inflation is raised to that priority. Entries that are used again have
+// their priority recomputed against the raised inflation, so entries that
+// stop being used age out even if they were once popular.
+//
+// The result favors small, expensive, frequently used entries: one large
+// object that is cheap to fetch goes before many small ones that are costly.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// Get, Set and Delete are O(log n): entries are kept in an indexed binary heap
+// ordered by priority. Peek, Len and Weight are O(1). A Set may evict several
+// entries to make room, each in O(log n).
+//
+// # Sizes and Costs
+//
+// Capacity bounds the total size of the entries. [Cache.SetWithCost] and
+// [Cache.SetWithCostTTL] set an entry's size and cost explicitly; [Cache.Set]
+// and [Cache.SetWithTTL] take the size from [cache.WithWeigher], or 1 without
+// a weigher, and a cost of 1, which reduces GDSF to frequency over size. When
+// they update an existing key, it keeps its cost, and without a weigher its
+// size. An entry of size 0, given explicitly or by the weigher, adds nothing to
+// [Cache.Weight] and is ranked as if its size were 1.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] and
+// [Cache.SetWithCostTTL] or, for every Set, with [cache.WithDefaultTTL].
+// Expired entries are treated as misses and removed lazily when Get or Peek
+// encounters them. With [cache.WithJanitor], a background goroutine also
+// removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := gdsf.New[string, []byte](64 << 20)                    // 64 MiB
+//	cache.SetWithCost("/logo.png", body, uint64(len(body)), 120)   // 120ms from the origin
+//	cache.Get("/logo.png")                                         // Frequency 2
+package gdsf
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+type node[K comparable, V any] struct {
+	key       K
+	value     V
+	size      uint64
+	cost      float64
+	frequency uint64
+	priority  float64
+	seq       uint64 // logical time of the last use, breaks priority ties
+	index     int    // position in the heap
+	expiresAt int64  // unix nanoseconds, 0 means no expiration
+	timer     wheel.Timer[*node[K, V]]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// nodeHeap orders entries by priority, lowest first, and among equal
+// priorities by last use, least recent first.
+type nodeHeap[K comparable, V any] []*node[K, V]
+
+func (h nodeHeap[K, V]) Len() int { return len(h) }
+
+func (h nodeHeap[K, V]) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+
+	return h[i].seq < h[j].seq
+}
+
+func (h nodeHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *nodeHeap[K, V]) Push(x any) {
+	n, _ := x.(*node[K, V])
+	n.index = len(*h)
+	*h = append(*h, n)
+}
+
+func (h *nodeHeap[K, V]) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+
+	return n
+}
+
+// Cache implements the GreedyDual-Size-Frequency algorithm.
+//
+// Entries are evicted lowest priority first, where the priority weighs how
+// often an entry is used and how costly it is to fetch against how much space
+// it takes, and an inflation value ages out entries that are no longer used.
+//
+// The zero value is not usable; create instances with [New].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	items map[K]*node[K, V]
+	heap  nodeHeap[K, V]
+
+	capacity  uint64
+	weight    uint64
+	weigher   func(K, V) uint64
+	inflation float64
+	seq       uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new GDSF cache bounded by the total size of its entries.
+//
+// Sizes are given to [Cache.SetWithCost] or computed by [cache.WithWeigher]
+// for [Cache.Set]; without a weigher, Set gives every entry a size of 1.
+// Options such as [cache.WithDefaultTTL] are applied in order.
+//
+// Example:
+//
+//	// Hold at most 256 MiB of response bodies
+//	cache := gdsf.New[string, *Response](256 << 20)
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		capacity:   capacity,
+		weigher:    o.Weigher,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair with a cost of 1.
+//
+// The entry's size comes from [cache.WithWeigher], or is 1 without a weigher.
+// An existing key keeps the cost it was stored with, and without a weigher
+// also its size, so refreshing a value set by [Cache.SetWithCost] does not
+// reset them. Otherwise it behaves like [Cache.SetWithCost].
+//
+// Example:
+//
+//	cache.Set("/index.html", resp)
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair with a cost of 1 that expires
+// after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("/index.html", resp, time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	size, cost := c.weigh(key, value), 1.0
+
+	if n, ok := c.lookup(key); ok {
+		cost = n.cost
+
+		if c.weigher == nil {
+			size = n.size
+		}
+	}
+
+	c.set(key, value, size, cost, ttl)
+}
+
+// SetWithCost adds or updates a key-value pair with the given size and cost.
+//
+// Behavior:
+//   - New keys: added with a frequency of 1
+//   - Existing keys: value, size and cost replaced and frequency incremented,
+//     like a [Cache.Get] hit
+//   - Entries larger than the whole capacity: not stored
+//
+// Other entries are evicted lowest priority first until the entry fits, and
+// its priority is then set to the current inflation plus frequency × cost /
+// size, with a size of 0 ranked as 1. A cost that is not positive is treated
+// as 0, which makes the entry the first candidate for eviction. The overwritten
+// value of an existing key is reported to the [cache.OnEvict] listener with
+// [cache.ReasonReplaced].
+//
+// Example:
+//
+//	start := time.Now()
+//	resp := fetch(url)
+//	cache.SetWithCost(url, resp, uint64(len(resp.Body)), float64(time.Since(start).Milliseconds()))
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) SetWithCost(key K, value V, size uint64, cost float64) {
+	c.SetWithCostTTL(key, value, size, cost, c.defaultTTL)
+}
+
+// SetWithCostTTL adds or updates a key-value pair with the given size and
+// cost that expires after ttl.
+//
+// It behaves like [Cache.SetWithCost] but overrides the default TTL for this
+// entry. A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	// Honor the origin's Cache-Control max-age
+//	cache.SetWithCostTTL(url, resp, uint64(len(resp.Body)), latencyMs, maxAge)
+func (c *Cache[K, V]) SetWithCostTTL(key K, value V, size uint64, cost float64, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.set(key, value, size, cost, ttl)
+}
+
+// set stores an entry with the given size, cost and TTL.
+// Must be called with lock held.
+func (c *Cache[K, V]) set(key K, value V, size uint64, cost float64, ttl time.Duration) {
+	if !(cost > 0) {
+		cost = 0
+	}
+
+	if size > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		c.weight = c.weight - n.size + size
+		n.value = value
+		n.size = size
+		n.cost = cost
+		n.expiresAt = expiresAt
+		c.schedule(n)
+		c.makeRoom(n, 0)
+		c.touch(n)
+
+		return
+	}
+
+	c.stats.RecordSet()
+	c.makeRoom(nil, size)
+
+	n := &node[K, V]{key: key, value: value, size: size, cost: cost, expiresAt: expiresAt}
+	c.items[key] = n
+	c.weight += size
+	heap.Push(&c.heap, n)
+	c.schedule(n)
+	c.touch(n)
+}
+
+// weigh returns the size of an entry stored with Set, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry larger than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// Get retrieves a value from the cache and increments its frequency.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// A hit recomputes the entry's priority against the current inflation. Use
+// [Cache.Peek] to read without affecting eviction.
+//
+// Example:
+//
+//	if resp, ok := cache.Get(url); ok {
+//	    return resp
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	c.touch(n)
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// Peek retrieves a value without affecting eviction.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Example:
+//
+//	if resp, ok := cache.Peek(url); ok {
+//	    // Item found, priority unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		return n.value, true
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted]. Deleting does not raise the inflation.
+//
+// Example:
+//
+//	cache.Delete(url)
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the number of entries in the cache.
+//
+// Expired entries that have not been removed yet are counted.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.heap)
+}
+
+// Weight returns the total size of the entries in the cache.
+//
+// Expired entries that have not been removed yet are counted.
+//
+// Example:
+//
+//	fmt.Printf("%d of %d bytes used\n", cache.Weight(), capacity)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weight
+}
+
+// Clear removes every entry from the cache and resets the inflation to zero.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], lowest priority first.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for len(c.heap) > 0 {
+		c.removeEntry(c.heap[0], cache.ReasonCleared)
+	}
+
+	c.inflation = 0
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the node for key, removing it first if it has expired.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// touch records a use of the node: its frequency is incremented and its
+// priority recomputed against the current inflation.
+// Must be called with lock held.
+func (c *Cache[K, V]) touch(n *node[K, V]) {
+	c.seq++
+	n.seq = c.seq
+	n.frequency++
+	n.priority = c.inflation + float64(n.frequency)*n.cost/float64(max(1, n.size))
+	heap.Fix(&c.heap, n.index)
+}
+
+// makeRoom evicts entries until extra more fits within the capacity. The entry
+// keep, if any, is never chosen, so that a Set cannot evict the entry it is
+// updating. Must be called with lock held.
+func (c *Cache[K, V]) makeRoom(keep *node[K, V], extra uint64) {
+	for c.weight+extra > c.capacity {
+		c.evict(keep)
+	}
+}
+
+// evict removes the entry with the lowest priority other than keep and raises
+// the inflation to its priority.
+// Must be called with lock held and when the cache holds an entry other than keep.
+func (c *Cache[K, V]) evict(keep *node[K, V]) {
+	n := c.heap[0]
+
+	if n == keep {
+		// keep has the lowest priority: take the lower of its children.
+		n = c.heap[1]
+		if len(c.heap) > 2 && c.heap.Less(2, 1) {
+			n = c.heap[2]
+		}
+	}
+
+	c.inflation = n.priority
+	c.removeEntry(n, cache.ReasonEvicted)
+}
+
+// removeEntry removes a node from the heap and the index, cancels its
+// expiration and queues a removal notification.
+// Must be called with lock held.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	heap.Remove(&c.heap, n.index)
+	delete(c.items, n.key)
+	c.weight -= n.size
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
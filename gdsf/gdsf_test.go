@@ -0,0 +1,535 @@
+package gdsf_test
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/gdsf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestGDSFCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := gdsf.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+}
+
+func TestGDSFCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := gdsf.New[string, int](10)
+	c.Set("a", 1)
+	c.SetWithCost("b", 2, 3, 10)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, uint64(4), c.Weight())
+}
+
+func TestGDSFCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := gdsf.New[string, int](10)
+	c.SetWithCost("a", 1, 2, 1)
+	c.SetWithCost("a", 2, 5, 1)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, uint64(5), c.Weight())
+}
+
+func TestGDSFCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := gdsf.New[string, int](10)
+	c.SetWithCost("a", 1, 4, 1)
+	c.Set("b", 2)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, uint64(1), c.Weight())
+}
+
+func TestGDSFCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestGDSFCache_SizeAndCostDecideEviction(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](100, record(&log))
+	c.SetWithCost("large", 1, 50, 10)  // priority 0.2
+	c.SetWithCost("small", 2, 10, 1)   // priority 0.1
+	c.SetWithCost("costly", 3, 30, 30) // priority 1
+	c.SetWithCost("new", 4, 20, 4)     // priority 0.2, needs 10 more bytes
+
+	assert.Equal(t, []removal{{"small", 2, cache.ReasonEvicted}}, log)
+
+	c.SetWithCost("more", 5, 20, 10) // needs 20 more bytes
+
+	// "large" and "new" tie on priority, the least recently used goes first.
+	assert.Equal(t, removal{"large", 1, cache.ReasonEvicted}, log[len(log)-1])
+	assert.Equal(t, 3, c.Len())
+	assert.Equal(t, uint64(70), c.Weight())
+}
+
+func TestGDSFCache_FrequencyRaisesPriority(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("b", 20) // an update counts as a use too
+
+	c.Set("d", 4)
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonReplaced},
+		{"c", 3, cache.ReasonEvicted},
+	}, log)
+
+	// "a", "b" and "d" now share a priority of 2.
+	c.Set("e", 5)
+	assert.Equal(t, removal{"a", 1, cache.ReasonEvicted}, log[len(log)-1])
+}
+
+func TestGDSFCache_InflationAgesOutPopularEntries(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](2, record(&log))
+	c.Set("popular", 0)
+
+	for range 3 {
+		c.Get("popular")
+	}
+
+	// Each one-off key evicts the previous one and raises the inflation, until
+	// a one-off key is worth as much as four uses made long ago.
+	for i := range 5 {
+		c.Set(fmt.Sprintf("once%d", i), i)
+	}
+
+	assert.Equal(t, []removal{
+		{"once0", 0, cache.ReasonEvicted},
+		{"once1", 1, cache.ReasonEvicted},
+		{"once2", 2, cache.ReasonEvicted},
+		{"popular", 0, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestGDSFCache_OversizedEntryIsRejected(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](10, record(&log))
+	c.SetWithCost("a", 1, 5, 1)
+	c.SetWithCost("b", 2, 11, 100)
+
+	_, ok := c.Peek("b")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+
+	c.SetWithCost("a", 3, 11, 1)
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 3, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestGDSFCache_GrowingUpdateEvictsOthers(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](10, record(&log))
+	c.SetWithCost("a", 1, 3, 1)
+	c.SetWithCost("b", 2, 3, 100)
+	c.SetWithCost("a", 3, 9, 1) // lowest priority, but never evicts itself
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"b", 2, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, 1, c.Len())
+	assert.Equal(t, uint64(9), c.Weight())
+}
+
+func TestGDSFCache_ZeroSizeAndCost(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](3, record(&log))
+	c.SetWithCost("empty", 1, 0, 1) // weighs nothing
+	c.SetWithCost("free", 2, 1, 0)
+	c.SetWithCost("nan", 3, 1, math.NaN())
+
+	assert.Equal(t, uint64(2), c.Weight())
+
+	c.Set("a", 4)
+	c.Set("b", 5)
+	c.Set("c", 6)
+
+	assert.Equal(t, []removal{
+		{"free", 2, cache.ReasonEvicted},
+		{"nan", 3, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestGDSFCache_Weigher(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](10,
+		record(&log),
+		cache.WithWeigher(func(_ string, v int) uint64 { return uint64(v) }),
+	)
+	c.Set("a", 4)
+	c.Set("b", 2)
+	c.Set("c", 5) // "a" has the lowest frequency per byte
+
+	assert.Equal(t, []removal{{"a", 4, cache.ReasonEvicted}}, log)
+	assert.Equal(t, uint64(7), c.Weight())
+
+	c.Set("zero", 0)
+
+	assert.Equal(t, 3, c.Len())
+	assert.Equal(t, uint64(7), c.Weight(), "a weigher may give an entry no weight")
+}
+
+func TestGDSFCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := gdsf.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestGDSFCache_SetWithCostTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := gdsf.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Hour),
+	)
+
+	c.SetWithCostTTL("a", 1, 40, 10, time.Second)
+	c.SetWithCost("b", 2, 40, 10)
+
+	assert.Equal(t, uint64(80), c.Weight())
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(40), c.Weight())
+}
+
+func TestGDSFCache_SetKeepsCostAndSize(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](100, record(&log))
+	c.SetWithCost("costly", 1, 50, 100) // priority 2
+	c.SetWithCost("cheap", 2, 40, 1)    // priority 0.025
+	c.Set("costly", 3)                  // still size 50 and cost 100
+
+	assert.Equal(t, uint64(90), c.Weight())
+
+	c.SetWithCost("new", 4, 20, 1) // evicts "cheap", not "costly"
+
+	assert.Equal(t, removal{"cheap", 2, cache.ReasonEvicted}, log[len(log)-1])
+
+	v, ok := c.Peek("costly")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestGDSFCache_SetKeepsCostWithWeigher(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](9,
+		record(&log),
+		cache.WithWeigher(func(_ string, v int) uint64 { return uint64(v) }),
+	)
+	c.SetWithCost("a", 2, 2, 100)
+	c.Set("b", 4)
+	c.Set("a", 3) // size 3 from the weigher, cost 100 kept
+	c.Set("c", 3) // "b" has the lower priority
+
+	assert.Equal(t, removal{"b", 4, cache.ReasonEvicted}, log[len(log)-1])
+	assert.Equal(t, uint64(6), c.Weight())
+}
+
+func TestGDSFCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := gdsf.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestGDSFCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := gdsf.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestGDSFCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := gdsf.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	gdsf.New[string, int](10).Close()
+}
+
+func TestGDSFCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := gdsf.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestGDSFCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := gdsf.New[string, int](10, record(&log))
+	c.SetWithCost("a", 1, 1, 10)
+	c.SetWithCost("b", 2, 1, 1)
+	c.SetWithCost("c", 3, 2, 4)
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonCleared},
+		{"c", 3, cache.ReasonCleared},
+		{"a", 1, cache.ReasonCleared},
+	}, log)
+
+	c.Set("a", 1)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestGDSFCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *gdsf.Cache[string, int]
+
+	c = gdsf.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestGDSFCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := gdsf.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestGDSFCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := gdsf.New[string, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
@@ -0,0 +1,47 @@
+// Package iterate turns point-in-time copies of cache contents into iterators.
+//
+// Caches copy their entries under their lock and yield the copies after
+// releasing it, so a loop body can call back into the cache without deadlocking.
+package iterate
+
+import "iter"
+
+// Entry is a key-value pair copied out of a cache.
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// Seq returns an iterator that calls snapshot each time it is ranged over and
+// yields the copied entries in order.
+func Seq[K comparable, V any](snapshot func() []Entry[K, V]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, e := range snapshot() {
+			if !yield(e.Key, e.Value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns an iterator over the keys of seq.
+func Keys[K comparable, V any](seq iter.Seq2[K, V]) iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for k := range seq {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns an iterator over the values of seq.
+func Values[K comparable, V any](seq iter.Seq2[K, V]) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range seq {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
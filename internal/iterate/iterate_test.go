@@ -0,0 +1,54 @@
+package iterate_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/serroba/cache/internal/iterate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeq_SnapshotsOnEachRange(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	seq := iterate.Seq(func() []iterate.Entry[string, int] {
+		calls++
+
+		return []iterate.Entry[string, int]{{"a", 1}, {"b", 2}}
+	})
+
+	assert.Equal(t, 0, calls, "snapshot should not be taken until ranged over")
+
+	assert.Equal(t, []string{"a", "b"}, slices.Collect(iterate.Keys(seq)))
+	assert.Equal(t, []int{1, 2}, slices.Collect(iterate.Values(seq)))
+	assert.Equal(t, 2, calls)
+}
+
+func TestSeq_StopsEarly(t *testing.T) {
+	t.Parallel()
+
+	seq := iterate.Seq(func() []iterate.Entry[string, int] {
+		return []iterate.Entry[string, int]{{"a", 1}, {"b", 2}, {"c", 3}}
+	})
+
+	var keys []string
+
+	for k := range seq {
+		keys = append(keys, k)
+
+		if k == "b" {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	for range iterate.Keys(seq) {
+		break
+	}
+
+	for range iterate.Values(seq) {
+		break
+	}
+}
@@ -0,0 +1,59 @@
+// Package janitor runs a periodic background task that can be stopped cleanly.
+package janitor
+
+import (
+	"sync"
+	"time"
+)
+
+// Janitor calls a function on a fixed interval from its own goroutine.
+//
+// A nil *Janitor is valid and Stop on it is a no-op, so owners can hold an
+// optional janitor without nil checks.
+type Janitor struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// Start launches a goroutine that calls run every interval until Stop is called.
+func Start(interval time.Duration, run func()) *Janitor {
+	j := &Janitor{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go j.loop(interval, run)
+
+	return j
+}
+
+// Stop terminates the goroutine and waits for it to exit.
+// It is safe to call Stop more than once and from multiple goroutines.
+func (j *Janitor) Stop() {
+	if j == nil {
+		return
+	}
+
+	j.once.Do(func() {
+		close(j.stop)
+	})
+
+	<-j.done
+}
+
+func (j *Janitor) loop(interval time.Duration, run func()) {
+	defer close(j.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
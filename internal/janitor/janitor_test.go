@@ -0,0 +1,49 @@
+package janitor_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJanitor_RunsPeriodically(t *testing.T) {
+	t.Parallel()
+
+	var runs atomic.Int64
+
+	j := janitor.Start(time.Millisecond, func() {
+		runs.Add(1)
+	})
+	defer j.Stop()
+
+	assert.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, time.Millisecond)
+}
+
+func TestJanitor_StopWaitsAndIsIdempotent(t *testing.T) {
+	t.Parallel()
+
+	var runs atomic.Int64
+
+	j := janitor.Start(time.Millisecond, func() {
+		runs.Add(1)
+	})
+
+	j.Stop()
+	j.Stop()
+
+	stopped := runs.Load()
+
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, stopped, runs.Load(), "no runs expected after Stop returns")
+}
+
+func TestJanitor_NilStop(t *testing.T) {
+	t.Parallel()
+
+	var j *janitor.Janitor
+
+	assert.NotPanics(t, j.Stop)
+}
@@ -0,0 +1,53 @@
+// Package removal buffers removal notifications so caches can deliver them
+// after releasing their lock.
+package removal
+
+import "github.com/serroba/cache"
+
+// Entry is a removed key-value pair awaiting delivery.
+type Entry[K comparable, V any] struct {
+	Key    K
+	Value  V
+	Reason cache.RemovalReason
+}
+
+// Queue collects removals made while a cache's lock is held.
+//
+// The owning cache calls Push under its lock, Take just before unlocking and
+// Deliver after unlocking. When no listener is configured every method is a
+// cheap no-op, so caches can call them unconditionally.
+type Queue[K comparable, V any] struct {
+	listener func(key K, value V, reason cache.RemovalReason)
+	pending  []Entry[K, V]
+}
+
+// NewQueue creates a queue that delivers to listener, which may be nil.
+func NewQueue[K comparable, V any](listener func(key K, value V, reason cache.RemovalReason)) Queue[K, V] {
+	return Queue[K, V]{listener: listener}
+}
+
+// Push records a removal. Must be called with the owner's lock held.
+func (q *Queue[K, V]) Push(key K, value V, reason cache.RemovalReason) {
+	if q.listener == nil {
+		return
+	}
+
+	q.pending = append(q.pending, Entry[K, V]{Key: key, Value: value, Reason: reason})
+}
+
+// Take returns the pending removals and resets the queue.
+// Must be called with the owner's lock held.
+func (q *Queue[K, V]) Take() []Entry[K, V] {
+	pending := q.pending
+	q.pending = nil
+
+	return pending
+}
+
+// Deliver calls the listener for each entry, in order. It must be called
+// without the owner's lock so the listener can re-enter the cache.
+func (q *Queue[K, V]) Deliver(entries []Entry[K, V]) {
+	for _, e := range entries {
+		q.listener(e.Key, e.Value, e.Reason)
+	}
+}
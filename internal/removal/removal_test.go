@@ -0,0 +1,38 @@
+package removal_test
+
+import (
+	"testing"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_DeliversInOrder(t *testing.T) {
+	t.Parallel()
+
+	var got []string
+
+	q := removal.NewQueue(func(key string, _ int, reason cache.RemovalReason) {
+		got = append(got, key+":"+reason.String())
+	})
+
+	q.Push("a", 1, cache.ReasonEvicted)
+	q.Push("b", 2, cache.ReasonDeleted)
+
+	pending := q.Take()
+	assert.Empty(t, q.Take(), "Take should reset the queue")
+
+	q.Deliver(pending)
+
+	assert.Equal(t, []string{"a:evicted", "b:deleted"}, got)
+}
+
+func TestQueue_NilListener(t *testing.T) {
+	t.Parallel()
+
+	q := removal.NewQueue[string, int](nil)
+	q.Push("a", 1, cache.ReasonEvicted)
+
+	assert.Empty(t, q.Take())
+}
@@ -0,0 +1,205 @@
+// Package segment implements the segmented LRU lists shared by the SLRU and
+// W-TinyLFU caches.
+//
+// A Stack is a fixed number of segments, each an LRU list with a limit and the
+// total weight of its entries. Segments are numbered from 0, the least
+// protected, up. Entries are promoted one segment up when they are used again,
+// and a segment over its limit demotes its least recently used entries one
+// segment down. Eviction is left to the caller, which knows which segment to
+// take victims from.
+//
+// A Stack is not safe for concurrent use; callers guard it with their own lock.
+package segment
+
+// Links are an entry's place in a [Stack]. They are meant to be embedded in
+// the structure being stored, parameterized by a pointer to it, so linking
+// does not allocate.
+//
+// The zero value is an unlinked entry.
+type Links[T any] struct {
+	prev, next T
+	segment    int
+	weight     uint64
+}
+
+func (l *Links[T]) links() *Links[T] {
+	return l
+}
+
+// Segment returns the segment the entry was last linked into.
+func (l *Links[T]) Segment() int {
+	return l.segment
+}
+
+// Weight returns the weight the entry counts for in its segment.
+func (l *Links[T]) Weight() uint64 {
+	return l.weight
+}
+
+// Older returns the next less recently used entry of the same segment, or
+// the zero T at its end.
+func (l *Links[T]) Older() T {
+	return l.next
+}
+
+// Newer returns the next more recently used entry of the same segment, or
+// the zero T at its start.
+func (l *Links[T]) Newer() T {
+	return l.prev
+}
+
+// Entry is a pointer to a structure that embeds [Links].
+type Entry[T any] interface {
+	comparable
+	links() *Links[T]
+}
+
+// list is one segment, from its most recently used entry at the front to its
+// least recently used one at the back.
+type list[T any] struct {
+	front, back T
+	capacity    uint64
+	weight      uint64
+}
+
+// Stack is a stack of LRU segments.
+type Stack[T Entry[T]] struct {
+	segments []list[T]
+	weight   uint64
+}
+
+// NewStack creates a stack of n empty segments, each with a limit of 0.
+func NewStack[T Entry[T]](n int) Stack[T] {
+	return Stack[T]{segments: make([]list[T], n)}
+}
+
+// Len returns the number of segments.
+func (s *Stack[T]) Len() int {
+	return len(s.segments)
+}
+
+// Capacity returns the limit of segment seg.
+func (s *Stack[T]) Capacity(seg int) uint64 {
+	return s.segments[seg].capacity
+}
+
+// SetCapacity sets the limit of segment seg. Entries that no longer fit stay
+// until [Stack.DemoteOverflow] moves them or the caller evicts them.
+func (s *Stack[T]) SetCapacity(seg int, capacity uint64) {
+	s.segments[seg].capacity = capacity
+}
+
+// Weight returns the total weight of the entries in all segments.
+func (s *Stack[T]) Weight() uint64 {
+	return s.weight
+}
+
+// SegmentWeight returns the total weight of the entries in segment seg.
+func (s *Stack[T]) SegmentWeight(seg int) uint64 {
+	return s.segments[seg].weight
+}
+
+// Overflows reports whether segment seg weighs more than its limit.
+func (s *Stack[T]) Overflows(seg int) bool {
+	return s.segments[seg].weight > s.segments[seg].capacity
+}
+
+// Front returns the most recently used entry of segment seg, or the zero T if
+// it is empty.
+func (s *Stack[T]) Front(seg int) T {
+	return s.segments[seg].front
+}
+
+// Back returns the least recently used entry of segment seg, or the zero T if
+// it is empty.
+func (s *Stack[T]) Back(seg int) T {
+	return s.segments[seg].back
+}
+
+// PushFront links an unlinked entry as the most recently used of segment seg,
+// counting it with the given weight.
+func (s *Stack[T]) PushFront(e T, seg int, weight uint64) {
+	var zero T
+
+	l := &s.segments[seg]
+	x := e.links()
+
+	x.segment = seg
+	x.weight = weight
+	x.prev = zero
+	x.next = l.front
+
+	if l.front == zero {
+		l.back = e
+	} else {
+		l.front.links().prev = e
+	}
+
+	l.front = e
+	l.weight += weight
+	s.weight += weight
+}
+
+// Remove unlinks an entry from its segment. Its own links are left as they
+// were, so a loop over [Links.Older] may remove the entry it is visiting.
+func (s *Stack[T]) Remove(e T) {
+	var zero T
+
+	x := e.links()
+	l := &s.segments[x.segment]
+
+	if x.prev == zero {
+		l.front = x.next
+	} else {
+		x.prev.links().next = x.next
+	}
+
+	if x.next == zero {
+		l.back = x.prev
+	} else {
+		x.next.links().prev = x.prev
+	}
+
+	l.weight -= x.weight
+	s.weight -= x.weight
+}
+
+// Move makes an entry the most recently used of segment seg, which may be its
+// own.
+func (s *Stack[T]) Move(e T, seg int) {
+	s.Remove(e)
+	s.PushFront(e, seg, e.links().weight)
+}
+
+// MoveToFront makes an entry the most recently used of its segment.
+func (s *Stack[T]) MoveToFront(e T) {
+	s.Move(e, e.links().segment)
+}
+
+// Promote moves an entry to the front of the segment above its own, or of its
+// own if it is already in the top segment. The segment above may overflow;
+// see [Stack.DemoteOverflow].
+func (s *Stack[T]) Promote(e T) {
+	s.Move(e, min(e.links().segment+1, len(s.segments)-1))
+}
+
+// Reweigh changes the weight an entry counts for in its segment.
+func (s *Stack[T]) Reweigh(e T, weight uint64) {
+	x := e.links()
+	l := &s.segments[x.segment]
+
+	l.weight = l.weight - x.weight + weight
+	s.weight = s.weight - x.weight + weight
+	x.weight = weight
+}
+
+// DemoteOverflow restores the limits of the segments above floor, from the
+// top one down, by moving their least recently used entries one segment down.
+// What overflows into floor stays there for the caller to evict.
+func (s *Stack[T]) DemoteOverflow(floor int) {
+	for seg := len(s.segments) - 1; seg > floor; seg-- {
+		for s.Overflows(seg) {
+			s.Move(s.segments[seg].back, seg-1)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package segment_test
+
+import (
+	"testing"
+
+	"github.com/serroba/cache/internal/segment"
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	segment.Links[*item]
+
+	name string
+}
+
+// names lists segment seg from most to least recently used.
+func names(s *segment.Stack[*item], seg int) []string {
+	var out []string
+
+	for e := s.Front(seg); e != nil; e = e.Older() {
+		out = append(out, e.name)
+	}
+
+	return out
+}
+
+// backward lists segment seg from least to most recently used.
+func backward(s *segment.Stack[*item], seg int) []string {
+	var out []string
+
+	for e := s.Back(seg); e != nil; e = e.Newer() {
+		out = append(out, e.name)
+	}
+
+	return out
+}
+
+func TestStack_PushFrontAndRemove(t *testing.T) {
+	t.Parallel()
+
+	s := segment.NewStack[*item](2)
+	a, b, c := &item{name: "a"}, &item{name: "b"}, &item{name: "c"}
+
+	s.PushFront(a, 0, 1)
+	s.PushFront(b, 0, 2)
+	s.PushFront(c, 1, 4)
+
+	assert.Equal(t, 2, s.Len())
+	assert.Equal(t, []string{"b", "a"}, names(&s, 0))
+	assert.Equal(t, []string{"a", "b"}, backward(&s, 0))
+	assert.Equal(t, uint64(3), s.SegmentWeight(0))
+	assert.Equal(t, uint64(7), s.Weight())
+	assert.Equal(t, 1, c.Segment())
+	assert.Equal(t, uint64(4), c.Weight())
+
+	s.Remove(b)
+	s.Remove(c)
+
+	assert.Equal(t, []string{"a"}, names(&s, 0))
+	assert.Equal(t, []string{"a"}, backward(&s, 0))
+	assert.Nil(t, s.Front(1))
+	assert.Nil(t, s.Back(1))
+	assert.Equal(t, uint64(1), s.Weight())
+}
+
+func TestStack_RemoveWhileIterating(t *testing.T) {
+	t.Parallel()
+
+	s := segment.NewStack[*item](1)
+	for _, name := range []string{"a", "b", "c"} {
+		s.PushFront(&item{name: name}, 0, 1)
+	}
+
+	var removed []string
+
+	for e := s.Front(0); e != nil; e = e.Older() {
+		s.Remove(e)
+		removed = append(removed, e.name)
+	}
+
+	assert.Equal(t, []string{"c", "b", "a"}, removed)
+	assert.Nil(t, s.Front(0))
+	assert.Equal(t, uint64(0), s.Weight())
+}
+
+func TestStack_MoveToFront(t *testing.T) {
+	t.Parallel()
+
+	s := segment.NewStack[*item](1)
+	a, b, c := &item{name: "a"}, &item{name: "b"}, &item{name: "c"}
+
+	s.PushFront(a, 0, 1)
+	s.PushFront(b, 0, 1)
+	s.PushFront(c, 0, 1)
+	s.MoveToFront(a)
+	s.MoveToFront(a)
+
+	assert.Equal(t, []string{"a", "c", "b"}, names(&s, 0))
+	assert.Equal(t, uint64(3), s.Weight())
+}
+
+func TestStack_PromoteStopsAtTop(t *testing.T) {
+	t.Parallel()
+
+	s := segment.NewStack[*item](3)
+	a := &item{name: "a"}
+
+	s.PushFront(a, 0, 5)
+
+	for _, want := range []int{1, 2, 2} {
+		s.Promote(a)
+		assert.Equal(t, want, a.Segment())
+	}
+
+	assert.Equal(t, uint64(5), s.SegmentWeight(2))
+	assert.Equal(t, uint64(0), s.SegmentWeight(0))
+	assert.Equal(t, uint64(5), s.Weight())
+}
+
+func TestStack_DemoteOverflowCascades(t *testing.T) {
+	t.Parallel()
+
+	s := segment.NewStack[*item](3)
+	s.SetCapacity(0, 1)
+	s.SetCapacity(1, 1)
+	s.SetCapacity(2, 2)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		s.PushFront(&item{name: name}, 2, 1)
+	}
+
+	assert.True(t, s.Overflows(2))
+
+	s.DemoteOverflow(0)
+
+	assert.Equal(t, []string{"d", "c"}, names(&s, 2))
+	assert.Equal(t, []string{"b"}, names(&s, 1))
+	assert.Equal(t, []string{"a"}, names(&s, 0), "a was demoted first, then pushed down by b")
+	assert.False(t, s.Overflows(0))
+	assert.Equal(t, uint64(1), s.Capacity(1))
+}
+
+func TestStack_DemoteOverflowStopsAtFloor(t *testing.T) {
+	t.Parallel()
+
+	s := segment.NewStack[*item](3)
+	s.SetCapacity(1, 1)
+	s.SetCapacity(2, 1)
+
+	for _, name := range []string{"a", "b", "c"} {
+		s.PushFront(&item{name: name}, 2, 1)
+	}
+
+	s.DemoteOverflow(1)
+
+	assert.Equal(t, []string{"c"}, names(&s, 2))
+	assert.Equal(t, []string{"b", "a"}, names(&s, 1), "the floor may overflow")
+	assert.Empty(t, names(&s, 0))
+	assert.True(t, s.Overflows(1))
+}
+
+func TestStack_Reweigh(t *testing.T) {
+	t.Parallel()
+
+	s := segment.NewStack[*item](2)
+	s.SetCapacity(1, 5)
+
+	a := &item{name: "a"}
+	s.PushFront(a, 1, 2)
+	s.Reweigh(a, 6)
+
+	assert.Equal(t, uint64(6), a.Weight())
+	assert.Equal(t, uint64(6), s.SegmentWeight(1))
+	assert.Equal(t, uint64(6), s.Weight())
+	assert.True(t, s.Overflows(1))
+
+	s.DemoteOverflow(0)
+
+	assert.Equal(t, 0, a.Segment())
+	assert.Equal(t, uint64(6), s.SegmentWeight(0))
+}
@@ -0,0 +1,194 @@
+// Package sketch implements the approximate access-frequency counter used by
+// frequency-based admission policies such as W-TinyLFU.
+package sketch
+
+import "math/bits"
+
+const (
+	// rows is the number of independent hash rows in the Count-Min Sketch.
+	rows = 4
+
+	// maxCount is the largest value a 4-bit counter can hold.
+	maxCount = 15
+
+	// resetMultiplier sets how many increments, relative to the capacity the
+	// sketch was sized for, trigger aging.
+	resetMultiplier = 10
+
+	// counterMask keeps the low three bits of every 4-bit counter in a word,
+	// which is what remains after shifting the word right by one to halve them.
+	counterMask = 0x7777777777777777
+)
+
+// seeds mix a key hash into a different counter position for each row.
+var seeds = [rows]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+// Frequency estimates how often each key has been seen recently.
+//
+// It combines a Count-Min Sketch of 4-bit counters with a doorkeeper Bloom
+// filter. The first sighting of a key only sets its doorkeeper bits, so the
+// long tail of keys seen once never reaches the sketch. Every increment is also
+// a sample: once the number of samples reaches ten times the capacity the
+// sketch was sized for, all counters are halved and the doorkeeper is cleared,
+// so the estimate tracks recent popularity instead of all-time counts.
+//
+// Keys are passed in as 64-bit hashes. Frequency is not safe for concurrent
+// use; caches call it with their own lock held.
+type Frequency struct {
+	counters  []uint64 // rows*width 4-bit counters, 16 per word
+	width     uint64   // counters per row, a power of two
+	door      []uint64 // doorkeeper bits
+	doorMask  uint64   // number of doorkeeper bits minus one
+	samples   uint64
+	threshold uint64
+}
+
+// New returns a Frequency sized for a cache holding about capacity entries.
+func New(capacity uint64) *Frequency {
+	width := nextPowerOfTwo(max(capacity, 16))
+	doorBits := width * 8
+
+	return &Frequency{
+		counters:  make([]uint64, rows*width/16),
+		width:     width,
+		door:      make([]uint64, doorBits/64),
+		doorMask:  doorBits - 1,
+		threshold: max(capacity, 1) * resetMultiplier,
+	}
+}
+
+// Increment records one occurrence of the key with the given hash.
+func (f *Frequency) Increment(hash uint64) {
+	f.samples++
+
+	if f.admitToDoor(hash) {
+		for row := range rows {
+			word, shift := f.position(hash, row)
+			if (f.counters[word]>>shift)&maxCount < maxCount {
+				f.counters[word] += 1 << shift
+			}
+		}
+	}
+
+	if f.samples >= f.threshold {
+		f.age()
+	}
+}
+
+// Estimate returns the approximate number of recent occurrences of the key
+// with the given hash, at most 16.
+func (f *Frequency) Estimate(hash uint64) int {
+	count := uint64(maxCount)
+
+	for row := range rows {
+		word, shift := f.position(hash, row)
+		count = min(count, (f.counters[word]>>shift)&maxCount)
+	}
+
+	if f.inDoor(hash) {
+		count++
+	}
+
+	return int(count)
+}
+
+// Reset forgets every recorded occurrence.
+func (f *Frequency) Reset() {
+	clear(f.counters)
+	clear(f.door)
+	f.samples = 0
+}
+
+// Grow resizes the sketch for a cache holding about capacity entries, keeping
+// the occurrences recorded so far. It never shrinks the sketch.
+//
+// Widening a row splits each counter into several, one for each value of the
+// hash bits now in use, and each starts with the old count, so no estimate
+// drops. Keys that shared a counter before the split stay overestimated by
+// each other's counts until aging halves them.
+func (f *Frequency) Grow(capacity uint64) {
+	f.threshold = max(f.threshold, max(capacity, 1)*resetMultiplier)
+
+	width := nextPowerOfTwo(max(capacity, 16))
+	if width <= f.width {
+		return
+	}
+
+	oldRow, newRow := f.width/16, width/16
+	counters := make([]uint64, rows*newRow)
+
+	for row := range uint64(rows) {
+		for w := range newRow {
+			counters[row*newRow+w] = f.counters[row*oldRow+w%oldRow]
+		}
+	}
+
+	door := make([]uint64, width*8/64)
+	for w := range door {
+		door[w] = f.door[w%len(f.door)]
+	}
+
+	f.counters = counters
+	f.width = width
+	f.door = door
+	f.doorMask = width*8 - 1
+}
+
+// age halves every counter and clears the doorkeeper.
+func (f *Frequency) age() {
+	for i, w := range f.counters {
+		f.counters[i] = (w >> 1) & counterMask
+	}
+
+	clear(f.door)
+	f.samples /= 2
+}
+
+// position returns the word and bit offset of the key's counter in row.
+func (f *Frequency) position(hash uint64, row int) (int, uint) {
+	h := (hash ^ hash>>29) * seeds[row]
+	h ^= h >> 32
+	i := uint64(row)*f.width + h&(f.width-1)
+
+	return int(i / 16), uint(i%16) * 4
+}
+
+// admitToDoor reports whether every doorkeeper bit for the key was already set,
+// setting them if not.
+func (f *Frequency) admitToDoor(hash uint64) bool {
+	present := true
+
+	for _, bit := range f.doorBits(hash) {
+		mask := uint64(1) << (bit % 64)
+		if f.door[bit/64]&mask == 0 {
+			present = false
+			f.door[bit/64] |= mask
+		}
+	}
+
+	return present
+}
+
+// inDoor reports whether the key has been seen since the doorkeeper was last cleared.
+func (f *Frequency) inDoor(hash uint64) bool {
+	for _, bit := range f.doorBits(hash) {
+		if f.door[bit/64]&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// doorBits returns the doorkeeper bit indexes for the key, derived from two
+// halves of its hash by double hashing.
+func (f *Frequency) doorBits(hash uint64) [3]uint64 {
+	h1, h2 := hash, bits.RotateLeft64(hash, 32)|1
+
+	return [3]uint64{h1 & f.doorMask, (h1 + h2) & f.doorMask, (h1 + 2*h2) & f.doorMask}
+}
+
+// nextPowerOfTwo returns the smallest power of two that is at least n.
+func nextPowerOfTwo(n uint64) uint64 {
+	return 1 << bits.Len64(n-1)
+}
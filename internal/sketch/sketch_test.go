@@ -0,0 +1,134 @@
+package sketch_test
+
+import (
+	"testing"
+
+	"github.com/serroba/cache/internal/sketch"
+	"github.com/stretchr/testify/assert"
+)
+
+// hash spreads small integers over 64 bits the way a real key hash would.
+func hash(i uint64) uint64 {
+	i ^= i >> 33
+	i *= 0xff51afd7ed558ccd
+	i ^= i >> 33
+
+	return i
+}
+
+func TestFrequency_CountsOccurrences(t *testing.T) {
+	t.Parallel()
+
+	f := sketch.New(1000)
+
+	assert.Equal(t, 0, f.Estimate(hash(1)))
+
+	f.Increment(hash(1))
+	assert.Equal(t, 1, f.Estimate(hash(1)), "first sighting is held by the doorkeeper")
+
+	for range 4 {
+		f.Increment(hash(1))
+	}
+
+	assert.Equal(t, 5, f.Estimate(hash(1)))
+	assert.Equal(t, 0, f.Estimate(hash(2)))
+}
+
+func TestFrequency_Saturates(t *testing.T) {
+	t.Parallel()
+
+	f := sketch.New(1000)
+
+	for range 100 {
+		f.Increment(hash(1))
+	}
+
+	assert.Equal(t, 16, f.Estimate(hash(1)))
+}
+
+func TestFrequency_DistinguishesKeys(t *testing.T) {
+	t.Parallel()
+
+	f := sketch.New(1000)
+
+	for i := range uint64(500) {
+		for range i % 8 {
+			f.Increment(hash(i))
+		}
+	}
+
+	exact := 0
+
+	for i := range uint64(500) {
+		est := f.Estimate(hash(i))
+		assert.GreaterOrEqual(t, est, int(i%8), "Count-Min never underestimates")
+
+		if est == int(i%8) {
+			exact++
+		}
+	}
+
+	assert.Greater(t, exact, 450)
+}
+
+func TestFrequency_AgesCounters(t *testing.T) {
+	t.Parallel()
+
+	f := sketch.New(16) // ages every 160 increments
+
+	for range 159 {
+		f.Increment(hash(1))
+	}
+
+	assert.Equal(t, 16, f.Estimate(hash(1)))
+
+	f.Increment(hash(1))
+
+	assert.Equal(t, 7, f.Estimate(hash(1)), "saturated counter halved, doorkeeper cleared")
+}
+
+func TestFrequency_Reset(t *testing.T) {
+	t.Parallel()
+
+	f := sketch.New(100)
+
+	for range 5 {
+		f.Increment(hash(1))
+	}
+
+	f.Reset()
+
+	assert.Equal(t, 0, f.Estimate(hash(1)))
+}
+
+func TestFrequency_GrowKeepsCounts(t *testing.T) {
+	t.Parallel()
+
+	f := sketch.New(16)
+
+	for i := range uint64(16) {
+		for range i % 8 {
+			f.Increment(hash(i))
+		}
+	}
+
+	f.Grow(1000)
+
+	for i := range uint64(16) {
+		assert.GreaterOrEqual(t, f.Estimate(hash(i)), int(i%8), "growing never loses a count")
+	}
+}
+
+func TestFrequency_GrowNeverShrinks(t *testing.T) {
+	t.Parallel()
+
+	f := sketch.New(1000)
+
+	for range 5 {
+		f.Increment(hash(1))
+	}
+
+	f.Grow(10)
+
+	assert.Equal(t, 5, f.Estimate(hash(1)))
+}
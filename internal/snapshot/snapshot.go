@@ -0,0 +1,200 @@
+// Package snapshot implements the binary format shared by the caches' Snapshot
+// and Restore methods.
+//
+// A snapshot is laid out as:
+//
+//	magic   [4]byte  "CSNP"
+//	version uint8
+//	policy  uint8
+//	count   uvarint
+//	entries count × (flags uint8, expiresAt varint, key, value)
+//	crc     uint32   CRC-32 (IEEE) of everything above, big-endian
+//
+// Keys and values are encoded with the caller's codecs. Entries appear in the
+// order the cache wants them back, and flags carries per-entry policy state
+// such as a segment or reference bit.
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
+)
+
+// Version is the current format version.
+const Version = 1
+
+// Policy identifies the eviction policy that wrote a snapshot.
+type Policy uint8
+
+// Policies that can write snapshots.
+const (
+	PolicyLRU Policy = iota + 1
+	PolicySLRU
+	PolicyFIFO
+	PolicyClock
+	PolicyS3FIFO
+)
+
+var magic = [4]byte{'C', 'S', 'N', 'P'}
+
+const (
+	headerLen  = len(magic) + 2
+	trailerLen = 4
+)
+
+// Entry is a cache entry together with the policy state needed to restore it.
+type Entry[K comparable, V any] struct {
+	Key       K
+	Value     V
+	ExpiresAt int64 // unix nanoseconds, 0 means no expiration
+	Flags     uint8
+}
+
+// Write encodes entries as a snapshot for policy and writes it to w.
+func Write[K comparable, V any](
+	w io.Writer, policy Policy, entries []Entry[K, V], keys codec.Codec[K], values codec.Codec[V],
+) error {
+	buf := make([]byte, 0, headerLen+16*len(entries)+trailerLen)
+	buf = append(buf, magic[:]...)
+	buf = append(buf, Version, byte(policy))
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+
+	var err error
+
+	for _, e := range entries {
+		buf = append(buf, e.Flags)
+		buf = binary.AppendVarint(buf, e.ExpiresAt)
+
+		if buf, err = keys.Append(buf, e.Key); err != nil {
+			return fmt.Errorf("cache: snapshot: encode key: %w", err)
+		}
+
+		if buf, err = values.Append(buf, e.Value); err != nil {
+			return fmt.Errorf("cache: snapshot: encode value: %w", err)
+		}
+	}
+
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("cache: snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads a whole snapshot from r and decodes its entries.
+//
+// The header and checksum are verified before any entry is decoded, and the
+// entries are only returned if all of them decode cleanly, so callers can apply
+// the result atomically. Format problems are reported as [*cache.SnapshotError].
+func Read[K comparable, V any](
+	r io.Reader, policy Policy, keys codec.Codec[K], values codec.Codec[V],
+) ([]Entry[K, V], error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cache: restore: %w", err)
+	}
+
+	payload, err := verify(data, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	count, n := binary.Uvarint(payload)
+	if n <= 0 || count > uint64(len(payload)) {
+		return nil, malformed(nil)
+	}
+
+	payload = payload[n:]
+	entries := make([]Entry[K, V], 0, count)
+	seen := make(map[K]struct{}, count)
+
+	for range count {
+		var e Entry[K, V]
+
+		if len(payload) == 0 {
+			return nil, malformed(io.ErrUnexpectedEOF)
+		}
+
+		e.Flags = payload[0]
+		payload = payload[1:]
+
+		if e.ExpiresAt, n = binary.Varint(payload); n <= 0 {
+			return nil, malformed(io.ErrUnexpectedEOF)
+		}
+
+		payload = payload[n:]
+
+		if e.Key, payload, err = decode(keys, payload, "key"); err != nil {
+			return nil, err
+		}
+
+		if e.Value, payload, err = decode(values, payload, "value"); err != nil {
+			return nil, err
+		}
+
+		if _, dup := seen[e.Key]; dup {
+			return nil, malformed(fmt.Errorf("duplicate key %v", e.Key))
+		}
+
+		seen[e.Key] = struct{}{}
+		entries = append(entries, e)
+	}
+
+	if len(payload) != 0 {
+		return nil, malformed(fmt.Errorf("%d trailing bytes", len(payload)))
+	}
+
+	return entries, nil
+}
+
+// verify checks the header and checksum and returns the bytes between them.
+func verify(data []byte, policy Policy) ([]byte, error) {
+	if len(data) < headerLen+trailerLen || !bytes.Equal(data[:len(magic)], magic[:]) {
+		return nil, malformed(nil)
+	}
+
+	if v := data[len(magic)]; v != Version {
+		return nil, &cache.SnapshotError{Kind: cache.ErrSnapshotVersion, Err: fmt.Errorf("version %d", v)}
+	}
+
+	body, trailer := data[:len(data)-trailerLen], data[len(data)-trailerLen:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(trailer) {
+		return nil, &cache.SnapshotError{Kind: cache.ErrSnapshotChecksum}
+	}
+
+	if p := Policy(data[len(magic)+1]); p != policy {
+		return nil, &cache.SnapshotError{
+			Kind: cache.ErrSnapshotPolicy,
+			Err:  fmt.Errorf("got policy %d, want %d", p, policy),
+		}
+	}
+
+	return body[headerLen:], nil
+}
+
+// decode decodes one value from the start of src and returns the remaining bytes.
+func decode[T any](c codec.Codec[T], src []byte, what string) (T, []byte, error) {
+	v, n, err := c.Decode(src)
+	if err != nil {
+		return v, nil, malformed(fmt.Errorf("decode %s: %w", what, err))
+	}
+
+	if n < 0 || n > len(src) {
+		return v, nil, malformed(fmt.Errorf("decode %s: codec consumed %d of %d bytes", what, n, len(src)))
+	}
+
+	return v, src[n:], nil
+}
+
+// malformed wraps err as an [cache.ErrSnapshotFormat] error.
+func malformed(err error) error {
+	return &cache.SnapshotError{Kind: cache.ErrSnapshotFormat, Err: err}
+}
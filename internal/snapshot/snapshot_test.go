@@ -0,0 +1,134 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/snapshot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errEncode = errors.New("cannot encode")
+
+type stringCodec struct{}
+
+func (stringCodec) Append(dst []byte, v string) ([]byte, error) {
+	if v == "unencodable" {
+		return nil, errEncode
+	}
+
+	dst = binary.AppendUvarint(dst, uint64(len(v)))
+
+	return append(dst, v...), nil
+}
+
+func (stringCodec) Decode(src []byte) (string, int, error) {
+	n, k := binary.Uvarint(src)
+	if k <= 0 || uint64(len(src)-k) < n {
+		return "", 0, io.ErrUnexpectedEOF
+	}
+
+	return string(src[k : k+int(n)]), k + int(n), nil
+}
+
+func write(t *testing.T, policy snapshot.Policy, entries []snapshot.Entry[string, string]) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	require.NoError(t, snapshot.Write(&buf, policy, entries, stringCodec{}, stringCodec{}))
+
+	return buf.Bytes()
+}
+
+func read(data []byte, policy snapshot.Policy) ([]snapshot.Entry[string, string], error) {
+	return snapshot.Read(bytes.NewReader(data), policy, stringCodec{}, stringCodec{})
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	entries := []snapshot.Entry[string, string]{
+		{Key: "a", Value: "1", ExpiresAt: 0, Flags: 1},
+		{Key: "b", Value: "", ExpiresAt: 1234567890, Flags: 0},
+		{Key: "", Value: "empty key", ExpiresAt: -5, Flags: 255},
+	}
+
+	got, err := read(write(t, snapshot.PolicyLRU, entries), snapshot.PolicyLRU)
+	require.NoError(t, err)
+	assert.Equal(t, entries, got)
+
+	got, err = read(write(t, snapshot.PolicyFIFO, nil), snapshot.PolicyFIFO)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestSnapshot_Rejects(t *testing.T) {
+	t.Parallel()
+
+	valid := write(t, snapshot.PolicyLRU, []snapshot.Entry[string, string]{{Key: "a", Value: "1"}})
+
+	// resign recomputes the checksum so only the intended field is wrong.
+	resign := func(data []byte) []byte {
+		body := data[:len(data)-4]
+
+		return binary.BigEndian.AppendUint32(bytes.Clone(body), crc32.ChecksumIEEE(body))
+	}
+
+	flipped := bytes.Clone(valid)
+	flipped[8] ^= 0xff
+
+	newer := bytes.Clone(valid)
+	newer[4] = snapshot.Version + 1
+
+	twoKeys := write(t, snapshot.PolicyLRU, []snapshot.Entry[string, string]{{Key: "a"}, {Key: "b"}})
+	dup := resign(bytes.ReplaceAll(twoKeys, []byte{1, 'b'}, []byte{1, 'a'}))
+
+	trailing := resign(append(bytes.Clone(valid[:len(valid)-4]), 0, 0, 0, 0, 0))
+
+	tests := []struct {
+		name   string
+		data   []byte
+		policy snapshot.Policy
+		want   error
+	}{
+		{"empty", nil, snapshot.PolicyLRU, cache.ErrSnapshotFormat},
+		{"not a snapshot", []byte("hello, world"), snapshot.PolicyLRU, cache.ErrSnapshotFormat},
+		{"truncated", valid[:len(valid)-1], snapshot.PolicyLRU, cache.ErrSnapshotChecksum},
+		{"corrupted", flipped, snapshot.PolicyLRU, cache.ErrSnapshotChecksum},
+		{"newer version", newer, snapshot.PolicyLRU, cache.ErrSnapshotVersion},
+		{"other policy", valid, snapshot.PolicyClock, cache.ErrSnapshotPolicy},
+		{"duplicate key", dup, snapshot.PolicyLRU, cache.ErrSnapshotFormat},
+		{"trailing bytes", trailing, snapshot.PolicyLRU, cache.ErrSnapshotFormat},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := read(tc.data, tc.policy)
+			require.ErrorIs(t, err, tc.want)
+
+			var snapErr *cache.SnapshotError
+			assert.ErrorAs(t, err, &snapErr)
+		})
+	}
+}
+
+func TestSnapshot_EncodeError(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	err := snapshot.Write(&buf, snapshot.PolicyLRU,
+		[]snapshot.Entry[string, string]{{Key: "unencodable"}}, stringCodec{}, stringCodec{})
+
+	require.ErrorIs(t, err, errEncode)
+	assert.Zero(t, buf.Len(), "nothing should be written on failure")
+}
@@ -0,0 +1,86 @@
+// Package stats implements the lock-free counters behind each cache's Stats method.
+package stats
+
+import (
+	"sync/atomic"
+
+	"github.com/serroba/cache"
+)
+
+// Counters accumulates cache statistics with atomic operations.
+//
+// Caches record events while holding their own lock, so writes never contend
+// with each other; the atomics only let Snapshot and Reset run without taking
+// that lock.
+//
+// The zero value is ready to use.
+type Counters struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	sets        atomic.Uint64
+	updates     atomic.Uint64
+	evictions   atomic.Uint64
+	deletions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// RecordHit counts a Get that found a live entry.
+func (c *Counters) RecordHit() {
+	c.hits.Add(1)
+}
+
+// RecordMiss counts a Get that found nothing.
+func (c *Counters) RecordMiss() {
+	c.misses.Add(1)
+}
+
+// RecordSet counts the insertion of a new key.
+func (c *Counters) RecordSet() {
+	c.sets.Add(1)
+}
+
+// RecordUpdate counts an overwrite of an existing key.
+func (c *Counters) RecordUpdate() {
+	c.updates.Add(1)
+}
+
+// RecordRemoval counts an entry leaving the cache for the given reason.
+// Replacements and clears are not counted as removals.
+func (c *Counters) RecordRemoval(reason cache.RemovalReason) {
+	switch reason {
+	case cache.ReasonEvicted:
+		c.evictions.Add(1)
+	case cache.ReasonDeleted:
+		c.deletions.Add(1)
+	case cache.ReasonExpired:
+		c.expirations.Add(1)
+	case cache.ReasonReplaced, cache.ReasonCleared:
+	}
+}
+
+// Snapshot returns the current values of all counters.
+//
+// Each counter is read atomically, but the snapshot as a whole is not: a
+// concurrent operation may be reflected in some fields and not others.
+func (c *Counters) Snapshot() cache.Stats {
+	return cache.Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Sets:        c.sets.Load(),
+		Updates:     c.updates.Load(),
+		Evictions:   c.evictions.Load(),
+		Deletions:   c.deletions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// Reset sets every counter back to zero.
+func (c *Counters) Reset() {
+	c.hits.Store(0)
+	c.misses.Store(0)
+	c.sets.Store(0)
+	c.updates.Store(0)
+	c.evictions.Store(0)
+	c.deletions.Store(0)
+	c.expirations.Store(0)
+}
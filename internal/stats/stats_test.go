@@ -0,0 +1,40 @@
+package stats_test
+
+import (
+	"testing"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounters_RecordAndReset(t *testing.T) {
+	t.Parallel()
+
+	var c stats.Counters
+
+	c.RecordHit()
+	c.RecordHit()
+	c.RecordMiss()
+	c.RecordSet()
+	c.RecordUpdate()
+	c.RecordRemoval(cache.ReasonEvicted)
+	c.RecordRemoval(cache.ReasonDeleted)
+	c.RecordRemoval(cache.ReasonExpired)
+	c.RecordRemoval(cache.ReasonReplaced)
+	c.RecordRemoval(cache.ReasonCleared)
+
+	assert.Equal(t, cache.Stats{
+		Hits:        2,
+		Misses:      1,
+		Sets:        1,
+		Updates:     1,
+		Evictions:   1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Snapshot())
+
+	c.Reset()
+
+	assert.Equal(t, cache.Stats{}, c.Snapshot())
+}
@@ -0,0 +1,258 @@
+// Package wheel implements a hierarchical timing wheel for scheduling expirations.
+//
+// Time is divided into ticks of a fixed duration. The wheel has several levels of
+// 64 slots each; level 0 covers the next 64 ticks, level 1 the next 64*64, and so
+// on. A timer is placed in the coarsest level that can represent its deadline and
+// cascades down one level each time that slot comes due, so scheduling and
+// cancelling are O(1) and every timer is touched at most once per level before it
+// fires. Advancing skips over stretches of time in which the lower levels are
+// empty, so an idle wheel costs nothing to advance.
+//
+// A Wheel is not safe for concurrent use; callers guard it with their own lock.
+package wheel
+
+const (
+	slotBits      = 6
+	slotsPerLevel = 1 << slotBits
+	slotMask      = slotsPerLevel - 1
+	levels        = 5
+
+	// maxDelta is the largest distance, in ticks, that the top level can represent.
+	// Timers further out are parked in the top level and rescheduled when it comes due.
+	maxDelta = 1<<(slotBits*levels) - 1
+)
+
+// Timer is a scheduled value. It is meant to be embedded in the structure it
+// expires, so scheduling does not allocate.
+//
+// The zero value is an unscheduled timer.
+type Timer[T any] struct {
+	// Value is passed to the fire callback of [Wheel.Advance].
+	Value T
+
+	deadline   uint64
+	level      int
+	prev, next *Timer[T]
+}
+
+// Scheduled reports whether the timer is currently in a wheel.
+func (t *Timer[T]) Scheduled() bool {
+	return t.prev != nil
+}
+
+// Wheel is a hierarchical timing wheel.
+//
+// The zero value is not usable; create instances with [New].
+type Wheel[T any] struct {
+	tick    int64
+	current uint64
+	slots   [levels][slotsPerLevel]Timer[T]
+	counts  [levels]int
+	len     int
+}
+
+// New creates a wheel with the given tick length, in nanoseconds, whose clock
+// starts at now (unix nanoseconds).
+func New[T any](tick, now int64) *Wheel[T] {
+	if tick <= 0 {
+		tick = 1
+	}
+
+	w := &Wheel[T]{tick: tick}
+	w.current = w.floor(now)
+
+	for l := range w.slots {
+		for s := range w.slots[l] {
+			head := &w.slots[l][s]
+			head.prev = head
+			head.next = head
+		}
+	}
+
+	return w
+}
+
+// Len returns the number of scheduled timers.
+func (w *Wheel[T]) Len() int {
+	return w.len
+}
+
+// Schedule arranges for t to fire once the wheel has advanced past deadline
+// (unix nanoseconds). If t is already scheduled it is moved to the new deadline.
+//
+// Deadlines are rounded up to the next tick, so a timer never fires early.
+func (w *Wheel[T]) Schedule(t *Timer[T], deadline int64) {
+	w.Cancel(t)
+
+	t.deadline = w.ceil(deadline)
+	if t.deadline <= w.current {
+		t.deadline = w.current + 1
+	}
+
+	w.place(t)
+	w.len++
+}
+
+// Cancel removes t from the wheel. Cancelling an unscheduled timer is a no-op.
+func (w *Wheel[T]) Cancel(t *Timer[T]) {
+	if !t.Scheduled() {
+		return
+	}
+
+	w.unlink(t)
+	w.len--
+}
+
+// Advance moves the wheel's clock forward to now (unix nanoseconds) and calls
+// fire for every timer whose deadline has passed, in deadline order at tick
+// granularity. Fired timers are unscheduled before fire is called, and fire may
+// schedule or cancel other timers.
+func (w *Wheel[T]) Advance(now int64, fire func(T)) {
+	target := w.floor(now)
+
+	for w.current < target {
+		if w.len == 0 {
+			w.current = target
+
+			return
+		}
+
+		w.skipIdle(target)
+
+		if w.current == target {
+			return
+		}
+
+		w.current++
+		w.cascade()
+
+		var due Timer[T]
+
+		due.prev = &due
+		due.next = &due
+
+		w.moveAll(&w.slots[0][w.current&slotMask], &due)
+
+		for due.next != &due {
+			t := due.next
+			w.unlink(t)
+			w.len--
+
+			fire(t.Value)
+		}
+	}
+}
+
+// skipIdle moves the clock to just before the next tick at which a timer could
+// fire or cascade, without passing target. Ticks skipped this way have empty
+// level-0 slots and no non-empty slot to cascade.
+func (w *Wheel[T]) skipIdle(target uint64) {
+	level := 0
+	for level < levels-1 && w.counts[level] == 0 {
+		level++
+	}
+
+	if level == 0 {
+		return
+	}
+
+	next := w.current | (1<<(slotBits*level) - 1)
+	w.current = min(next, target)
+}
+
+// cascade redistributes the higher-level slots that come due at the current tick.
+func (w *Wheel[T]) cascade() {
+	for l := 1; l < levels; l++ {
+		shift := uint(slotBits * l)
+		if w.current&(1<<shift-1) != 0 {
+			return
+		}
+
+		var pending Timer[T]
+
+		pending.prev = &pending
+		pending.next = &pending
+
+		w.moveAll(&w.slots[l][(w.current>>shift)&slotMask], &pending)
+
+		for pending.next != &pending {
+			t := pending.next
+			w.unlink(t)
+			w.place(t)
+		}
+	}
+}
+
+// place links t into the slot matching its deadline. t must not be linked.
+func (w *Wheel[T]) place(t *Timer[T]) {
+	deadline := t.deadline
+
+	delta := deadline - w.current
+	if deadline < w.current {
+		delta = 0
+		deadline = w.current
+	}
+
+	if delta > maxDelta {
+		delta = maxDelta
+		deadline = w.current + maxDelta
+	}
+
+	level := 0
+	for level < levels-1 && delta >= 1<<(slotBits*(level+1)) {
+		level++
+	}
+
+	head := &w.slots[level][(deadline>>(slotBits*level))&slotMask]
+
+	t.level = level
+	w.counts[level]++
+
+	t.prev = head.prev
+	t.next = head
+	head.prev.next = t
+	head.prev = t
+}
+
+// moveAll splices every timer from the list at src onto the list at dst.
+func (w *Wheel[T]) moveAll(src, dst *Timer[T]) {
+	if src.next == src {
+		return
+	}
+
+	first, last := src.next, src.prev
+
+	first.prev = dst.prev
+	dst.prev.next = first
+	last.next = dst
+	dst.prev = last
+
+	src.next = src
+	src.prev = src
+}
+
+func (w *Wheel[T]) floor(ns int64) uint64 {
+	if ns <= 0 {
+		return 0
+	}
+
+	return uint64(ns / w.tick)
+}
+
+func (w *Wheel[T]) ceil(ns int64) uint64 {
+	if ns <= 0 {
+		return 0
+	}
+
+	return uint64((ns-1)/w.tick + 1)
+}
+
+// unlink removes t from whatever list it is on.
+func (w *Wheel[T]) unlink(t *Timer[T]) {
+	w.counts[t.level]--
+
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.prev = nil
+	t.next = nil
+}
@@ -0,0 +1,179 @@
+package wheel_test
+
+import (
+	"testing"
+
+	"github.com/serroba/cache/internal/wheel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collect(w *wheel.Wheel[int], now int64) []int {
+	var fired []int
+
+	w.Advance(now, func(v int) {
+		fired = append(fired, v)
+	})
+
+	return fired
+}
+
+func TestWheel_FiresAtDeadline(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](10, 0)
+	timer := &wheel.Timer[int]{Value: 1}
+
+	w.Schedule(timer, 55)
+	assert.True(t, timer.Scheduled())
+	assert.Equal(t, 1, w.Len())
+
+	assert.Empty(t, collect(w, 50), "timer must not fire before its deadline")
+	assert.Equal(t, []int{1}, collect(w, 60))
+	assert.False(t, timer.Scheduled())
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestWheel_FiresInDeadlineOrder(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](1, 0)
+	deadlines := []int64{5000, 3, 70, 300000, 64, 4096, 65}
+	timers := make([]*wheel.Timer[int], len(deadlines))
+
+	for i, d := range deadlines {
+		timers[i] = &wheel.Timer[int]{Value: int(d)}
+		w.Schedule(timers[i], d)
+	}
+
+	assert.Equal(t, []int{3, 64, 65, 70, 4096, 5000, 300000}, collect(w, 1_000_000))
+}
+
+func TestWheel_AdvanceInSteps(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](1, 0)
+
+	for _, d := range []int64{10, 100, 1000, 10000} {
+		w.Schedule(&wheel.Timer[int]{Value: int(d)}, d)
+	}
+
+	var fired []int
+
+	for now := int64(0); now <= 10000; now += 7 {
+		fired = append(fired, collect(w, now)...)
+	}
+
+	fired = append(fired, collect(w, 10001)...)
+
+	assert.Equal(t, []int{10, 100, 1000, 10000}, fired)
+}
+
+func TestWheel_Cancel(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](1, 0)
+	a := &wheel.Timer[int]{Value: 1}
+	b := &wheel.Timer[int]{Value: 2}
+
+	w.Schedule(a, 10)
+	w.Schedule(b, 20)
+	w.Cancel(a)
+	w.Cancel(a) // no-op
+
+	assert.False(t, a.Scheduled())
+	assert.Equal(t, 1, w.Len())
+	assert.Equal(t, []int{2}, collect(w, 100))
+}
+
+func TestWheel_Reschedule(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](1, 0)
+	timer := &wheel.Timer[int]{Value: 1}
+
+	w.Schedule(timer, 10)
+	w.Schedule(timer, 5000)
+
+	assert.Equal(t, 1, w.Len())
+	assert.Empty(t, collect(w, 100))
+	assert.Equal(t, []int{1}, collect(w, 5000))
+}
+
+func TestWheel_PastDeadlineFiresOnNextTick(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](10, 1000)
+	timer := &wheel.Timer[int]{Value: 1}
+
+	w.Schedule(timer, 500)
+
+	assert.Empty(t, collect(w, 1000))
+	assert.Equal(t, []int{1}, collect(w, 1010))
+}
+
+func TestWheel_BeyondRange(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](1, 0)
+	far := int64(1) << 33
+
+	w.Schedule(&wheel.Timer[int]{Value: 1}, far)
+	w.Schedule(&wheel.Timer[int]{Value: 2}, 10)
+
+	assert.Equal(t, []int{2}, collect(w, far/2))
+	assert.Empty(t, collect(w, far-1))
+	assert.Equal(t, []int{1}, collect(w, far))
+}
+
+func TestWheel_FireCanModifyWheel(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](1, 0)
+	a := &wheel.Timer[int]{Value: 1}
+	b := &wheel.Timer[int]{Value: 2}
+	c := &wheel.Timer[int]{Value: 3}
+
+	w.Schedule(a, 10)
+	w.Schedule(b, 10)
+	w.Schedule(c, 10)
+
+	var fired []int
+
+	w.Advance(10, func(v int) {
+		fired = append(fired, v)
+
+		if v == 1 {
+			w.Cancel(b)
+			w.Schedule(c, 20)
+		}
+	})
+
+	require.Equal(t, []int{1}, fired)
+	assert.Equal(t, []int{3}, collect(w, 20))
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestWheel_IdleAdvance(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](1, 0)
+
+	assert.Empty(t, collect(w, 1<<40))
+
+	timer := &wheel.Timer[int]{Value: 1}
+	w.Schedule(timer, 1<<40+1)
+
+	assert.Equal(t, []int{1}, collect(w, 1<<40+1))
+}
+
+func TestWheel_NonPositiveInputs(t *testing.T) {
+	t.Parallel()
+
+	w := wheel.New[int](0, -5)
+	timer := &wheel.Timer[int]{Value: 1}
+
+	w.Schedule(timer, -10)
+
+	assert.Equal(t, []int{1}, collect(w, 1))
+}
@@ -0,0 +1,644 @@
+// Package lfu provides a thread-safe Least Frequently Used (LFU) cache implementation.
+//
+// # When to Use LFU
+//
+// Use LFU when how often a key is requested predicts its future use better than
+// how recently it was requested. This is ideal for:
+//   - Lookup tables with a stable set of popular keys
+//   - CDN and asset caches where a few objects serve most traffic
+//   - Workloads where a burst of new keys should not displace established ones
+//
+// # How LFU Works
+//
+// Every entry carries an access count. The cache keeps a list of frequency
+// buckets in ascending order, each holding the entries with that count from
+// most to least recently used. A Get moves an entry to the bucket for the next
+// count, and eviction takes the least recently used entry of the lowest bucket,
+// so ties between equally frequent entries are broken by recency.
+//
+// Pure LFU never forgets: an entry that was hot yesterday keeps its high count
+// and can pin the cache long after traffic has moved on. [NewWithDecay] halves
+// every count periodically so that old popularity fades.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1). With decay, every
+// count is halved in one O(n) pass, which is O(1) amortized when the decay
+// period is at least the capacity.
+//
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and a single Set may evict several entries to make
+// room, least frequently used first. Weight plays no part in choosing the
+// victim: a heavy entry that is used often outlives light ones that are not.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := lfu.New[string, int](1000)
+//	cache.Set("key", 42)  // Count 1
+//	cache.Get("key")      // Count 2, outlives keys that were only set
+package lfu
+
+import (
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+type node[K comparable, V any] struct {
+	key        K
+	value      V
+	weight     uint64
+	bucket     *bucket[K, V]
+	expiresAt  int64 // unix nanoseconds, 0 means no expiration
+	timer      wheel.Timer[*node[K, V]]
+	prev, next *node[K, V]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// bucket holds every entry with the same access count, most recently used
+// first, between two sentinel nodes.
+type bucket[K comparable, V any] struct {
+	count      uint64
+	head, tail *node[K, V]
+	prev, next *bucket[K, V]
+}
+
+func newBucket[K comparable, V any](count uint64) *bucket[K, V] {
+	b := &bucket[K, V]{count: count, head: &node[K, V]{}, tail: &node[K, V]{}}
+	b.head.next = b.tail
+	b.tail.prev = b.head
+
+	return b
+}
+
+func (b *bucket[K, V]) empty() bool {
+	return b.head.next == b.tail
+}
+
+// Cache implements a Least Frequently Used cache with LRU tie-breaking.
+//
+// Entries are grouped into buckets by access count. Eviction removes the least
+// recently used entry among those with the lowest count.
+//
+// The zero value is not usable; create instances with [New] or [NewWithDecay].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	items map[K]*node[K, V]
+
+	// first and last are sentinel buckets around the buckets in ascending
+	// count order; only non-empty buckets are linked between them.
+	first, last *bucket[K, V]
+
+	capacity   uint64
+	weight     uint64
+	weigher    func(K, V) uint64
+	decayEvery uint64
+	ops        uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new LFU cache with the given capacity and no decay.
+//
+// Access counts only ever grow, which suits workloads whose popular keys do
+// not change. Use [NewWithDecay] if they do. Options such as
+// [cache.WithDefaultTTL] are applied in order.
+//
+// Example:
+//
+//	cache := lfu.New[string, *Asset](10000)
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	return NewWithDecay(capacity, 0, opts...)
+}
+
+// NewWithDecay creates a new LFU cache that halves every access count after
+// each period of every Get and Set calls.
+//
+// Parameters:
+//   - capacity: maximum number of items the cache can hold, or their total
+//     weight when [cache.WithWeigher] is used
+//   - every: number of Get and Set calls between decays; 0 disables decay
+//
+// Halving keeps the relative order of counts while letting newer keys catch
+// up with keys that were popular in the past. Counts never drop below 1.
+// Entries whose counts become equal keep the more frequent one ahead in
+// recency, so it is evicted later. A period of a few times the capacity is a
+// good starting point.
+//
+// Example:
+//
+//	// Forget half of the popularity every 100k requests
+//	cache := lfu.NewWithDecay[string, *Asset](10000, 100000)
+func NewWithDecay[K comparable, V any](capacity, every uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	first, last := &bucket[K, V]{}, &bucket[K, V]{}
+	first.next = last
+	last.prev = first
+
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		first:      first,
+		last:       last,
+		capacity:   capacity,
+		weigher:    o.Weigher,
+		decayEvery: every,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - New keys: added with an access count of 1, after evicting the least
+//     recently used of the least frequently used entries if the cache is full
+//   - Existing keys: value updated in place and access count incremented, like
+//     a [Cache.Get] hit
+//   - Entries that outweigh the whole cache: not stored (see [cache.WithWeigher])
+//
+// The overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set("asset:1", data)      // Count 1
+//	cache.Set("asset:1", newData)   // Count 2
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("asset:1", data, 5*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.tick()
+
+	// Without a weigher this only rejects every entry of a zero-capacity cache.
+	weight := c.weigh(key, value)
+	if weight > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		c.weight = c.weight - n.weight + weight
+		n.value = value
+		n.weight = weight
+		n.expiresAt = expiresAt
+		c.schedule(n)
+		c.increment(n)
+		c.shrink(n)
+
+		return
+	}
+
+	c.stats.RecordSet()
+
+	n := &node[K, V]{key: key, value: value, weight: weight, expiresAt: expiresAt}
+	c.items[key] = n
+	c.weight += weight
+	c.schedule(n)
+
+	b := c.first.next
+	if b == c.last || b.count != 1 {
+		b = c.insertBucketAfter(c.first, 1)
+	}
+
+	c.pushFront(b, n)
+	c.shrink(n)
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// Get retrieves a value and increments its access count.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// The entry also becomes the most recently used among entries with its new
+// count. Use [Cache.Peek] to read without affecting eviction.
+//
+// Example:
+//
+//	if asset, ok := cache.Get("asset:1"); ok {
+//	    serve(asset)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.tick()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	c.increment(n)
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// Peek retrieves a value without incrementing its access count.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Peek does not count towards the decay period either.
+//
+// Example:
+//
+//	if data, ok := cache.Peek("asset:1"); ok {
+//	    // Item found, eviction order unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		return n.value, true
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted].
+//
+// Example:
+//
+//	cache.Delete("asset:1")
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the current number of items in the cache.
+//
+// Expired entries that have not been removed yet are still counted.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// Weight returns the total weight of the items in the cache.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+// It never exceeds the capacity.
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weight
+}
+
+// Clear removes every entry and restarts the decay period.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], most frequently used first.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for b := c.last.prev; b != c.first; b = c.last.prev {
+		for n := b.head.next; n != b.tail; n = b.head.next {
+			c.removeEntry(n, cache.ReasonCleared)
+		}
+	}
+
+	c.ops = 0
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+//
+// Access counts used for eviction are not affected.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the node for key, removing it first if it has expired.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// tick counts one Get or Set towards the decay period and halves every access
+// count when the period is over.
+// Must be called with lock held.
+func (c *Cache[K, V]) tick() {
+	if c.decayEvery == 0 {
+		return
+	}
+
+	c.ops++
+	if c.ops < c.decayEvery {
+		return
+	}
+
+	c.ops = 0
+
+	// Walk the buckets in ascending order. Halving keeps them in order, and
+	// buckets that end up with the same count are merged with the entries of
+	// the more frequent one in front.
+	for b := c.first.next; b != c.last; {
+		next := b.next
+		count := max(1, b.count/2)
+
+		if prev := b.prev; prev != c.first && prev.count == count {
+			for n := b.tail.prev; n != b.head; {
+				older := n.prev
+				c.pushFront(prev, n)
+				n = older
+			}
+
+			c.unlinkBucket(b)
+		} else {
+			b.count = count
+		}
+
+		b = next
+	}
+}
+
+// increment moves n to the bucket for its next access count.
+// Must be called with lock held.
+func (c *Cache[K, V]) increment(n *node[K, V]) {
+	b := n.bucket
+
+	next := b.next
+	if next == c.last || next.count != b.count+1 {
+		next = c.insertBucketAfter(b, b.count+1)
+	}
+
+	c.unlink(n)
+	c.pushFront(next, n)
+}
+
+// shrink evicts the least recently used of the least frequently used entries
+// until the cache fits its capacity. keep, the entry just written, is at the
+// front of its bucket, so it is only the least recently used one when it is
+// alone there, and the next bucket is evicted from instead.
+// Must be called with lock held.
+func (c *Cache[K, V]) shrink(keep *node[K, V]) {
+	for c.weight > c.capacity {
+		b := c.first.next
+		if b.tail.prev == keep {
+			b = b.next
+		}
+
+		c.removeEntry(b.tail.prev, cache.ReasonEvicted)
+	}
+}
+
+// removeEntry unlinks a node from its bucket, drops it from the index, cancels
+// its expiration and queues a removal notification.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.unlink(n)
+	delete(c.items, n.key)
+	c.weight -= n.weight
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
+
+// insertBucketAfter links a new, empty bucket with the given count after b.
+func (c *Cache[K, V]) insertBucketAfter(b *bucket[K, V], count uint64) *bucket[K, V] {
+	nb := newBucket[K, V](count)
+	nb.prev = b
+	nb.next = b.next
+	b.next.prev = nb
+	b.next = nb
+
+	return nb
+}
+
+// unlinkBucket removes a bucket from the bucket list.
+func (c *Cache[K, V]) unlinkBucket(b *bucket[K, V]) {
+	b.prev.next = b.next
+	b.next.prev = b.prev
+}
+
+// unlink removes a node from its bucket, dropping the bucket if it is now empty.
+func (c *Cache[K, V]) unlink(n *node[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+
+	if n.bucket.empty() {
+		c.unlinkBucket(n.bucket)
+	}
+}
+
+// pushFront makes n the most recently used node of bucket b.
+func (c *Cache[K, V]) pushFront(b *bucket[K, V], n *node[K, V]) {
+	n.bucket = b
+	n.next = b.head.next
+	n.prev = b.head
+	b.head.next.prev = n
+	b.head.next = n
+}
@@ -0,0 +1,511 @@
+package lfu_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/lfu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+func TestLFUCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := lfu.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLFUCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := lfu.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestLFUCache_EvictsLeastFrequent(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lfu.New[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	c.Get("a")
+	c.Get("a")
+	c.Get("c")
+
+	c.Set("d", 4) // "b" has the lowest count
+	c.Set("e", 5) // "d" now has the lowest count
+
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"d", 4, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, 3, c.Len())
+}
+
+func TestLFUCache_TiesBrokenByRecency(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lfu.New[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	c.Get("b")
+	c.Get("a") // "a" and "b" both at 2, "b" less recently
+
+	c.Set("d", 4) // "c" is alone at 1
+	c.Get("d")    // "d" joins the bucket at 2 as most recent
+	c.Set("e", 5) // all three at 2, "b" least recently used
+
+	assert.Equal(t, []removal{
+		{"c", 3, cache.ReasonEvicted},
+		{"b", 2, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestLFUCache_UpdateCountsAsAccess(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lfu.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("a", 10)
+	c.Set("c", 3)
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"b", 2, cache.ReasonEvicted},
+	}, log)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 10, v)
+}
+
+func TestLFUCache_PeekDoesNotCount(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lfu.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("b")
+	c.Peek("a")
+	c.Peek("a")
+	c.Set("c", 3)
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestLFUCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := lfu.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("b")
+
+	assert.True(t, c.Delete("a"))
+	assert.True(t, c.Delete("b"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 0, c.Len())
+
+	c.Set("c", 3)
+
+	v, ok := c.Get("c")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestLFUCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lfu.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestLFUCache_DecayHalvesCounts(t *testing.T) {
+	t.Parallel()
+
+	run := func(c *lfu.Cache[string, int]) {
+		c.Set("a", 1)
+		c.Set("b", 2)
+		c.Set("c", 3)
+		c.Get("a")
+		c.Get("a")
+		c.Get("a")
+		c.Get("b") // 7th call: a=4, b=2, c=1; with decay a=2, b=1, c=1
+
+		c.Set("d", 4)
+		c.Set("e", 5)
+	}
+
+	var plain, decayed []removal
+
+	run(lfu.New[string, int](3, record(&plain)))
+	run(lfu.NewWithDecay[string, int](3, 7, record(&decayed)))
+
+	assert.Equal(t, []removal{
+		{"c", 3, cache.ReasonEvicted},
+		{"d", 4, cache.ReasonEvicted}, // "b" is still ahead at 2
+	}, plain)
+	assert.Equal(t, []removal{
+		{"c", 3, cache.ReasonEvicted}, // merged behind "b", which was more frequent
+		{"b", 2, cache.ReasonEvicted}, // behind the newer "d" at 1
+	}, decayed)
+}
+
+func TestLFUCache_DecayLetsNewKeysReplaceOldFavorites(t *testing.T) {
+	t.Parallel()
+
+	run := func(c *lfu.Cache[string, int]) bool {
+		c.Set("yesterday", 0)
+
+		for range 50 {
+			c.Get("yesterday")
+		}
+
+		for i := range 100 {
+			key := fmt.Sprintf("today%d", i%4)
+			if _, ok := c.Get(key); !ok {
+				c.Set(key, i)
+			}
+		}
+
+		_, ok := c.Peek("yesterday")
+
+		return ok
+	}
+
+	assert.True(t, run(lfu.New[string, int](4)), "without decay the old favorite is pinned")
+	assert.False(t, run(lfu.NewWithDecay[string, int](4, 20)))
+}
+
+func TestLFUCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lfu.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLFUCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lfu.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestLFUCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := lfu.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestLFUCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := lfu.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	lfu.New[string, int](10).Close()
+}
+
+func TestLFUCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := lfu.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestLFUCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lfu.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"b", 2, cache.ReasonCleared},
+	}, log)
+
+	c.Set("c", 3)
+
+	v, ok := c.Get("c")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestLFUCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *lfu.Cache[string, int]
+
+	c = lfu.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestLFUCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lfu.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestLFUCache_WeightedEvictsUntilFits(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lfu.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 5)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+
+	c.Set("d", 4) // "b" and "c" are the least frequently used
+
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(9), c.Weight())
+}
+
+func TestLFUCache_WeightedUpdateKeepsEntry(t *testing.T) {
+	t.Parallel()
+
+	c := lfu.New[string, int](10, weighByValue())
+	c.Set("a", 4)
+	c.Set("b", 4)
+	c.Get("b")
+	c.Get("b")
+
+	// "a" is alone among the least frequently used, but growing it must
+	// evict "b" instead.
+	c.Set("a", 8)
+
+	v, ok := c.Peek("a")
+	require.True(t, ok)
+	assert.Equal(t, 8, v)
+
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(8), c.Weight())
+}
+
+func TestLFUCache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lfu.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 2)
+	c.Set("big", 11)
+	c.Set("a", 20)
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"big", 11, cache.ReasonEvicted},
+		{"a", 2, cache.ReasonReplaced},
+		{"a", 20, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestLFUCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := lfu.NewWithDecay[string, int](100, 1000)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
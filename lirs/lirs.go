@@ -0,0 +1,696 @@
+// Package lirs provides a thread-safe LIRS (Low Inter-reference Recency Set)
+// cache implementation.
+//
+// # When to Use LIRS
+//
+// Use LIRS when keys are reused at regular but long intervals, so that LRU
+// evicts each key shortly before it is needed again. This is ideal for:
+//   - Database buffer pools and page caches
+//   - Workloads that loop over a data set slightly larger than the cache
+//   - Mixes of frequently reused keys with scans of one-off keys
+//
+// # How LIRS Works
+//
+// LIRS ranks keys by their inter-reference recency (IRR): the number of other
+// keys used between their last two uses. Keys with a low IRR are LIR keys and
+// hold most of the capacity (99% by default); the rest holds HIR keys, which
+// are evicted first. The cache tracks them with two structures:
+//   - Stack S: keys in recency order, most recent on top. Its bottom is always
+//     the least recently used LIR key, so any key above it was used more
+//     recently than some LIR key
+//   - Queue Q: the resident HIR keys, in the order they are evicted
+//
+// A HIR key used again while it is still in S has a lower IRR than the LIR key
+// at the bottom of S: it becomes LIR, and that bottom key is demoted to HIR.
+// When a resident HIR key is evicted while in S, its key stays in S as a
+// non-resident HIR key, so setting it again soon goes straight to LIR. Up to
+// capacity non-resident keys are remembered.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1) amortized.
+//
+// # Weighted Capacity
+//
+// LIRS does not support [cache.WithWeigher], and [New] and [NewWithRatio]
+// panic if given one. A HIR key becomes LIR when its inter-reference recency,
+// the number of distinct keys used between its last two uses, beats that of
+// the LIR key at the bottom of stack S. That comparison says nothing about
+// whether keeping one large entry is worth more than keeping several small
+// ones. For scan-resistant caching of entries with very different sizes, use
+// [github.com/serroba/cache/tinylfu].
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+// Expired and deleted entries are not remembered as non-resident keys.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := lirs.New[string, int](1000)  // 990 LIR, 10 resident HIR
+//	cache.Set("key", 42)                   // LIR while the LIR set has room
+//	cache.Get("key")                       // Moves to the top of S
+package lirs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+// status is the LIRS classification of a key.
+type status uint8
+
+const (
+	lir         status = iota // resident, low inter-reference recency
+	hir                       // resident, high inter-reference recency, on Q
+	nonResident               // key only, kept in S and on the ghost list
+)
+
+// Each node carries two sets of links: one for stack S and one for either
+// queue Q or the ghost list, which never hold the same node.
+const (
+	stackLinks = iota
+	queueLinks
+)
+
+type links[K comparable, V any] struct {
+	prev, next *node[K, V]
+}
+
+type node[K comparable, V any] struct {
+	key       K
+	value     V // zero while the node is non-resident
+	status    status
+	inStack   bool
+	expiresAt int64 // unix nanoseconds, 0 means no expiration
+	timer     wheel.Timer[*node[K, V]]
+	links     [2]links[K, V] // indexed by stackLinks and queueLinks
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// list is a doubly linked list of nodes between two sentinels, using one of
+// the nodes' two sets of links. Its front holds the most recent node.
+type list[K comparable, V any] struct {
+	head, tail *node[K, V]
+	which      int // stackLinks or queueLinks
+	len        uint64
+}
+
+func newList[K comparable, V any](which int) list[K, V] {
+	head, tail := &node[K, V]{}, &node[K, V]{}
+	head.links[which].next = tail
+	tail.links[which].prev = head
+
+	return list[K, V]{head: head, tail: tail, which: which}
+}
+
+// back returns the oldest node, or nil if the list is empty.
+func (l *list[K, V]) back() *node[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+
+	return l.tail.links[l.which].prev
+}
+
+// pushFront adds a node to the front of the list.
+func (l *list[K, V]) pushFront(n *node[K, V]) {
+	first := l.head.links[l.which].next
+
+	n.links[l.which] = links[K, V]{prev: l.head, next: first}
+	first.links[l.which].prev = n
+	l.head.links[l.which].next = n
+	l.len++
+}
+
+// remove unlinks a node from the list.
+func (l *list[K, V]) remove(n *node[K, V]) {
+	ln := &n.links[l.which]
+	ln.prev.links[l.which].next = ln.next
+	ln.next.links[l.which].prev = ln.prev
+	*ln = links[K, V]{}
+	l.len--
+}
+
+// moveToFront relinks a node at the front of the list.
+func (l *list[K, V]) moveToFront(n *node[K, V]) {
+	l.remove(n)
+	l.pushFront(n)
+}
+
+// Cache implements the LIRS algorithm with stack S, queue Q and bounded
+// non-resident HIR history.
+//
+// LIR keys are evicted only after being demoted to HIR, which happens when a
+// HIR key shows a lower inter-reference recency, so keys reused at regular
+// intervals keep their place even when a loop or scan touches more keys than
+// the cache holds.
+//
+// The zero value is not usable; create instances with [New] or [NewWithRatio].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	items  map[K]*node[K, V] // resident and non-resident nodes
+	stack  list[K, V]        // S, most recent first
+	queue  list[K, V]        // Q, resident HIR nodes, most recent first
+	ghosts list[K, V]        // non-resident nodes, most recently evicted first
+
+	capacity uint64
+	lirCap   uint64
+	lirCount uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new LIRS cache with the given capacity, giving 1% of it to
+// resident HIR keys and the rest to LIR keys, as recommended by the LIRS paper.
+//
+// Use [NewWithRatio] if you need a different split. Options such as
+// [cache.WithDefaultTTL] are applied in order. New panics if the
+// options include [cache.WithWeigher].
+//
+// Example:
+//
+//	cache := lirs.New[int64, *Page](10000)  // 9900 LIR, 100 resident HIR
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	return NewWithRatio(capacity, 1, opts...)
+}
+
+// NewWithRatio creates a new LIRS cache with a custom share of capacity for
+// resident HIR keys.
+//
+// Parameters:
+//   - capacity: total number of items the cache can hold
+//   - hirPercent: share of capacity for resident HIR keys (0-100)
+//
+// A larger HIR share gives newly set keys more time to be used again before
+// eviction, at the expense of the LIR set. Resident HIR keys are guaranteed at
+// least 1 slot. NewWithRatio panics if the options include [cache.WithWeigher].
+//
+// Example:
+//
+//	// Keys are often reused shortly after their first use
+//	cache := lirs.NewWithRatio[string, int](1000, 10)
+func NewWithRatio[K comparable, V any](capacity uint64, hirPercent uint8, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+	if o.Weigher != nil {
+		panic("lirs: cache.WithWeigher is not supported")
+	}
+
+	if hirPercent > 100 {
+		hirPercent = 100
+	}
+
+	hirCap := min(capacity, max(1, capacity*uint64(hirPercent)/100))
+
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		stack:      newList[K, V](stackLinks),
+		queue:      newList[K, V](queueLinks),
+		ghosts:     newList[K, V](queueLinks),
+		capacity:   capacity,
+		lirCap:     capacity - hirCap,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - New keys: LIR while the LIR set has room, resident HIR afterwards
+//   - Non-resident HIR keys: become LIR, demoting the LIR key at the bottom of S
+//   - Existing keys: value updated in place and the key accessed as by [Cache.Get]
+//
+// When the cache is full, the resident HIR key at the front of Q is evicted.
+// The overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set(42, page)   // Resident HIR once the LIR set is full
+//	// ... 42 is evicted but stays in S as a non-resident key
+//	cache.Set(42, page)   // Becomes LIR
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL(42, page, 5*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if c.capacity == 0 {
+		c.stats.RecordSet()
+		c.removals.Push(key, value, cache.ReasonEvicted)
+		c.stats.RecordRemoval(cache.ReasonEvicted)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		n.value = value
+		n.expiresAt = expiresAt
+		c.schedule(n)
+		c.access(n)
+
+		return
+	}
+
+	c.stats.RecordSet()
+
+	// A non-resident key leaves the ghost list before room is made, so that
+	// the eviction cannot forget it first.
+	n, remembered := c.items[key]
+	if remembered {
+		c.ghosts.remove(n)
+	}
+
+	c.makeRoom()
+
+	if remembered {
+		n.value = value
+		n.expiresAt = expiresAt
+		c.stack.moveToFront(n)
+		c.promote(n)
+	} else {
+		n = &node[K, V]{key: key, value: value, expiresAt: expiresAt}
+		c.items[key] = n
+		c.stack.pushFront(n)
+		n.inStack = true
+
+		if c.lirCount < c.lirCap {
+			n.status = lir
+			c.lirCount++
+			c.prune()
+		} else {
+			n.status = hir
+			c.queue.pushFront(n)
+		}
+	}
+
+	c.schedule(n)
+}
+
+// Get retrieves a value from the cache.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist, has expired or is
+//     non-resident
+//
+// A hit moves the key to the top of S. A resident HIR key that was still in S
+// becomes LIR; one that was not is pushed onto S and moves to the end of Q.
+// Use [Cache.Peek] to read without affecting eviction.
+//
+// Example:
+//
+//	if page, ok := cache.Get(42); ok {
+//	    render(page)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	c.access(n)
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// Peek retrieves a value without affecting eviction.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist, has expired or is
+//     non-resident
+//
+// Unlike [Cache.Get], this never changes S, Q or a key's status.
+//
+// Example:
+//
+//	if page, ok := cache.Peek(42); ok {
+//	    // Item found, eviction order unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		return n.value, true
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache, whether it is LIR or HIR.
+//
+// Returns true if the key existed and was removed, false if the key was not found,
+// had already expired or was non-resident. The removed entry is reported to the
+// [cache.OnEvict] listener with [cache.ReasonDeleted] and is not remembered as
+// a non-resident key.
+//
+// Example:
+//
+//	cache.Delete(42)
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the number of LIR and resident HIR entries.
+//
+// Non-resident keys are not counted. Expired entries that have not been
+// removed yet are.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return int(c.lirCount + c.queue.len)
+}
+
+// Clear removes every entry and forgets all non-resident keys.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], resident HIR entries first, then LIR entries from the
+// top of S.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for n := c.queue.back(); n != nil; n = c.queue.back() {
+		c.removeEntry(n, cache.ReasonCleared)
+	}
+
+	for n := c.stack.head.links[stackLinks].next; n != c.stack.tail; n = n.links[stackLinks].next {
+		if n.status == lir {
+			c.removals.Push(n.key, n.value, cache.ReasonCleared)
+			c.stats.RecordRemoval(cache.ReasonCleared)
+
+			if c.wheel != nil {
+				c.wheel.Cancel(&n.timer)
+			}
+		}
+	}
+
+	clear(c.items)
+	c.stack = newList[K, V](stackLinks)
+	c.ghosts = newList[K, V](queueLinks)
+	c.lirCount = 0
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the resident node for key, removing it first if it has
+// expired. Non-resident nodes are not returned.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok || n.status == nonResident {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// access records a hit on a resident node.
+// Must be called with lock held.
+func (c *Cache[K, V]) access(n *node[K, V]) {
+	switch {
+	case n.status == lir:
+		c.stack.moveToFront(n)
+		c.prune()
+	case n.inStack:
+		// Used again before the bottom LIR key: a lower inter-reference recency.
+		c.queue.remove(n)
+		c.stack.moveToFront(n)
+		c.promote(n)
+	default:
+		c.stack.pushFront(n)
+		n.inStack = true
+		c.queue.moveToFront(n)
+	}
+}
+
+// promote turns a node at the top of S into a LIR node, demoting LIR nodes
+// from the bottom of S while the LIR set is over its share.
+// Must be called with lock held.
+func (c *Cache[K, V]) promote(n *node[K, V]) {
+	n.status = lir
+	c.lirCount++
+	c.prune()
+
+	for c.lirCount > c.lirCap {
+		bottom := c.stack.back()
+		bottom.status = hir
+		c.lirCount--
+		c.stack.remove(bottom)
+		bottom.inStack = false
+		c.queue.pushFront(bottom)
+		c.prune()
+	}
+}
+
+// prune removes HIR nodes from the bottom of S until a LIR node is there, so
+// that every node in S was used more recently than some LIR node.
+// Non-resident nodes leaving S are forgotten. Must be called with lock held.
+func (c *Cache[K, V]) prune() {
+	for n := c.stack.back(); n != nil && n.status != lir; n = c.stack.back() {
+		c.stack.remove(n)
+		n.inStack = false
+
+		if n.status == nonResident {
+			c.ghosts.remove(n)
+			delete(c.items, n.key)
+		}
+	}
+}
+
+// makeRoom evicts the resident HIR node at the front of Q if the cache is
+// full. If it is still in S it stays there as a non-resident node, and the
+// oldest non-resident node is forgotten once there are more than capacity.
+// Must be called with lock held.
+func (c *Cache[K, V]) makeRoom() {
+	if c.lirCount+c.queue.len < c.capacity {
+		return
+	}
+
+	n := c.queue.back()
+	c.queue.remove(n)
+	c.removals.Push(n.key, n.value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	if !n.inStack {
+		delete(c.items, n.key)
+
+		return
+	}
+
+	var zero V
+
+	n.value = zero
+	n.expiresAt = 0
+	n.status = nonResident
+	c.ghosts.pushFront(n)
+
+	if c.ghosts.len > c.capacity {
+		old := c.ghosts.back()
+		c.ghosts.remove(old)
+		c.stack.remove(old)
+		delete(c.items, old.key)
+	}
+}
+
+// removeEntry removes a resident node from S and Q, drops it from the index,
+// cancels its expiration and queues a removal notification.
+// Must be called with lock held.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	if n.status == lir {
+		c.lirCount--
+	} else {
+		c.queue.remove(n)
+	}
+
+	if n.inStack {
+		c.stack.remove(n)
+		n.inStack = false
+		c.prune()
+	}
+
+	delete(c.items, n.key)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
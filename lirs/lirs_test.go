@@ -0,0 +1,471 @@
+package lirs_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/lirs"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/slru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestLIRSCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := lirs.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLIRSCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := lirs.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestLIRSCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := lirs.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLIRSCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := lirs.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLIRSCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lirs.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestLIRSCache_NewWithRatioEdgeCases(t *testing.T) {
+	t.Parallel()
+
+	for _, hir := range []uint8{0, 50, 100, 255} {
+		for _, capacity := range []uint64{1, 2, 10} {
+			c := lirs.NewWithRatio[int, int](capacity, hir)
+
+			for i := range 100 {
+				c.Set(i%30, i)
+				c.Get(i % 7)
+			}
+
+			assert.LessOrEqual(t, c.Len(), int(capacity), "hir=%d capacity=%d", hir, capacity)
+		}
+	}
+}
+
+func TestLIRSCache_HIRKeysAreEvictedFirst(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lirs.New[string, int](4, record(&log)) // 3 LIR, 1 resident HIR
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3) // the LIR set is full
+	c.Set("d", 4)
+
+	for i := range 5 {
+		c.Set(fmt.Sprintf("scan%d", i), i)
+	}
+
+	assert.Equal(t, removal{"d", 4, cache.ReasonEvicted}, log[0])
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, ok := c.Peek(key)
+		assert.True(t, ok, "expected LIR key %q to survive", key)
+	}
+}
+
+func TestLIRSCache_HIRKeyInStackBecomesLIR(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lirs.New[string, int](4, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4)
+
+	c.Get("d") // used again while above "a" in S: "d" is LIR, "a" is demoted
+	c.Set("e", 5)
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestLIRSCache_NonResidentKeyBecomesLIR(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lirs.New[string, int](4, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4)
+	c.Set("e", 5) // "d" is evicted but stays in S
+
+	_, ok := c.Get("d")
+	assert.False(t, ok, "non-resident keys are misses")
+
+	c.Set("d", 40) // evicts "e", "d" is LIR and "a" is demoted
+	c.Set("f", 6)  // evicts "a"
+
+	assert.Equal(t, []removal{
+		{"d", 4, cache.ReasonEvicted},
+		{"e", 5, cache.ReasonEvicted},
+		{"a", 1, cache.ReasonEvicted},
+	}, log)
+
+	v, ok := c.Get("d")
+	require.True(t, ok)
+	assert.Equal(t, 40, v)
+}
+
+func TestLIRSCache_NonResidentKeysAreBounded(t *testing.T) {
+	t.Parallel()
+
+	// With 1 LIR and 1 resident HIR slot, up to 2 evicted keys are remembered.
+	evicted := func(again string) string {
+		var log []removal
+
+		c := lirs.New[string, int](2, record(&log))
+		c.Set("lir", 0)
+
+		for i := range 10 {
+			c.Set(fmt.Sprintf("k%d", i), i)
+		}
+
+		c.Set(again, 0)
+		c.Set("x", 0)
+
+		return log[len(log)-1].key
+	}
+
+	assert.Equal(t, "lir", evicted("k8"), "a remembered key is promoted, demoting the LIR key")
+	assert.Equal(t, "k0", evicted("k0"), "a forgotten key is a plain HIR insert")
+}
+
+func TestLIRSCache_LoopingAccess(t *testing.T) {
+	t.Parallel()
+
+	// Twelve keys are read in a loop through a cache of ten. LRU and SLRU
+	// evict each key just before it is needed again; LIRS keeps its LIR set
+	// and only churns the resident HIR slot.
+	run := func(c cache.Cache[int, int]) int {
+		hits := 0
+
+		for round := range 10 {
+			for k := range 12 {
+				_, ok := c.Get(k)
+				if !ok {
+					c.Set(k, k)
+				} else if round == 9 {
+					hits++
+				}
+			}
+		}
+
+		return hits
+	}
+
+	assert.Equal(t, 0, run(lru.New[int, int](10)))
+	assert.Equal(t, 0, run(slru.New[int, int](10)))
+	assert.Equal(t, 9, run(lirs.New[int, int](10)))
+}
+
+func TestLIRSCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lirs.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLIRSCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lirs.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestLIRSCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := lirs.New[string, int](4,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.SetWithTTL("e", 5, time.Second) // evicts "d": non-resident keys never expire
+	c.Set("e", 6)                     // clears the expiration of "e"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestLIRSCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := lirs.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	lirs.New[string, int](10).Close()
+}
+
+func TestLIRSCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := lirs.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestLIRSCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lirs.New[string, int](4, record(&log))
+
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		c.Set(key, i) // "d" ends up non-resident
+	}
+
+	log = nil
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{
+		{"e", 4, cache.ReasonCleared},
+		{"c", 2, cache.ReasonCleared},
+		{"b", 1, cache.ReasonCleared},
+		{"a", 0, cache.ReasonCleared},
+	}, log)
+
+	// "d" was forgotten along with the entries, so it comes back as HIR.
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4)
+	c.Set("e", 5)
+
+	assert.Equal(t, removal{"d", 4, cache.ReasonEvicted}, log[len(log)-1])
+}
+
+func TestLIRSCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *lirs.Cache[string, int]
+
+	c = lirs.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestLIRSCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lirs.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestLIRSCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := lirs.New[string, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
+
+func TestLIRSCache_WeigherPanics(t *testing.T) {
+	t.Parallel()
+
+	weigher := cache.WithWeigher(func(string, int) uint64 { return 1 })
+
+	assert.PanicsWithValue(t, "lirs: cache.WithWeigher is not supported", func() {
+		lirs.New[string, int](10, weigher)
+	})
+	assert.PanicsWithValue(t, "lirs: cache.WithWeigher is not supported", func() {
+		lirs.NewWithRatio[string, int](10, 1, weigher)
+	})
+}
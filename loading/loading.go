@@ -0,0 +1,259 @@
+// Package loading provides a read-through wrapper around any cache in this module.
+//
+// # When to Use Loading
+//
+// Use loading instead of hand-writing the cache-aside pattern. On a miss,
+// [Cache.GetOrLoad] calls a loader to fetch the value and stores the result.
+// Concurrent misses on the same key share a single load, so a burst of requests
+// for a cold key hits the backing store once instead of once per goroutine.
+//
+// # Errors and Cancellation
+//
+// Loader errors are returned to every caller waiting on that load and are not
+// cached; the next miss tries again. Each caller's context only bounds how long
+// that caller waits: if it is cancelled, GetOrLoad returns ctx.Err() right away,
+// while the load itself keeps running so its result can still be cached for
+// other callers. The loader receives a context that carries the first caller's
+// values but is never cancelled.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use.
+//
+// # Example Usage
+//
+//	users := loading.New[string, *User](lru.New[string, *User](10000))
+//
+//	user, err := users.GetOrLoad(ctx, id, func(ctx context.Context, id string) (*User, error) {
+//	    return db.GetUser(ctx, id)
+//	})
+package loading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/serroba/cache"
+)
+
+// ErrLoaderPanicked is returned (wrapped) when a loader panics.
+var ErrLoaderPanicked = errors.New("loading: loader panicked")
+
+// Loader fetches the value for key from the backing store.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// Stats reports how loads performed.
+type Stats struct {
+	// Loads is the number of loader calls that returned a value.
+	Loads uint64
+
+	// LoadErrors is the number of loader calls that returned an error or panicked.
+	LoadErrors uint64
+
+	// TotalLoadTime is the time spent in the loader across all calls.
+	TotalLoadTime time.Duration
+}
+
+// AverageLoadTime returns the mean duration of a loader call, or 0 if none ran.
+func (s Stats) AverageLoadTime() time.Duration {
+	calls := s.Loads + s.LoadErrors
+	if calls == 0 {
+		return 0
+	}
+
+	return s.TotalLoadTime / time.Duration(calls)
+}
+
+// call is a load in flight. value and err are written once before done is closed.
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+
+	// stale is set when the key is written or deleted while the load runs,
+	// so the loaded value does not overwrite newer data.
+	stale bool
+}
+
+// Cache wraps a [cache.Cache] with read-through loading.
+//
+// It implements [cache.Cache] itself by delegating to the wrapped cache, so it
+// can be used anywhere the plain cache was. Writes and deletes should go through
+// the wrapper so in-flight loads know not to overwrite them.
+//
+// The zero value is not usable; create instances with [New].
+type Cache[K comparable, V any] struct {
+	cache cache.Cache[K, V]
+
+	mu    sync.Mutex
+	calls map[K]*call[V]
+
+	loads      atomic.Uint64
+	loadErrors atomic.Uint64
+	loadTime   atomic.Int64
+}
+
+var _ cache.Cache[string, any] = (*Cache[string, any])(nil)
+
+// New wraps c with read-through loading.
+//
+// Any OnEvict listener registered on c must not call back into the returned
+// Cache, since stores made by a finished load happen under its lock.
+//
+// Example:
+//
+//	pages := loading.New[string, []byte](slru.New[string, []byte](5000))
+func New[K comparable, V any](c cache.Cache[K, V]) *Cache[K, V] {
+	return &Cache[K, V]{
+		cache: c,
+		calls: make(map[K]*call[V]),
+	}
+}
+
+// GetOrLoad returns the cached value for key, loading it on a miss.
+//
+// Behavior:
+//   - On a hit, the value is returned without calling loader
+//   - On a miss, loader is called once and its value stored in the cache
+//   - Concurrent misses for the same key wait for that single load
+//   - Loader errors are returned to every waiter and nothing is cached
+//   - If ctx is cancelled while waiting, ctx.Err() is returned immediately
+//
+// Example:
+//
+//	user, err := users.GetOrLoad(ctx, "user:42", func(ctx context.Context, key string) (*User, error) {
+//	    return db.GetUser(ctx, key)
+//	})
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[K, V]) (V, error) {
+	if v, ok := c.cache.Get(key); ok {
+		return v, nil
+	}
+
+	c.mu.Lock()
+
+	// A load may have finished between the miss above and taking the lock.
+	if v, ok := c.cache.Peek(key); ok {
+		c.mu.Unlock()
+
+		return v, nil
+	}
+
+	cl, ok := c.calls[key]
+	if !ok {
+		cl = &call[V]{done: make(chan struct{})}
+		c.calls[key] = cl
+
+		go c.load(context.WithoutCancel(ctx), key, loader, cl)
+	}
+
+	c.mu.Unlock()
+
+	select {
+	case <-cl.done:
+		return cl.value, cl.err
+	case <-ctx.Done():
+		var zero V
+
+		return zero, ctx.Err()
+	}
+}
+
+// LoadStats returns counters and timing for the loader calls made so far.
+//
+// Example:
+//
+//	s := users.LoadStats()
+//	fmt.Printf("%d loads, avg %s\n", s.Loads, s.AverageLoadTime())
+func (c *Cache[K, V]) LoadStats() Stats {
+	return Stats{
+		Loads:         c.loads.Load(),
+		LoadErrors:    c.loadErrors.Load(),
+		TotalLoadTime: time.Duration(c.loadTime.Load()),
+	}
+}
+
+// Set adds or updates a key-value pair in the wrapped cache.
+//
+// A load for key that is still in flight will not overwrite this value.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalidate(key)
+	c.cache.Set(key, value)
+}
+
+// Get retrieves a value from the wrapped cache without loading it.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	return c.cache.Get(key)
+}
+
+// Peek retrieves a value from the wrapped cache without affecting eviction order.
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	return c.cache.Peek(key)
+}
+
+// Delete removes a key from the wrapped cache.
+//
+// A load for key that is still in flight will not store its result.
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalidate(key)
+
+	return c.cache.Delete(key)
+}
+
+// Len returns the number of items in the wrapped cache.
+func (c *Cache[K, V]) Len() int {
+	return c.cache.Len()
+}
+
+// invalidate marks an in-flight load for key as stale. Must be called with lock held.
+func (c *Cache[K, V]) invalidate(key K) {
+	if cl, ok := c.calls[key]; ok {
+		cl.stale = true
+	}
+}
+
+// load runs loader, stores a successful result and wakes every waiter.
+func (c *Cache[K, V]) load(ctx context.Context, key K, loader Loader[K, V], cl *call[V]) {
+	start := time.Now()
+	value, err := safeLoad(ctx, key, loader)
+	c.loadTime.Add(int64(time.Since(start)))
+
+	if err != nil {
+		c.loadErrors.Add(1)
+	} else {
+		c.loads.Add(1)
+	}
+
+	c.mu.Lock()
+
+	delete(c.calls, key)
+
+	if err == nil && !cl.stale {
+		c.cache.Set(key, value)
+	}
+
+	c.mu.Unlock()
+
+	cl.value, cl.err = value, err
+	close(cl.done)
+}
+
+// safeLoad calls loader, converting a panic into an error wrapping [ErrLoaderPanicked].
+func safeLoad[K comparable, V any](ctx context.Context, key K, loader Loader[K, V]) (value V, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrLoaderPanicked, r)
+		}
+	}()
+
+	return loader(ctx, key)
+}
@@ -0,0 +1,238 @@
+package loading_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache/loading"
+	"github.com/serroba/cache/lru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errBackend = errors.New("backend unavailable")
+
+func TestLoadingCache_LoadsOnMiss(t *testing.T) {
+	t.Parallel()
+
+	c := loading.New[string, int](lru.New[string, int](10))
+
+	var calls atomic.Int64
+
+	loader := func(_ context.Context, key string) (int, error) {
+		calls.Add(1)
+
+		return len(key), nil
+	}
+
+	v, err := c.GetOrLoad(t.Context(), "hello", loader)
+	require.NoError(t, err)
+	assert.Equal(t, 5, v)
+
+	v, err = c.GetOrLoad(t.Context(), "hello", loader)
+	require.NoError(t, err)
+	assert.Equal(t, 5, v)
+
+	assert.Equal(t, int64(1), calls.Load(), "second call should be a cache hit")
+
+	cached, ok := c.Get("hello")
+	require.True(t, ok)
+	assert.Equal(t, 5, cached)
+}
+
+func TestLoadingCache_DeduplicatesConcurrentLoads(t *testing.T) {
+	t.Parallel()
+
+	c := loading.New[string, int](lru.New[string, int](10))
+
+	var calls atomic.Int64
+
+	release := make(chan struct{})
+	loader := func(_ context.Context, _ string) (int, error) {
+		calls.Add(1)
+		<-release
+
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+
+	results := make([]int, 50)
+
+	for i := range results {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			v, err := c.GetOrLoad(t.Context(), "key", loader)
+			assert.NoError(t, err)
+
+			results[i] = v
+		}()
+	}
+
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), calls.Load())
+
+	for _, v := range results {
+		assert.Equal(t, 42, v)
+	}
+}
+
+func TestLoadingCache_ErrorsAreNotCached(t *testing.T) {
+	t.Parallel()
+
+	c := loading.New[string, int](lru.New[string, int](10))
+
+	_, err := c.GetOrLoad(t.Context(), "key", func(context.Context, string) (int, error) {
+		return 0, errBackend
+	})
+	require.ErrorIs(t, err, errBackend)
+
+	_, ok := c.Peek("key")
+	assert.False(t, ok)
+
+	v, err := c.GetOrLoad(t.Context(), "key", func(context.Context, string) (int, error) {
+		return 7, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7, v)
+}
+
+func TestLoadingCache_ContextCancellation(t *testing.T) {
+	t.Parallel()
+
+	c := loading.New[string, int](lru.New[string, int](10))
+
+	release := make(chan struct{})
+	loader := func(ctx context.Context, _ string) (int, error) {
+		<-release
+
+		return 1, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := c.GetOrLoad(ctx, "key", loader)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The load keeps running and its result is cached for later callers.
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		_, ok := c.Peek("key")
+
+		return ok
+	}, time.Second, time.Millisecond)
+}
+
+func TestLoadingCache_LoaderPanic(t *testing.T) {
+	t.Parallel()
+
+	c := loading.New[string, int](lru.New[string, int](10))
+
+	_, err := c.GetOrLoad(t.Context(), "key", func(context.Context, string) (int, error) {
+		panic("boom")
+	})
+
+	require.ErrorIs(t, err, loading.ErrLoaderPanicked)
+	assert.Contains(t, err.Error(), "boom")
+	assert.Equal(t, uint64(1), c.LoadStats().LoadErrors)
+}
+
+func TestLoadingCache_WriteDuringLoadWins(t *testing.T) {
+	t.Parallel()
+
+	c := loading.New[string, int](lru.New[string, int](10))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, _ = c.GetOrLoad(t.Context(), "set", func(context.Context, string) (int, error) {
+			close(started)
+			<-release
+
+			return 1, nil
+		})
+	}()
+
+	<-started
+	c.Set("set", 2)
+	close(release)
+	<-done
+
+	v, ok := c.Get("set")
+	require.True(t, ok)
+	assert.Equal(t, 2, v, "a write during the load must not be overwritten")
+}
+
+func TestLoadingCache_DeleteDuringLoad(t *testing.T) {
+	t.Parallel()
+
+	c := loading.New[string, int](lru.New[string, int](10))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		v, err := c.GetOrLoad(t.Context(), "key", func(context.Context, string) (int, error) {
+			close(started)
+			<-release
+
+			return 1, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, v, "waiters still receive the loaded value")
+	}()
+
+	<-started
+	assert.False(t, c.Delete("key"))
+	close(release)
+	<-done
+
+	_, ok := c.Peek("key")
+	assert.False(t, ok, "a delete during the load must not be undone")
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLoadingCache_LoadStats(t *testing.T) {
+	t.Parallel()
+
+	c := loading.New[string, int](lru.New[string, int](10))
+
+	assert.Equal(t, time.Duration(0), c.LoadStats().AverageLoadTime())
+
+	_, err := c.GetOrLoad(t.Context(), "a", func(context.Context, string) (int, error) {
+		time.Sleep(2 * time.Millisecond)
+
+		return 1, nil
+	})
+	require.NoError(t, err)
+
+	_, err = c.GetOrLoad(t.Context(), "b", func(context.Context, string) (int, error) {
+		return 0, errBackend
+	})
+	require.Error(t, err)
+
+	s := c.LoadStats()
+	assert.Equal(t, uint64(1), s.Loads)
+	assert.Equal(t, uint64(1), s.LoadErrors)
+	assert.GreaterOrEqual(t, s.TotalLoadTime, 2*time.Millisecond)
+	assert.Equal(t, s.TotalLoadTime/2, s.AverageLoadTime())
+}
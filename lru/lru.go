@@ -16,6 +16,36 @@
 //
 // All operations (Get, Set, Delete, Peek, Len) are O(1).
 //
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and a single Set may evict several entries to make room.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// Counters are updated atomically, so reading them never contends with cache
+// operations.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Persistence
+//
+// [Cache.Snapshot] writes the entries together with the recency order to an
+// [io.Writer], and [Cache.Restore] loads them back, so a restarted process can
+// start warm. Keys and values are encoded with a [codec.Codec].
+//
 // # Example Usage
 //
 //	cache := lru.New[string, int](100)  // Cache up to 100 items
@@ -25,14 +55,36 @@
 //	}
 package lru
 
-import "sync"
+import (
+	"io"
+	"iter"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
+	"github.com/serroba/cache/internal/iterate"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/snapshot"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
 
 type node[K comparable, V any] struct {
 	key        K
 	value      V
+	weight     uint64
+	expiresAt  int64 // unix nanoseconds, 0 means no expiration
+	timer      wheel.Timer[*node[K, V]]
 	prev, next *node[K, V]
 }
 
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
 // Cache is a thread-safe LRU (Least Recently Used) cache.
 //
 // Items are evicted based on access recency: the least recently accessed item
@@ -44,14 +96,32 @@ type Cache[K comparable, V any] struct {
 	mu sync.Mutex
 
 	capacity   uint64
+	weight     uint64
 	items      map[K]*node[K, V]
 	head, tail *node[K, V]
+	weigher    func(K, V) uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
 }
 
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
 // New creates a new LRU cache with the specified maximum capacity.
 //
-// The capacity determines how many key-value pairs the cache can hold.
-// When this limit is exceeded, the least recently used item is automatically evicted.
+// The capacity determines how many key-value pairs the cache can hold, or their
+// total weight when [cache.WithWeigher] is used. When this limit is exceeded, the
+// least recently used items are automatically evicted.
+// Options such as [cache.WithDefaultTTL] are applied in order.
 //
 // Example:
 //
@@ -61,18 +131,31 @@ type Cache[K comparable, V any] struct {
 //	// Keys must be comparable (string, int, etc.)
 //	// Values can be any type
 //	cache := lru.New[int, []byte](500)
-func New[K comparable, V any](capacity uint64) *Cache[K, V] {
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
 	head := &node[K, V]{}
 	tail := &node[K, V]{}
 	head.next = tail
 	tail.prev = head
 
-	return &Cache[K, V]{
-		capacity: capacity,
-		items:    make(map[K]*node[K, V]),
-		head:     head,
-		tail:     tail,
+	c := &Cache[K, V]{
+		capacity:   capacity,
+		items:      make(map[K]*node[K, V]),
+		head:       head,
+		tail:       tail,
+		weigher:    o.Weigher,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
 	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
 }
 
 // Set adds or updates a key-value pair in the cache.
@@ -81,32 +164,226 @@ func New[K comparable, V any](capacity uint64) *Cache[K, V] {
 //   - If the key exists: updates the value and marks it as most recently used
 //   - If the key is new and cache is full: evicts the least recently used item first
 //   - If the key is new and cache has space: simply adds the item
+//   - If the entry outweighs the whole cache: it is not stored (see [cache.WithWeigher])
 //
-// The operation is atomic and thread-safe.
+// The operation is atomic and thread-safe. The overwritten value of an existing
+// key is reported to the [cache.OnEvict] listener with [cache.ReasonReplaced].
 //
 // Example:
 //
 //	cache.Set("session:abc", sessionData)  // Add new item
 //	cache.Set("session:abc", updatedData)  // Update existing, moves to front
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
 func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("token:abc", token, 15*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
+
+	weight := c.weigh(key, value)
+	if c.weigher != nil && weight > c.capacity {
+		c.reject(key, value)
 
-	if n, ok := c.items[key]; ok {
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+		c.weight = c.weight - n.weight + weight
 		n.value = value
-		c.items[key] = n
+		n.weight = weight
+		n.expiresAt = expiresAt
+		c.schedule(n)
 		c.moveToHead(n)
 	} else {
-		n := &node[K, V]{key: key, value: value}
+		n := &node[K, V]{key: key, value: value, weight: weight, expiresAt: expiresAt}
 		c.items[key] = n
+		c.weight += weight
+		c.schedule(n)
+		c.stats.RecordSet()
 		c.addNodeToHead(n)
+	}
 
-		if uint64(len(c.items)) > c.capacity {
-			lru := c.tail.prev
-			c.removeNode(lru)
-			delete(c.items, lru.key)
+	// The entry just written is at the head and fits on its own, so it is only
+	// evicted here by a zero-capacity cache without a weigher.
+	c.shrink()
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the node for key, removing it first if it has expired.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// removeEntry unlinks a node, drops it from the index, cancels its expiration
+// and queues a removal notification. Must be called with lock held.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.removeNode(n)
+	delete(c.items, n.key)
+	c.weight -= n.weight
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// collect copies the live entries from most to least recently used, or the
+// reverse when backward is set.
+func (c *Cache[K, V]) collect(backward bool) []iterate.Entry[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixNano()
+	entries := make([]iterate.Entry[K, V], 0, len(c.items))
+
+	n, end := c.head.next, c.tail
+	if backward {
+		n, end = c.tail.prev, c.head
+	}
+
+	for n != end {
+		if !n.expired(now) {
+			entries = append(entries, iterate.Entry[K, V]{Key: n.key, Value: n.value})
+		}
+
+		if backward {
+			n = n.prev
+		} else {
+			n = n.next
 		}
 	}
+
+	return entries
+}
+
+// shrink evicts least recently used items until the cache fits its capacity.
+// Must be called with lock held.
+func (c *Cache[K, V]) shrink() {
+	for c.weight > c.capacity {
+		c.removeEntry(c.tail.prev, cache.ReasonEvicted)
+	}
+}
+
+// removeAll removes every entry for reason, from most to least recently used.
+// Must be called with lock held.
+func (c *Cache[K, V]) removeAll(reason cache.RemovalReason) {
+	for n := c.head.next; n != c.tail; n = n.next {
+		c.removeEntry(n, reason)
+	}
+}
+
+// export copies the live entries for a snapshot, from most to least recently used.
+func (c *Cache[K, V]) export() []snapshot.Entry[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixNano()
+	entries := make([]snapshot.Entry[K, V], 0, len(c.items))
+
+	for n := c.head.next; n != c.tail; n = n.next {
+		if !n.expired(now) {
+			entries = append(entries, snapshot.Entry[K, V]{Key: n.key, Value: n.value, ExpiresAt: n.expiresAt})
+		}
+	}
+
+	return entries
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
 }
 
 func (c *Cache[K, V]) moveToHead(node *node[K, V]) {
@@ -130,7 +407,7 @@ func (c *Cache[K, V]) addNodeToHead(node *node[K, V]) {
 //
 // Returns:
 //   - (value, true) if the key exists
-//   - (zero value, false) if the key does not exist
+//   - (zero value, false) if the key does not exist or has expired
 //
 // Important: This method updates the item's recency, preventing it from being
 // evicted. Use [Cache.Peek] if you need to check a value without affecting
@@ -146,14 +423,17 @@ func (c *Cache[K, V]) addNodeToHead(node *node[K, V]) {
 //	}
 func (c *Cache[K, V]) Get(key K) (V, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if v, ok := c.items[key]; ok {
+	if v, ok := c.lookup(key); ok {
 		c.moveToHead(v)
+		c.stats.RecordHit()
 
 		return v.value, ok
 	}
 
+	c.stats.RecordMiss()
+
 	var v V
 
 	return v, false
@@ -163,7 +443,7 @@ func (c *Cache[K, V]) Get(key K) (V, bool) {
 //
 // Returns:
 //   - (value, true) if the key exists
-//   - (zero value, false) if the key does not exist
+//   - (zero value, false) if the key does not exist or has expired
 //
 // Unlike [Cache.Get], this does not affect the eviction order. Use Peek when you
 // need to check if a value exists or read it without preventing its eviction.
@@ -176,9 +456,9 @@ func (c *Cache[K, V]) Get(key K) (V, bool) {
 //	}
 func (c *Cache[K, V]) Peek(key K) (V, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if v, ok := c.items[key]; ok {
+	if v, ok := c.lookup(key); ok {
 		return v.value, ok
 	}
 
@@ -189,7 +469,8 @@ func (c *Cache[K, V]) Peek(key K) (V, bool) {
 
 // Delete removes a key from the cache.
 //
-// Returns true if the key existed and was removed, false if the key was not found.
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict] listener with [cache.ReasonDeleted].
 //
 // Example:
 //
@@ -198,11 +479,10 @@ func (c *Cache[K, V]) Peek(key K) (V, bool) {
 //	}
 func (c *Cache[K, V]) Delete(key K) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if n, ok := c.items[key]; ok {
-		c.removeNode(n)
-		delete(c.items, key)
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonDeleted)
 
 		return true
 	}
@@ -212,7 +492,8 @@ func (c *Cache[K, V]) Delete(key K) bool {
 
 // Len returns the current number of items in the cache.
 //
-// This value is always <= the capacity specified in [New].
+// Without a weigher, this value is always <= the capacity specified in [New].
+// Expired entries that have not been removed yet are still counted.
 //
 // Example:
 //
@@ -223,3 +504,189 @@ func (c *Cache[K, V]) Len() int {
 
 	return len(c.items)
 }
+
+// Weight returns the total weight of the items in the cache.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+// It never exceeds the capacity specified in [New], except in a zero-capacity
+// cache without a weigher.
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weight
+}
+
+// Resize changes the capacity of the cache.
+//
+// Shrinking evicts least recently used items until the cache fits, reporting
+// each to the [cache.OnEvict] listener with [cache.ReasonEvicted]. Growing
+// keeps every item in place. With [cache.WithWeigher], capacity is a weight.
+//
+// Example:
+//
+//	cache.Resize(cfg.CacheSize) // apply a config reload without a cold start
+func (c *Cache[K, V]) Resize(capacity uint64) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.capacity = capacity
+	c.shrink()
+}
+
+// Clear removes every entry from the cache.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], from most to least recently used.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.removeAll(cache.ReasonCleared)
+}
+
+// Snapshot writes the cache's entries to w, preserving their recency order.
+//
+// Keys and values are encoded with the given codecs into a versioned binary
+// format with a checksum, which [Cache.Restore] reads back. Expired entries are
+// skipped and TTLs are kept as absolute deadlines. Entries are copied under the
+// lock and encoded after it is released, so a slow writer does not block the cache.
+//
+// Example:
+//
+//	f, err := os.Create("users.snap")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//
+//	return cache.Snapshot(f, keyCodec, userCodec)
+func (c *Cache[K, V]) Snapshot(w io.Writer, keys codec.Codec[K], values codec.Codec[V]) error {
+	return snapshot.Write(w, snapshot.PolicyLRU, c.export(), keys, values)
+}
+
+// Restore replaces the cache's contents with a snapshot written by [Cache.Snapshot].
+//
+// The whole snapshot is read and verified before the cache is touched. A
+// corrupt, truncated or mismatched snapshot is rejected with a
+// [*cache.SnapshotError] and leaves the cache as it was.
+//
+// On success, existing entries are removed with [cache.ReasonCleared], entries
+// that expired since the snapshot was taken are dropped, and the rest come back
+// in their saved recency order. If they exceed the current capacity, the least
+// recently used are evicted as by [Cache.Resize].
+//
+// Example:
+//
+//	f, err := os.Open("users.snap")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//
+//	return cache.Restore(f, keyCodec, userCodec)
+func (c *Cache[K, V]) Restore(r io.Reader, keys codec.Codec[K], values codec.Codec[V]) error {
+	entries, err := snapshot.Read(r, snapshot.PolicyLRU, keys, values)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.removeAll(cache.ReasonCleared)
+
+	now := c.now().UnixNano()
+
+	// Entries are saved most recent first, so link them oldest first at the head.
+	for _, e := range slices.Backward(entries) {
+		n := &node[K, V]{key: e.Key, value: e.Value, expiresAt: e.ExpiresAt}
+		if n.expired(now) {
+			continue
+		}
+
+		n.weight = c.weigh(n.key, n.value)
+		c.items[n.key] = n
+		c.weight += n.weight
+		c.schedule(n)
+		c.addNodeToHead(n)
+	}
+
+	c.shrink()
+
+	return nil
+}
+
+// All returns an iterator over the cache's entries, from most to least recently used.
+//
+// The entries are copied under the lock when iteration starts and yielded after
+// it is released, so the loop body may call back into the cache; changes made
+// during iteration are not reflected. Expired entries are skipped. Iterating
+// does not affect recency.
+//
+// Example:
+//
+//	for key, user := range cache.All() {
+//	    fmt.Println(key, user.Name)
+//	}
+func (c *Cache[K, V]) All() iter.Seq2[K, V] {
+	return iterate.Seq(func() []iterate.Entry[K, V] { return c.collect(false) })
+}
+
+// Backward returns an iterator over the cache's entries, from least to most
+// recently used, which is the order they would be evicted in.
+//
+// It has the same snapshot semantics as [Cache.All].
+func (c *Cache[K, V]) Backward() iter.Seq2[K, V] {
+	return iterate.Seq(func() []iterate.Entry[K, V] { return c.collect(true) })
+}
+
+// Keys returns an iterator over the cache's keys, in the order of [Cache.All].
+func (c *Cache[K, V]) Keys() iter.Seq[K] {
+	return iterate.Keys(c.All())
+}
+
+// Values returns an iterator over the cache's values, in the order of [Cache.All].
+func (c *Cache[K, V]) Values() iter.Seq[V] {
+	return iterate.Values(c.All())
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+//
+// Example:
+//
+//	cache := lru.New[string, int](100, cache.WithJanitor[string, int](time.Second))
+//	defer cache.Close()
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
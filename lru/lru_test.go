@@ -1,10 +1,18 @@
 package lru_test
 
 import (
+	"bytes"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
 	"github.com/serroba/cache/lru"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -659,3 +667,587 @@ func TestLRUCache_ConcurrentLen(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestLRUCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	now = now.Add(time.Second)
+
+	_, ok = c.Get("a")
+	assert.False(t, ok, "expected 'a' to be expired")
+	assert.Equal(t, 1, c.Len(), "expired entry should be removed on access")
+
+	v, ok = c.Get("b")
+	require.True(t, ok, "entries without TTL never expire")
+	assert.Equal(t, 2, v)
+}
+
+func TestLRUCache_PeekExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(time.Minute + 1)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLRUCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lru.New[string, int](10,
+		cache.WithDefaultTTL[string, int](time.Minute),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, 0) // overrides the default: never expires
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok, "expected 'a' to expire after the default TTL")
+
+	_, ok = c.Get("b")
+	assert.True(t, ok, "expected 'b' to ignore the default TTL")
+}
+
+func TestLRUCache_UpdateRefreshesTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(30 * time.Second)
+	c.SetWithTTL("a", 2, time.Minute)
+
+	now = now.Add(45 * time.Second)
+
+	v, ok := c.Get("a")
+	require.True(t, ok, "expected update to reset the expiration")
+	assert.Equal(t, 2, v)
+
+	c.Set("a", 3) // no default TTL, so expiration is cleared
+
+	now = now.Add(time.Hour)
+
+	v, ok = c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestLRUCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := lru.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	for _, key := range []string{"b", "c", "d"} {
+		_, ok = c.Peek(key)
+		assert.True(t, ok, "expected %q to survive the janitor", key)
+	}
+}
+
+func TestLRUCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := lru.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close() // safe to call twice
+
+	// The cache stays usable after Close.
+	c.SetWithTTL("a", 1, time.Hour)
+	c.Delete("a")
+	c.Set("b", 2)
+
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+
+	// Close is a no-op without a janitor.
+	lru.New[string, int](10).Close()
+}
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestLRUCache_OnEvictCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lru.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	require.NotEmpty(t, log)
+	assert.Equal(t, removal{"a", 1, cache.ReasonEvicted}, log[0])
+}
+
+func TestLRUCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := lru.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestLRUCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lru.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.ElementsMatch(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"b", 2, cache.ReasonCleared},
+	}, log)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("c", 3)
+
+	v, ok := c.Get("c")
+	require.True(t, ok, "cache should be usable after Clear")
+	assert.Equal(t, 3, v)
+}
+
+func TestLRUCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *lru.Cache[string, int]
+
+	c = lru.New[string, int](2, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestLRUCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	s := c.Stats()
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, s)
+	assert.InDelta(t, 1.0/3, s.HitRatio(), 1e-9)
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestLRUCache_StatsEvictions(t *testing.T) {
+	t.Parallel()
+
+	c := lru.New[int, int](4)
+
+	for i := range 20 {
+		c.Set(i, i)
+	}
+
+	s := c.Stats()
+	assert.Equal(t, uint64(20), s.Sets)
+	assert.Equal(t, s.Sets-uint64(c.Len()), s.Evictions)
+}
+
+func TestLRUCache_ConcurrentStats(t *testing.T) {
+	t.Parallel()
+
+	c := lru.New[int, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 10 {
+		wg.Add(2)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 100 {
+				c.Set(id*100+j, j)
+				c.Get(j)
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				c.Stats()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, uint64(1000), c.Stats().Requests())
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+func TestLRUCache_WeightedEvictsUntilFits(t *testing.T) {
+	t.Parallel()
+
+	c := lru.New[string, int](10, weighByValue())
+	c.Set("a", 3)
+	c.Set("b", 3)
+	c.Set("c", 3)
+	assert.Equal(t, uint64(9), c.Weight())
+
+	// A heavy insert evicts as many LRU entries as it needs.
+	c.Set("d", 7)
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(10), c.Weight())
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	_, ok = c.Peek("c")
+	assert.True(t, ok)
+}
+
+func TestLRUCache_WeightedUpdate(t *testing.T) {
+	t.Parallel()
+
+	c := lru.New[string, int](10, weighByValue())
+	c.Set("a", 4)
+	c.Set("b", 4)
+
+	c.Set("a", 8)
+
+	assert.Equal(t, uint64(8), c.Weight())
+
+	_, ok := c.Peek("b")
+	assert.False(t, ok, "growing a should evict b, not a itself")
+
+	c.Set("a", 1)
+	assert.Equal(t, uint64(1), c.Weight())
+}
+
+func TestLRUCache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lru.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 2)
+	c.Set("big", 11)
+
+	_, ok := c.Peek("big")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len(), "rejecting an entry must not evict others")
+
+	c.Set("a", 20)
+
+	_, ok = c.Peek("a")
+	assert.False(t, ok, "an oversized update drops the old value")
+	assert.Equal(t, uint64(0), c.Weight())
+
+	assert.Equal(t, []removal{
+		{"big", 11, cache.ReasonEvicted},
+		{"a", 2, cache.ReasonReplaced},
+		{"a", 20, cache.ReasonEvicted},
+	}, log)
+
+	s := c.Stats()
+	assert.Equal(t, uint64(2), s.Sets)
+	assert.Equal(t, uint64(1), s.Updates)
+	assert.Equal(t, uint64(2), s.Evictions)
+}
+
+func TestLRUCache_Resize(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lru.New[string, int](5, record(&log))
+
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		c.Set(key, i)
+	}
+
+	c.Get("a")
+
+	c.Resize(2)
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, []removal{
+		{"b", 1, cache.ReasonEvicted},
+		{"c", 2, cache.ReasonEvicted},
+		{"d", 3, cache.ReasonEvicted},
+	}, log)
+
+	c.Resize(4)
+	c.Set("f", 5)
+	c.Set("g", 6)
+
+	assert.Equal(t, 4, c.Len(), "growing should make room without evicting")
+	assert.Len(t, log, 3)
+
+	for _, key := range []string{"a", "e", "f", "g"} {
+		_, ok := c.Peek(key)
+		assert.True(t, ok, key)
+	}
+}
+
+func TestLRUCache_ResizeWeighted(t *testing.T) {
+	t.Parallel()
+
+	c := lru.New[string, int](10, weighByValue())
+	c.Set("a", 5)
+	c.Set("b", 3)
+	c.Set("c", 2)
+
+	c.Resize(6)
+
+	assert.Equal(t, uint64(5), c.Weight())
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestLRUCache_All(t *testing.T) {
+	t.Parallel()
+
+	c := lru.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 3}, maps.Collect(c.All()))
+	assert.Equal(t, []string{"a", "c", "b"}, slices.Collect(c.Keys()))
+	assert.Equal(t, []int{1, 3, 2}, slices.Collect(c.Values()))
+
+	var backward []string
+	for k := range c.Backward() {
+		backward = append(backward, k)
+	}
+
+	assert.Equal(t, []string{"b", "c", "a"}, backward)
+
+	// Iterating must not change recency: b is still evicted next.
+	c.Set("d", 4)
+	c.Resize(3)
+
+	_, ok := c.Peek("b")
+	assert.False(t, ok)
+}
+
+func TestLRUCache_AllSkipsExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	assert.Equal(t, []string{"b"}, slices.Collect(c.Keys()))
+}
+
+func TestLRUCache_AllCanReenter(t *testing.T) {
+	t.Parallel()
+
+	c := lru.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	for k := range c.Keys() {
+		c.Delete(k)
+	}
+
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLRUCache_SnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	clock := cache.WithTimeSource[string, int](func() time.Time { return now })
+
+	src := lru.New[string, int](10, clock)
+	src.Set("a", 1)
+	src.Set("b", 2)
+	src.SetWithTTL("c", 3, time.Minute)
+	src.SetWithTTL("gone", 4, time.Second)
+	src.Get("a")
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	now = now.Add(time.Second)
+
+	dst := lru.New[string, int](10, clock)
+	dst.Set("stale", 0)
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, []string{"a", "c", "b"}, slices.Collect(dst.Keys()), "recency order is preserved")
+
+	now = now.Add(time.Minute)
+
+	_, ok := dst.Get("c")
+	assert.False(t, ok, "restored entries keep their deadline")
+}
+
+func TestLRUCache_RestoreIntoSmallerCache(t *testing.T) {
+	t.Parallel()
+
+	src := lru.New[string, int](10)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		src.Set(key, i)
+	}
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	var log []removal
+
+	dst := lru.New[string, int](2, record(&log))
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, []string{"d", "c"}, slices.Collect(dst.Keys()))
+	assert.Equal(t, []removal{
+		{"a", 0, cache.ReasonEvicted},
+		{"b", 1, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestLRUCache_RestoreRejectsBadSnapshot(t *testing.T) {
+	t.Parallel()
+
+	src := lru.New[string, int](10)
+	src.Set("a", 1)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	corrupt := bytes.Clone(buf.Bytes())
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	dst := lru.New[string, int](10)
+	dst.Set("keep", 1)
+
+	err := dst.Restore(bytes.NewReader(corrupt), codec.String{}, codec.Varint[int]{})
+
+	var snapErr *cache.SnapshotError
+	require.ErrorAs(t, err, &snapErr)
+	require.ErrorIs(t, err, cache.ErrSnapshotChecksum)
+
+	err = dst.Restore(strings.NewReader("not a snapshot"), codec.String{}, codec.Varint[int]{})
+	require.ErrorIs(t, err, cache.ErrSnapshotFormat)
+
+	assert.Equal(t, []string{"keep"}, slices.Collect(dst.Keys()), "a rejected snapshot leaves the cache untouched")
+}
@@ -0,0 +1,697 @@
+// Package lruk provides a thread-safe LRU-K cache implementation.
+//
+// # When to Use LRU-K
+//
+// Use LRU-K when keys referenced once should never displace keys referenced
+// repeatedly, and when recent history matters more than lifetime popularity.
+// This is ideal for:
+//   - Database buffer pools facing table and index scans
+//   - Caches in front of services hit by crawlers or batch jobs
+//   - Workloads that LRU handles well except for the occasional scan
+//
+// # How LRU-K Works
+//
+// LRU considers only the last reference to each key. LRU-K remembers the
+// times of the last K references (K = 2 by default) and evicts the key whose
+// K-th most recent reference is oldest. Keys with fewer than K references
+// count as infinitely old, so they go first, least recently used first; a scan
+// of one-off keys therefore only evicts other one-off keys.
+//
+// Time is logical: it advances by one on every Get hit and every Set, so
+// "older" means "more references to the cache ago".
+//
+// Two refinements from the LRU-K paper are supported:
+//   - Retained history: an evicted key's reference times are kept (for up to
+//     capacity keys, or keys weighing up to capacity in total with a weigher),
+//     so a key set again soon after eviction resumes its history instead of
+//     starting over
+//   - Correlated reference period: a reference arriving within this period
+//     of the key's previous one is part of the same burst. It does not count
+//     as a new reference, and the key's history is shifted so that the burst
+//     counts as a single reference
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// Get and Set are O(log n): the keys are kept in a binary heap ordered by
+// their K-th most recent reference. Peek and Len are O(1), Delete is O(log n).
+//
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and a single Set may evict several entries to make
+// room, oldest K-th most recent reference first. Retained history is bounded
+// the same way: evicted keys are forgotten once their weights add up to more
+// than the capacity.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+// The history of expired and deleted entries is not retained.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := lruk.New[string, int](1000)  // LRU-2
+//	cache.Set("key", 42)                   // One reference: evicted first
+//	cache.Get("key")                       // Two references: outlives one-off keys
+package lruk
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+type node[K comparable, V any] struct {
+	key   K
+	value V // zero while only the history is retained
+
+	// hist holds the logical times of the last K uncorrelated references,
+	// most recent first, with 0 for references that never happened; last is
+	// the time of the most recent reference, correlated or not.
+	hist []uint64
+	last uint64
+
+	weight    uint64
+	index     int // position in the heap, -1 while only the history is retained
+	expiresAt int64
+	timer     wheel.Timer[*node[K, V]]
+
+	prev, next *node[K, V] // retained history list
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// nodeHeap orders resident nodes by their K-th most recent reference, oldest
+// first, breaking ties by their most recent uncorrelated reference.
+type nodeHeap[K comparable, V any] []*node[K, V]
+
+func (h nodeHeap[K, V]) Len() int { return len(h) }
+
+func (h nodeHeap[K, V]) Less(i, j int) bool {
+	a, b := h[i].hist, h[j].hist
+	if k := len(a) - 1; a[k] != b[k] {
+		return a[k] < b[k]
+	}
+
+	return a[0] < b[0]
+}
+
+func (h nodeHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *nodeHeap[K, V]) Push(x any) {
+	n, _ := x.(*node[K, V])
+	n.index = len(*h)
+	*h = append(*h, n)
+}
+
+func (h *nodeHeap[K, V]) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	n.index = -1
+	*h = old[:len(old)-1]
+
+	return n
+}
+
+// Cache implements the LRU-K algorithm with retained history and a correlated
+// reference period.
+//
+// Eviction removes the entry whose K-th most recent reference is oldest, so a
+// key needs K references within the recent past to outlive keys referenced
+// fewer times.
+//
+// The zero value is not usable; create instances with [New] or [NewWithK].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	items map[K]*node[K, V] // resident nodes and retained histories
+	heap  nodeHeap[K, V]
+
+	// retained lists the evicted keys whose history is kept between two
+	// sentinels, most recently evicted first.
+	retained       *node[K, V]
+	retainedTail   *node[K, V]
+	retainedWeight uint64
+
+	capacity         uint64
+	weight           uint64
+	weigher          func(K, V) uint64
+	k                int
+	correlatedPeriod uint64
+	clock            uint64 // logical time of the latest reference
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new LRU-2 cache with the given capacity and no correlated
+// reference period.
+//
+// Use [NewWithK] to choose K or to collapse bursts of references. Options such
+// as [cache.WithDefaultTTL] are applied in order.
+//
+// Example:
+//
+//	cache := lruk.New[int64, *Page](10000)
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	return NewWithK(capacity, 2, 0, opts...)
+}
+
+// NewWithK creates a new LRU-K cache.
+//
+// Parameters:
+//   - capacity: maximum number of items the cache can hold, or their total
+//     weight when [cache.WithWeigher] is used
+//   - k: number of references remembered per key; 1 is plain LRU and 0 is
+//     treated as 1
+//   - correlatedPeriod: number of references to the cache within which a
+//     key's references count as one; 0 treats every reference separately
+//
+// A larger k needs more evidence before a key is considered popular and adapts
+// more slowly when popularity shifts; 2 is the usual choice. A correlated
+// period stops a burst of requests for the same key, such as the reads of one
+// transaction, from making it look popular.
+//
+// Example:
+//
+//	// LRU-3; references to a key less than 50 requests apart are one burst
+//	cache := lruk.NewWithK[int64, *Page](10000, 3, 50)
+func NewWithK[K comparable, V any](
+	capacity uint64, k uint8, correlatedPeriod uint64, opts ...cache.Option[K, V],
+) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	head, tail := &node[K, V]{}, &node[K, V]{}
+	head.next = tail
+	tail.prev = head
+
+	c := &Cache[K, V]{
+		items:            make(map[K]*node[K, V]),
+		retained:         head,
+		retainedTail:     tail,
+		capacity:         capacity,
+		weigher:          o.Weigher,
+		k:                int(max(1, k)),
+		correlatedPeriod: correlatedPeriod,
+		defaultTTL:       o.DefaultTTL,
+		now:              o.Now,
+		removals:         removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - New keys: added with a single reference, after evicting the entry with
+//     the oldest K-th most recent reference if the cache is full
+//   - Keys with retained history: added the same way, but resume their history,
+//     the new reference recorded as if the key had stayed resident
+//   - Existing keys: value updated in place and a reference recorded, like a
+//     [Cache.Get] hit
+//   - Entries that outweigh the whole cache: not stored (see [cache.WithWeigher])
+//
+// The overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set(42, page)      // One reference
+//	cache.Set(42, newPage)   // Two references
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL(42, page, 5*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	// Without a weigher this only rejects every entry of a zero-capacity cache.
+	weight := c.weigh(key, value)
+	if weight > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		c.weight = c.weight - n.weight + weight
+		n.value = value
+		n.weight = weight
+		n.expiresAt = expiresAt
+		c.schedule(n)
+		c.reference(n)
+
+		for c.weight > c.capacity {
+			c.evict(n)
+		}
+
+		return
+	}
+
+	c.stats.RecordSet()
+
+	// A retained history leaves the list before room is made, so that the
+	// eviction cannot forget it first.
+	n, retained := c.items[key]
+	if retained {
+		c.unlinkRetained(n)
+	}
+
+	for c.weight+weight > c.capacity {
+		c.evict(nil)
+	}
+
+	c.clock++
+
+	if retained {
+		c.addToHistory(n)
+	} else {
+		n = &node[K, V]{key: key, hist: make([]uint64, c.k)}
+		n.hist[0] = c.clock
+		n.last = c.clock
+		c.items[key] = n
+	}
+
+	n.value = value
+	n.weight = weight
+	n.expiresAt = expiresAt
+	c.weight += weight
+	heap.Push(&c.heap, n)
+	c.schedule(n)
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// Get retrieves a value from the cache and records a reference to it.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist, has expired or only has
+//     retained history
+//
+// A reference within the correlated reference period of the key's previous
+// one is part of the same burst and does not move the key away from eviction.
+// Use [Cache.Peek] to read without recording a reference.
+//
+// Example:
+//
+//	if page, ok := cache.Get(42); ok {
+//	    render(page)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	c.reference(n)
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// Peek retrieves a value without recording a reference.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist, has expired or only has
+//     retained history
+//
+// Example:
+//
+//	if page, ok := cache.Peek(42); ok {
+//	    // Item found, eviction order unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		return n.value, true
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache.
+//
+// Returns true if the key existed and was removed, false if the key was not found,
+// had already expired or only had retained history. The removed entry is reported
+// to the [cache.OnEvict] listener with [cache.ReasonDeleted] and its history is
+// not retained.
+//
+// Example:
+//
+//	cache.Delete(42)
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the number of entries in the cache.
+//
+// Keys with only retained history are not counted. Expired entries that have
+// not been removed yet are.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.heap)
+}
+
+// Weight returns the total weight of the entries in the cache.
+//
+// Without [cache.WithWeigher] every entry weighs 1, so Weight equals
+// [Cache.Len]. Retained history does not count. It never exceeds the capacity.
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weight
+}
+
+// Clear removes every entry and forgets all retained history.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], in eviction order.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for len(c.heap) > 0 {
+		c.removeEntry(c.heap[0], cache.ReasonCleared)
+	}
+
+	clear(c.items)
+	c.retained.next = c.retainedTail
+	c.retainedTail.prev = c.retained
+	c.retainedWeight = 0
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the resident node for key, removing it first if it has
+// expired. Retained histories are not returned.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok || n.index < 0 {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// reference records a reference to a resident node at the next logical time.
+// Must be called with lock held.
+func (c *Cache[K, V]) reference(n *node[K, V]) {
+	c.clock++
+
+	if c.addToHistory(n) {
+		heap.Fix(&c.heap, n.index)
+	}
+}
+
+// addToHistory records a reference to a resident or retained node at the
+// current logical time, and reports whether its history changed.
+//
+// A reference outside the correlated period of the previous one is a new
+// uncorrelated reference. The gap between the previous burst's first and last
+// references is added to the older history first, so that the burst counts as
+// a single reference made at its end. Must be called with lock held.
+func (c *Cache[K, V]) addToHistory(n *node[K, V]) bool {
+	if c.clock-n.last <= c.correlatedPeriod {
+		n.last = c.clock
+
+		return false
+	}
+
+	burst := n.last - n.hist[0]
+
+	for i := len(n.hist) - 1; i > 0; i-- {
+		if n.hist[i-1] != 0 {
+			n.hist[i] = n.hist[i-1] + burst
+		}
+	}
+
+	n.hist[0] = c.clock
+	n.last = c.clock
+
+	return true
+}
+
+// evict removes the entry whose K-th most recent reference is oldest, other
+// than keep, and retains its history, forgetting the oldest retained
+// histories once they outweigh the capacity. Must be called with lock held.
+func (c *Cache[K, V]) evict(keep *node[K, V]) {
+	i := 0
+
+	// keep is at the root, so the next oldest is one of its children.
+	if c.heap[0] == keep {
+		i = 1
+		if len(c.heap) > 2 && c.heap.Less(2, 1) {
+			i = 2
+		}
+	}
+
+	n, _ := heap.Remove(&c.heap, i).(*node[K, V])
+	c.weight -= n.weight
+	c.removals.Push(n.key, n.value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	var zero V
+
+	n.value = zero
+	n.expiresAt = 0
+
+	n.prev = c.retained
+	n.next = c.retained.next
+	c.retained.next.prev = n
+	c.retained.next = n
+	c.retainedWeight += n.weight
+
+	for c.retainedWeight > c.capacity {
+		old := c.retainedTail.prev
+		c.unlinkRetained(old)
+		delete(c.items, old.key)
+	}
+}
+
+// unlinkRetained removes a node from the retained history list.
+func (c *Cache[K, V]) unlinkRetained(n *node[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	n.prev, n.next = nil, nil
+	c.retainedWeight -= n.weight
+}
+
+// removeEntry removes a resident node from the heap, drops it from the index,
+// cancels its expiration and queues a removal notification.
+// Must be called with lock held.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	heap.Remove(&c.heap, n.index)
+	delete(c.items, n.key)
+	c.weight -= n.weight
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
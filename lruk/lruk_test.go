@@ -0,0 +1,633 @@
+package lruk_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/lruk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+func TestLRUKCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := lruk.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLRUKCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := lruk.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestLRUKCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := lruk.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLRUKCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := lruk.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLRUKCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestLRUKCache_NewWithKEdgeCases(t *testing.T) {
+	t.Parallel()
+
+	for _, k := range []uint8{0, 1, 2, 5, 255} {
+		for _, period := range []uint64{0, 3, 1000} {
+			c := lruk.NewWithK[int, int](10, k, period)
+
+			for i := range 100 {
+				c.Set(i%30, i)
+				c.Get(i % 7)
+			}
+
+			assert.Equal(t, 10, c.Len(), "k=%d period=%d", k, period)
+		}
+	}
+}
+
+func TestLRUKCache_FewerThanKReferencesGoFirst(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.New[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Get("a")
+	c.Set("b", 2)
+	c.Get("b")
+	c.Set("c", 3) // a single reference, but the most recent one
+
+	c.Set("d", 4)
+	c.Set("e", 5)
+
+	assert.Equal(t, []removal{
+		{"c", 3, cache.ReasonEvicted},
+		{"d", 4, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestLRUKCache_EvictsOldestKthReference(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.New[string, int](2, record(&log))
+	c.Set("a", 1) // t=1
+	c.Set("b", 2) // t=2
+	c.Get("b")    // t=3
+	c.Get("a")    // t=4: "a" is most recently used, but its second reference is older
+
+	c.Set("c", 3)
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestLRUKCache_KOfOneIsLRU(t *testing.T) {
+	t.Parallel()
+
+	for _, k := range []uint8{0, 1} {
+		var log []removal
+
+		c := lruk.NewWithK[string, int](3, k, 0, record(&log))
+		c.Set("a", 1)
+		c.Set("b", 2)
+		c.Set("c", 3)
+		c.Get("a")
+
+		c.Set("d", 4)
+
+		assert.Equal(t, []removal{{"b", 2, cache.ReasonEvicted}}, log, "k=%d", k)
+	}
+}
+
+func TestLRUKCache_RetainedHistory(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Get("a")
+	c.Set("b", 2)
+	c.Set("c", 3) // evicts "b", keeping its history
+
+	_, ok := c.Get("b")
+	assert.False(t, ok, "retained history is not an entry")
+
+	c.Set("b", 20) // resumes its history: two references, evicts "c"
+	c.Set("d", 4)  // the second reference of "a" is older than that of "b"
+
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonEvicted},
+		{"a", 1, cache.ReasonEvicted},
+	}, log)
+
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, 20, v)
+}
+
+func TestLRUKCache_RetainedHistoryIsBounded(t *testing.T) {
+	t.Parallel()
+
+	// With a capacity of 2, the histories of the last 2 evicted keys are kept.
+	evicted := func(again string) string {
+		var log []removal
+
+		c := lruk.New[string, int](2, record(&log))
+		c.Set("x", 0)
+		c.Get("x")
+
+		for i := range 10 {
+			c.Set(fmt.Sprintf("k%d", i), i)
+		}
+
+		c.Set(again, 0)
+		c.Set("y", 0)
+
+		return log[len(log)-1].key
+	}
+
+	assert.Equal(t, "x", evicted("k8"), "a retained history outranks the older key")
+	assert.Equal(t, "k0", evicted("k0"), "a forgotten key starts over with one reference")
+}
+
+func TestLRUKCache_CorrelatedReferencesCollapse(t *testing.T) {
+	t.Parallel()
+
+	evicted := func(period uint64) []removal {
+		var log []removal
+
+		c := lruk.NewWithK[string, int](2, 2, period, record(&log))
+		c.Set("a", 1)
+		c.Get("a") // a burst: the same transaction reading "a" again
+		c.Get("a")
+		c.Set("b", 2)
+		c.Set("c", 3)
+
+		return log
+	}
+
+	assert.Equal(t, []removal{{"b", 2, cache.ReasonEvicted}}, evicted(0))
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, evicted(5),
+		"a burst within the correlated period is a single reference")
+}
+
+func TestLRUKCache_BurstShiftsHistory(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.NewWithK[string, int](3, 2, 2, record(&log))
+	c.Set("a", 1) // t=1
+	c.Set("b", 2) // t=2
+	c.Get("a")    // t=3, correlated
+	c.Get("a")    // t=4, correlated: the burst of "a" lasts from 1 to 4
+	c.Set("c", 3) // t=5
+	c.Get("b")    // t=6: "b" has references at 6 and 2
+	c.Get("a")    // t=7: "a" has references at 7 and 4, the burst counted at its end
+	c.Get("c")    // t=8: "c" has references at 8 and 5
+
+	c.Set("d", 4)
+
+	assert.Equal(t, []removal{{"b", 2, cache.ReasonEvicted}}, log)
+}
+
+func TestLRUKCache_RetainedHistoryShiftsLikeResident(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.NewWithK[string, int](3, 2, 2, record(&log))
+	c.Set("a", 1) // t=1
+	c.Get("a")    // t=2, correlated
+	c.Set("b", 2) // t=3
+	c.Get("a")    // t=4, correlated: the burst of "a" lasts from 1 to 4
+	c.Set("c", 3) // t=5
+	c.Set("d", 4) // t=6: "a" is evicted with its history retained
+	c.Get("b")    // t=7: "b" has references at 7 and 3
+	c.Set("a", 1) // t=8: "a" has references at 8 and 4, as if it had stayed; "c" is evicted
+	c.Get("d")    // t=9: "d" has references at 9 and 6
+
+	c.Set("e", 5)
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonEvicted},
+		{"b", 2, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestLRUKCache_ScanResistance(t *testing.T) {
+	t.Parallel()
+
+	lk := lruk.New[string, int](10)
+	lr := lru.New[string, int](10)
+
+	for _, c := range []cache.Cache[string, int]{lk, lr} {
+		for range 3 {
+			for i := range 5 {
+				key := fmt.Sprintf("hot%d", i)
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, i)
+				}
+			}
+		}
+
+		for i := range 100 {
+			c.Set(fmt.Sprintf("scan%d", i), i)
+		}
+	}
+
+	hits := func(c cache.Cache[string, int]) int {
+		n := 0
+
+		for i := range 5 {
+			if _, ok := c.Peek(fmt.Sprintf("hot%d", i)); ok {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	assert.Equal(t, 5, hits(lk))
+	assert.Equal(t, 0, hits(lr))
+}
+
+func TestLRUKCache_WeightedEvictsUntilFits(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 5)
+	c.Get("a")
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	c.Set("d", 4) // "b" and "c" have a single reference
+
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(9), c.Weight())
+}
+
+func TestLRUKCache_WeightedUpdateKeepsEntry(t *testing.T) {
+	t.Parallel()
+
+	c := lruk.New[string, int](10, weighByValue())
+	c.Set("a", 4)
+	c.Set("b", 4)
+	c.Get("b")
+
+	// "a" still has the oldest second reference, but growing it must evict
+	// "b" instead.
+	c.Set("a", 8)
+
+	v, ok := c.Peek("a")
+	require.True(t, ok)
+	assert.Equal(t, 8, v)
+
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(8), c.Weight())
+}
+
+func TestLRUKCache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 2)
+	c.Set("big", 11)
+	c.Set("a", 20)
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"big", 11, cache.ReasonEvicted},
+		{"a", 2, cache.ReasonReplaced},
+		{"a", 20, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestLRUKCache_WeightedRetainedHistoryIsBounded(t *testing.T) {
+	t.Parallel()
+
+	// Evicted keys weighing up to the capacity of 10 keep their history.
+	evicted := func(again string) string {
+		var log []removal
+
+		c := lruk.New[string, int](10, weighByValue(), record(&log))
+		c.Set("x", 5)
+		c.Get("x")
+
+		for _, key := range []string{"k1", "k2", "k3", "k4"} {
+			c.Set(key, 4) // each evicts the one before
+		}
+
+		c.Set(again, 4) // evicts "k4"
+		c.Set("y", 2)
+
+		return log[len(log)-1].key
+	}
+
+	assert.Equal(t, "x", evicted("k2"), "a retained history outranks the older key")
+	assert.Equal(t, "k1", evicted("k1"), "a forgotten key starts over with one reference")
+}
+
+func TestLRUKCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lruk.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLRUKCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lruk.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestLRUKCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := lruk.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestLRUKCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := lruk.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	lruk.New[string, int](10).Close()
+}
+
+func TestLRUKCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := lruk.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestLRUKCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := lruk.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Get("a")
+	c.Set("b", 2)
+	c.Set("c", 3) // evicts "b", keeping its history
+
+	log = nil
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{
+		{"c", 3, cache.ReasonCleared},
+		{"a", 1, cache.ReasonCleared},
+	}, log)
+
+	// The history of "b" was forgotten too, so it is the older of two keys
+	// with a single reference.
+	c.Set("b", 2)
+	c.Set("a", 1)
+	c.Set("c", 3)
+
+	assert.Equal(t, removal{"b", 2, cache.ReasonEvicted}, log[len(log)-1])
+}
+
+func TestLRUKCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *lruk.Cache[string, int]
+
+	c = lruk.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestLRUKCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := lruk.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestLRUKCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := lruk.New[string, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
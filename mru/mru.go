@@ -0,0 +1,496 @@
+// Package mru provides a thread-safe MRU (Most Recently Used) cache implementation.
+//
+// # When to Use MRU
+//
+// Use MRU when the entry just used is the one least likely to be needed again
+// soon. This is the opposite of LRU's assumption and is ideal for:
+//   - Cyclic scans over a data set larger than the cache
+//   - Repeated sequential passes, such as nested-loop joins or batch reprocessing
+//   - Benchmarking other policies against their worst case
+//
+// # How MRU Works
+//
+// Entries are kept in a recency list, most recently used at the head, exactly
+// like LRU. A hit or update moves the entry to the head, and when the cache is
+// full a new entry first evicts the entry at the head. On a loop over N keys
+// with a cache of C < N, LRU evicts every key just before it is needed again
+// and never hits, while MRU only ever evicts the key it just used and keeps
+// hitting on most of the others every pass.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1).
+//
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and a single Set may evict several entries to make room.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// Counters are updated atomically, so reading them never contends with cache
+// operations.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := mru.New[int, []byte](100)
+//	cache.Set(1, block)
+//	cache.Get(1)            // Moves to the head, next to be evicted
+package mru
+
+import (
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+type node[K comparable, V any] struct {
+	key        K
+	value      V
+	weight     uint64
+	expiresAt  int64 // unix nanoseconds, 0 means no expiration
+	timer      wheel.Timer[*node[K, V]]
+	prev, next *node[K, V]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// Cache is a thread-safe MRU (Most Recently Used) cache.
+//
+// Items are evicted based on access recency: the most recently accessed item
+// is removed when a new item needs room. Both Get and Set operations mark an
+// item as "recently used", making it the next to be evicted.
+//
+// The zero value is not usable; create instances with [New].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	capacity   uint64
+	weight     uint64
+	items      map[K]*node[K, V]
+	head, tail *node[K, V]
+	weigher    func(K, V) uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new MRU cache with the specified maximum capacity.
+//
+// The capacity determines how many key-value pairs the cache can hold, or their
+// total weight when [cache.WithWeigher] is used. When a new item does not fit,
+// the most recently used items are evicted to make room.
+// Options such as [cache.WithDefaultTTL] are applied in order.
+//
+// Example:
+//
+//	// Cache 1000 blocks of a table that is scanned over and over
+//	cache := mru.New[int64, []byte](1000)
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	head := &node[K, V]{}
+	tail := &node[K, V]{}
+	head.next = tail
+	tail.prev = head
+
+	c := &Cache[K, V]{
+		capacity:   capacity,
+		items:      make(map[K]*node[K, V]),
+		head:       head,
+		tail:       tail,
+		weigher:    o.Weigher,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - If the key exists: updates the value and marks it as most recently used
+//   - If the key is new and cache is full: evicts the most recently used item first
+//   - If the key is new and cache has space: simply adds the item
+//   - If the entry outweighs the whole cache: it is not stored (see [cache.WithWeigher])
+//
+// The item being written is never evicted to make room for itself. The
+// overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set(7, block)  // Add new item at the head
+//	cache.Set(8, block)  // Cache full: evicts 7, then adds 8 at the head
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL(7, block, time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	weight := c.weigh(key, value)
+	if weight > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	n, ok := c.lookup(key)
+	if ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		// Unlink the entry while making room so that it cannot evict itself.
+		c.removeNode(n)
+		c.weight -= n.weight
+		n.value = value
+	} else {
+		n = &node[K, V]{key: key, value: value}
+		c.items[key] = n
+		c.stats.RecordSet()
+	}
+
+	c.makeRoom(weight)
+
+	n.weight = weight
+	n.expiresAt = expiresAt
+	c.weight += weight
+	c.schedule(n)
+	c.addNodeToHead(n)
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// makeRoom evicts most recently used items until weight more fits within the
+// capacity. Must be called with lock held and with weight at most the capacity.
+func (c *Cache[K, V]) makeRoom(weight uint64) {
+	for c.weight+weight > c.capacity {
+		c.removeEntry(c.head.next, cache.ReasonEvicted)
+	}
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the node for key, removing it first if it has expired.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// removeEntry unlinks a node, drops it from the index, cancels its expiration
+// and queues a removal notification. Must be called with lock held.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.removeNode(n)
+	delete(c.items, n.key)
+	c.weight -= n.weight
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
+
+func (c *Cache[K, V]) moveToHead(node *node[K, V]) {
+	c.removeNode(node)
+	c.addNodeToHead(node)
+}
+
+func (c *Cache[K, V]) removeNode(node *node[K, V]) {
+	node.prev.next = node.next
+	node.next.prev = node.prev
+}
+
+func (c *Cache[K, V]) addNodeToHead(node *node[K, V]) {
+	node.next = c.head.next
+	node.prev = c.head
+	c.head.next.prev = node
+	c.head.next = node
+}
+
+// Get retrieves a value from the cache and marks it as recently used.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Important: This method makes the item the next to be evicted. Use
+// [Cache.Peek] if you need to check a value without affecting eviction order.
+//
+// Example:
+//
+//	if block, ok := cache.Get(7); ok {
+//	    // block found and is now the next eviction candidate
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if v, ok := c.lookup(key); ok {
+		c.moveToHead(v)
+		c.stats.RecordHit()
+
+		return v.value, ok
+	}
+
+	c.stats.RecordMiss()
+
+	var v V
+
+	return v, false
+}
+
+// Peek retrieves a value without marking it as recently used.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Unlike [Cache.Get], this does not affect the eviction order.
+//
+// Example:
+//
+//	if _, ok := cache.Peek(7); ok {
+//	    fmt.Println("block cached, eviction order unchanged")
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if v, ok := c.lookup(key); ok {
+		return v.value, ok
+	}
+
+	var v V
+
+	return v, false
+}
+
+// Delete removes a key from the cache.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict] listener with [cache.ReasonDeleted].
+//
+// Example:
+//
+//	cache.Delete(7)
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonDeleted)
+
+		return true
+	}
+
+	return false
+}
+
+// Len returns the current number of items in the cache.
+//
+// Without a weigher, this value is always <= the capacity specified in [New].
+// Expired entries that have not been removed yet are still counted.
+//
+// Example:
+//
+//	fmt.Printf("Cache contains %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// Weight returns the total weight of the items in the cache.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+// It never exceeds the capacity specified in [New].
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weight
+}
+
+// Clear removes every entry from the cache.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], from most to least recently used.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for n := c.head.next; n != c.tail; n = n.next {
+		c.removeEntry(n, cache.ReasonCleared)
+	}
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
@@ -0,0 +1,386 @@
+package mru_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/mru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestMRUCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := mru.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestMRUCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := mru.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestMRUCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := mru.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestMRUCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := mru.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestMRUCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := mru.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestMRUCache_EvictsMostRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := mru.New[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4) // evicts "c", the most recently set
+	c.Get("a")
+	c.Set("e", 5) // evicts "a", the most recently read
+	c.Peek("b")   // no effect
+	c.Set("f", 6)
+
+	assert.Equal(t, []removal{
+		{"c", 3, cache.ReasonEvicted},
+		{"a", 1, cache.ReasonEvicted},
+		{"e", 5, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, 3, c.Len())
+}
+
+func TestMRUCache_UpdateDoesNotEvictItself(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := mru.New[string, int](10,
+		record(&log),
+		cache.WithWeigher(func(_ string, v int) uint64 { return uint64(v) }),
+	)
+	c.Set("a", 3)
+	c.Set("b", 3)
+	c.Set("c", 3)
+	c.Set("b", 6) // "b" is the most recent, so "c" goes instead
+
+	assert.Equal(t, []removal{
+		{"b", 3, cache.ReasonReplaced},
+		{"c", 3, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, uint64(9), c.Weight())
+
+	c.Set("d", 2) // evicts "b", now the most recent
+	c.Set("e", 11)
+
+	assert.Equal(t, []removal{
+		{"b", 3, cache.ReasonReplaced},
+		{"c", 3, cache.ReasonEvicted},
+		{"b", 6, cache.ReasonEvicted},
+		{"e", 11, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, uint64(5), c.Weight())
+}
+
+func TestMRUCache_CyclicAccess(t *testing.T) {
+	t.Parallel()
+
+	// A loop over 12 keys thrashes a 10-entry LRU: every key is evicted just
+	// before it comes around again.
+	loop := func(c cache.Cache[int, int]) int {
+		hits := 0
+
+		for i := range 12 * 20 {
+			if _, ok := c.Get(i % 12); ok {
+				hits++
+			} else {
+				c.Set(i%12, i)
+			}
+		}
+
+		return hits
+	}
+
+	assert.Equal(t, 0, loop(lru.New[int, int](10)))
+	assert.Greater(t, loop(mru.New[int, int](10)), 12*20/2)
+}
+
+func TestMRUCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := mru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestMRUCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := mru.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestMRUCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := mru.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestMRUCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := mru.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	mru.New[string, int](10).Close()
+}
+
+func TestMRUCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := mru.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestMRUCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := mru.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"b", 2, cache.ReasonCleared},
+	}, log)
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestMRUCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *mru.Cache[string, int]
+
+	c = mru.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestMRUCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := mru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestMRUCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := mru.New[string, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
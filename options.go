@@ -0,0 +1,130 @@
+package cache
+
+import "time"
+
+// Option configures a cache at construction time.
+//
+// Options are shared by every implementation, so the same slice can be passed
+// to whichever constructor a service selects:
+//
+//	opts := []cache.Option[string, *Session]{
+//	    cache.WithDefaultTTL[string, *Session](30 * time.Minute),
+//	}
+//	sessions := lru.New[string, *Session](10000, opts...)
+type Option[K comparable, V any] func(*Options[K, V])
+
+// Options holds the settings collected from a list of [Option] values.
+//
+// Cache implementations build it with [NewOptions]; most callers never need to
+// touch it directly.
+type Options[K comparable, V any] struct {
+	// DefaultTTL is the time-to-live applied by Set. Zero means entries never expire.
+	DefaultTTL time.Duration
+
+	// Now is the time source used for expiration. It defaults to [time.Now].
+	Now func() time.Time
+
+	// JanitorInterval is how often the background janitor removes expired
+	// entries. Zero means no janitor runs and expiration is purely lazy.
+	JanitorInterval time.Duration
+
+	// OnEvict, if set, is called for every entry that leaves the cache.
+	OnEvict func(key K, value V, reason RemovalReason)
+
+	// Weigher, if set, returns the weight of an entry. Capacity then bounds the
+	// total weight of the cache rather than its number of entries.
+	Weigher func(key K, value V) uint64
+}
+
+// NewOptions applies opts on top of the defaults and returns the result.
+func NewOptions[K comparable, V any](opts ...Option[K, V]) Options[K, V] {
+	o := Options[K, V]{
+		Now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithDefaultTTL sets the time-to-live used by Set.
+//
+// Entries written with Set expire ttl after they were last written. A zero or
+// negative ttl disables expiration, which is the default. SetWithTTL always
+// overrides this value for the entry it writes.
+//
+// Example:
+//
+//	tokens := lru.New[string, string](1000, cache.WithDefaultTTL[string, string](time.Hour))
+func WithDefaultTTL[K comparable, V any](ttl time.Duration) Option[K, V] {
+	return func(o *Options[K, V]) {
+		o.DefaultTTL = ttl
+	}
+}
+
+// WithTimeSource replaces [time.Now] as the clock used for expiration.
+//
+// This is mainly useful in tests, where a fake clock makes expiration deterministic:
+//
+//	now := time.Unix(0, 0)
+//	c := lru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+//	c.SetWithTTL("k", 1, time.Second)
+//	now = now.Add(2 * time.Second) // "k" is now expired
+func WithTimeSource[K comparable, V any](now func() time.Time) Option[K, V] {
+	return func(o *Options[K, V]) {
+		if now != nil {
+			o.Now = now
+		}
+	}
+}
+
+// WithJanitor starts a background goroutine that removes expired entries every interval.
+//
+// Without a janitor, expired entries are only removed when Get or Peek touches
+// them, so they keep occupying capacity until then. The janitor schedules each
+// entry on a hierarchical timing wheel with interval-sized ticks, so a sweep only
+// visits entries that are actually due instead of scanning the whole cache.
+// Entries may outlive their deadline by up to one interval before the janitor
+// removes them, but Get and Peek never return them.
+//
+// A cache created with this option must be closed with its Close method to stop
+// the goroutine. A zero or negative interval disables the janitor.
+//
+// Example:
+//
+//	c := lru.New[string, *Session](10000,
+//	    cache.WithDefaultTTL[string, *Session](30*time.Minute),
+//	    cache.WithJanitor[string, *Session](time.Second),
+//	)
+//	defer c.Close()
+func WithJanitor[K comparable, V any](interval time.Duration) Option[K, V] {
+	return func(o *Options[K, V]) {
+		o.JanitorInterval = interval
+	}
+}
+
+// WithWeigher makes capacity a limit on total weight instead of entry count.
+//
+// weigher is called once each time an entry is written, and the cache evicts
+// entries until the sum of their weights fits within its capacity. A single
+// entry heavier than the whole capacity is never stored: it is reported to the
+// [OnEvict] listener with [ReasonEvicted] and any older value under the same
+// key is dropped. Without a weigher every entry weighs 1.
+//
+// weigher must be fast and must not call back into the cache.
+//
+// Example:
+//
+//	// Hold at most 64 MiB of response bodies
+//	bodies := lru.New[string, []byte](64<<20,
+//	    cache.WithWeigher(func(key string, body []byte) uint64 {
+//	        return uint64(len(key) + len(body))
+//	    }),
+//	)
+func WithWeigher[K comparable, V any](weigher func(key K, value V) uint64) Option[K, V] {
+	return func(o *Options[K, V]) {
+		o.Weigher = weigher
+	}
+}
@@ -0,0 +1,509 @@
+// Package random provides a thread-safe cache that evicts entries at random.
+//
+// # When to Use Random Eviction
+//
+// Use random eviction when no access pattern can be relied on, or as the
+// baseline other policies are measured against. This is ideal for:
+//   - Hit-ratio comparisons, where a policy should at least beat random
+//   - Workloads that defeat recency, such as loops slightly larger than the cache
+//   - Caches where bookkeeping on hits is not worth its cost
+//
+// # How Random Eviction Works
+//
+// Entries are kept in a dense slice, and the index maps each key to its entry,
+// which knows its position in the slice. When the cache is full, a new entry
+// first evicts an entry chosen uniformly at random; the last entry in the slice
+// is moved into the gap, so the slice never has holes. Hits only read: no order
+// is kept, so nothing has to be updated.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1).
+//
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and a single Set may evict several entries to make room.
+//
+// # Reproducibility
+//
+// [New] seeds its random source randomly. Use [NewWithSeed] to evict the same
+// entries on every run of the same sequence of operations, for example in
+// benchmarks and simulations.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// Counters are updated atomically, so reading them never contends with cache
+// operations.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := random.NewWithSeed[string, int](100, 42)
+//	cache.Set("key", 42)
+//	cache.Get("key")        // No effect on eviction
+package random
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+type node[K comparable, V any] struct {
+	key       K
+	value     V
+	weight    uint64
+	index     int   // position in the entries slice
+	expiresAt int64 // unix nanoseconds, 0 means no expiration
+	timer     wheel.Timer[*node[K, V]]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// Cache is a thread-safe cache with random eviction.
+//
+// When a new item needs room, an item chosen uniformly at random is evicted.
+// Get and Set never affect which item that will be.
+//
+// The zero value is not usable; create instances with [New] or [NewWithSeed].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	capacity uint64
+	weight   uint64
+	items    map[K]*node[K, V]
+	entries  []*node[K, V]
+	weigher  func(K, V) uint64
+	rand     *rand.Rand
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new random-eviction cache with the specified maximum capacity
+// and a randomly seeded source.
+//
+// The capacity determines how many key-value pairs the cache can hold, or their
+// total weight when [cache.WithWeigher] is used. When a new item does not fit,
+// random items are evicted to make room.
+// Options such as [cache.WithDefaultTTL] are applied in order.
+//
+// Example:
+//
+//	cache := random.New[string, *User](1000)
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	return NewWithSeed(capacity, rand.Uint64(), opts...)
+}
+
+// NewWithSeed creates a new random-eviction cache whose choice of victims is
+// determined by seed.
+//
+// Two caches created with the same seed and given the same sequence of
+// operations evict the same entries, which makes hit-ratio experiments
+// repeatable. Otherwise it behaves like [New].
+//
+// Example:
+//
+//	// Same evictions on every run of the benchmark
+//	cache := random.NewWithSeed[string, *User](1000, 1)
+func NewWithSeed[K comparable, V any](capacity, seed uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	c := &Cache[K, V]{
+		capacity:   capacity,
+		items:      make(map[K]*node[K, V]),
+		weigher:    o.Weigher,
+		rand:       rand.New(rand.NewPCG(seed, seed)),
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - If the key exists: updates the value in place
+//   - If the key is new and cache is full: evicts a random item first
+//   - If the key is new and cache has space: simply adds the item
+//   - If the entry outweighs the whole cache: it is not stored (see [cache.WithWeigher])
+//
+// The item being written is never evicted to make room for itself. The
+// overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set("user:123", user)
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("token:abc", token, 15*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	weight := c.weigh(key, value)
+	if weight > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	n, ok := c.lookup(key)
+	if ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		// Take the entry out of the slice while making room so that it cannot
+		// evict itself.
+		c.removeIndex(n)
+		c.weight -= n.weight
+		n.value = value
+	} else {
+		n = &node[K, V]{key: key, value: value}
+		c.items[key] = n
+		c.stats.RecordSet()
+	}
+
+	c.makeRoom(weight)
+
+	n.weight = weight
+	n.expiresAt = expiresAt
+	c.weight += weight
+	c.schedule(n)
+	c.addIndex(n)
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// makeRoom evicts random items until weight more fits within the capacity.
+// Must be called with lock held and with weight at most the capacity.
+func (c *Cache[K, V]) makeRoom(weight uint64) {
+	for c.weight+weight > c.capacity {
+		c.removeEntry(c.entries[c.rand.IntN(len(c.entries))], cache.ReasonEvicted)
+	}
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the node for key, removing it first if it has expired.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// removeEntry takes a node out of the slice, drops it from the index, cancels
+// its expiration and queues a removal notification.
+// Must be called with lock held.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.removeIndex(n)
+	delete(c.items, n.key)
+	c.weight -= n.weight
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
+
+// addIndex appends a node to the entries slice.
+func (c *Cache[K, V]) addIndex(n *node[K, V]) {
+	n.index = len(c.entries)
+	c.entries = append(c.entries, n)
+}
+
+// removeIndex takes a node out of the entries slice by moving the last entry
+// into its place.
+func (c *Cache[K, V]) removeIndex(n *node[K, V]) {
+	last := len(c.entries) - 1
+	moved := c.entries[last]
+	c.entries[n.index] = moved
+	moved.index = n.index
+	c.entries[last] = nil
+	c.entries = c.entries[:last]
+}
+
+// Get retrieves a value from the cache.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// A hit does not protect the item from eviction; it only counts towards
+// [Cache.Stats], which is what sets it apart from [Cache.Peek].
+//
+// Example:
+//
+//	if user, ok := cache.Get("user:123"); ok {
+//	    fmt.Println(user.Name)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		c.stats.RecordHit()
+
+		return n.value, ok
+	}
+
+	c.stats.RecordMiss()
+
+	var v V
+
+	return v, false
+}
+
+// Peek retrieves a value without counting a hit or miss.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Example:
+//
+//	if _, ok := cache.Peek("user:123"); ok {
+//	    fmt.Println("user cached")
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		return n.value, ok
+	}
+
+	var v V
+
+	return v, false
+}
+
+// Delete removes a key from the cache.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict] listener with [cache.ReasonDeleted].
+//
+// Example:
+//
+//	cache.Delete("session:expired")
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonDeleted)
+
+		return true
+	}
+
+	return false
+}
+
+// Len returns the current number of items in the cache.
+//
+// Without a weigher, this value is always <= the capacity specified in [New].
+// Expired entries that have not been removed yet are still counted.
+//
+// Example:
+//
+//	fmt.Printf("Cache contains %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// Weight returns the total weight of the items in the cache.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+// It never exceeds the capacity specified in [New].
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.weight
+}
+
+// Clear removes every entry from the cache.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], in no particular order.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for len(c.entries) > 0 {
+		c.removeEntry(c.entries[len(c.entries)-1], cache.ReasonCleared)
+	}
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
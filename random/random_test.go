@@ -0,0 +1,411 @@
+package random_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestRandomCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := random.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestRandomCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := random.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestRandomCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := random.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestRandomCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := random.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestRandomCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := random.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestRandomCache_EvictsOnlyWhenFull(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := random.New[string, int](10, record(&log))
+
+	for i := range 10 {
+		c.Set(fmt.Sprint(i), i)
+	}
+
+	assert.Empty(t, log)
+
+	c.Set("new", 10)
+
+	require.Len(t, log, 1)
+	assert.Equal(t, cache.ReasonEvicted, log[0].reason)
+	assert.NotEqual(t, "new", log[0].key)
+	assert.Equal(t, 10, c.Len())
+
+	_, ok := c.Peek(log[0].key)
+	assert.False(t, ok)
+}
+
+func TestRandomCache_SeedDeterminesEvictions(t *testing.T) {
+	t.Parallel()
+
+	run := func(seed uint64) []removal {
+		var log []removal
+
+		c := random.NewWithSeed[string, int](8, seed, record(&log))
+
+		for i := range 100 {
+			c.Set(fmt.Sprint(i%20), i)
+			c.Get(fmt.Sprint(i % 7))
+		}
+
+		return log
+	}
+
+	assert.Equal(t, run(1), run(1))
+	assert.NotEqual(t, run(1), run(2))
+}
+
+func TestRandomCache_EveryEntryCanBeEvicted(t *testing.T) {
+	t.Parallel()
+
+	evicted := make(map[string]bool)
+
+	c := random.NewWithSeed[string, int](10, 7, cache.OnEvict(func(key string, _ int, _ cache.RemovalReason) {
+		evicted[key] = true
+	}))
+
+	for i := range 10 {
+		c.Set(fmt.Sprint(i), i)
+	}
+
+	// Hits do not protect entries, so every original entry eventually goes
+	// however often it is read.
+	for i := range 1000 {
+		for j := range 10 {
+			c.Get(fmt.Sprint(j))
+		}
+
+		c.Set(fmt.Sprint("new", i), i)
+	}
+
+	for i := range 10 {
+		assert.True(t, evicted[fmt.Sprint(i)], "key %d never evicted", i)
+	}
+}
+
+func TestRandomCache_UpdateDoesNotEvictItself(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := random.NewWithSeed[string, int](10, 1,
+		record(&log),
+		cache.WithWeigher(func(_ string, v int) uint64 { return uint64(v) }),
+	)
+	c.Set("a", 3)
+	c.Set("b", 3)
+	c.Set("c", 3)
+	c.Set("b", 10) // must evict both others
+
+	assert.ElementsMatch(t, []removal{
+		{"b", 3, cache.ReasonReplaced},
+		{"a", 3, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, uint64(10), c.Weight())
+
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, 10, v)
+
+	c.Set("d", 11)
+	assert.Equal(t, removal{"d", 11, cache.ReasonEvicted}, log[len(log)-1])
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestRandomCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := random.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestRandomCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := random.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestRandomCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := random.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestRandomCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := random.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	random.New[string, int](10).Close()
+}
+
+func TestRandomCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := random.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestRandomCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := random.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Delete("a")
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.ElementsMatch(t, []removal{
+		{"a", 1, cache.ReasonDeleted},
+		{"b", 2, cache.ReasonCleared},
+		{"c", 3, cache.ReasonCleared},
+	}, log)
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestRandomCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *random.Cache[string, int]
+
+	c = random.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestRandomCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := random.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestRandomCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := random.New[string, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
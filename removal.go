@@ -0,0 +1,59 @@
+package cache
+
+// RemovalReason describes why an entry left the cache.
+type RemovalReason uint8
+
+const (
+	// ReasonEvicted means the entry was removed by the eviction policy to make room.
+	ReasonEvicted RemovalReason = iota + 1
+
+	// ReasonDeleted means the entry was removed by an explicit Delete.
+	ReasonDeleted
+
+	// ReasonReplaced means the entry's value was overwritten by Set.
+	ReasonReplaced
+
+	// ReasonExpired means the entry's time-to-live elapsed.
+	ReasonExpired
+
+	// ReasonCleared means the entry was removed by Clear.
+	ReasonCleared
+)
+
+// String returns the lower-case name of the reason.
+func (r RemovalReason) String() string {
+	switch r {
+	case ReasonEvicted:
+		return "evicted"
+	case ReasonDeleted:
+		return "deleted"
+	case ReasonReplaced:
+		return "replaced"
+	case ReasonExpired:
+		return "expired"
+	case ReasonCleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
+}
+
+// OnEvict registers a function that is called whenever an entry leaves the cache.
+//
+// The listener receives the removed key and value along with the reason for
+// removal. For [ReasonReplaced], value is the old value that was overwritten.
+// Listeners run on the goroutine that caused the removal (or the janitor
+// goroutine for background expiration) after the cache's lock is released, so
+// they may safely call back into the cache. A slow listener delays the
+// operation that triggered it.
+//
+// Example:
+//
+//	files := lru.New[string, *os.File](100, cache.OnEvict(func(name string, f *os.File, reason cache.RemovalReason) {
+//	    f.Close()
+//	}))
+func OnEvict[K comparable, V any](listener func(key K, value V, reason RemovalReason)) Option[K, V] {
+	return func(o *Options[K, V]) {
+		o.OnEvict = listener
+	}
+}
@@ -0,0 +1,959 @@
+// Package s3fifo provides a thread-safe S3-FIFO cache implementation.
+//
+// # When to Use S3-FIFO
+//
+// Use S3-FIFO for large, read-heavy caches whose traffic includes many keys
+// that are requested only once. S3-FIFO is ideal for:
+//   - CDN and object storage caches
+//   - Key-value caches in front of databases, where most keys are cold
+//   - Read-heavy workloads where LRU's reordering on every hit causes lock contention
+//
+// # How S3-FIFO Works
+//
+// The cache is made of three FIFO queues and a small frequency counter per
+// entry, capped at 3:
+//   - Small: every new key enters here (10% of capacity)
+//   - Main: keys that proved themselves, either by being requested while in
+//     Small or by returning soon after being evicted from it
+//   - Ghost: keys only, remembering the entries recently evicted from Small
+//
+// A hit only increments the entry's counter; entries never move on access.
+// When the cache is full and Small is over its share, the oldest Small entry
+// is moved to Main if it was requested while there, and evicted to Ghost
+// otherwise, so one-hit wonders leave quickly. Otherwise the oldest Main entry
+// is evicted if its counter is zero, or reinserted at the head of Main with its
+// counter decremented. Setting a key that Ghost still remembers inserts it
+// straight into Main. Ghost remembers about as many keys as the cache holds
+// entries.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. Get and Peek only take a read lock,
+// and a hit is a single atomic update of the entry's counter, so concurrent
+// reads scale instead of serializing on the cache's mutex.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1) amortized.
+//
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and a single Set may evict several entries to make room.
+// Small's share is then 10% of the total weight.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+// Expired and deleted entries are not remembered in Ghost.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// Counters are updated atomically, so reading them never contends with cache
+// operations.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Persistence
+//
+// [Cache.Snapshot] writes the entries together with their queue, order and
+// counters to an [io.Writer], and [Cache.Restore] loads them back, so a
+// restarted process can start warm. Ghost keys are not saved. Keys and values
+// are encoded with a [codec.Codec].
+//
+// # Example Usage
+//
+//	cache := s3fifo.New[string, int](1000)
+//	cache.Set("key", 42)    // Enters Small
+//	cache.Get("key")        // Counter 1: moves to Main instead of being evicted
+package s3fifo
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
+	"github.com/serroba/cache/internal/iterate"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/snapshot"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+// queue identifies which of the three FIFO queues a node is on.
+type queue uint8
+
+const (
+	small queue = iota
+	main
+	ghost
+)
+
+const (
+	// maxFreq caps the per-entry access counter.
+	maxFreq = 3
+
+	// smallPercent is Small's share of the capacity.
+	smallPercent = 10
+
+	// Snapshot flags: the counter in the low bits, then the queue.
+	flagFreq = 0b011
+	flagMain = 0b100
+)
+
+type node[K comparable, V any] struct {
+	key        K
+	value      V // zero while the node is a ghost
+	weight     uint64
+	freq       atomic.Uint32 // updated under the read lock by Get
+	queue      queue
+	expiresAt  int64 // unix nanoseconds, 0 means no expiration
+	timer      wheel.Timer[*node[K, V]]
+	prev, next *node[K, V]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// touch counts an access, saturating at maxFreq. Racing touches may lose an
+// increment, which only makes a counter that is already approximate lower.
+func (n *node[K, V]) touch() {
+	if f := n.freq.Load(); f < maxFreq {
+		n.freq.CompareAndSwap(f, f+1)
+	}
+}
+
+// list is a doubly linked list of nodes between two sentinels, newest first.
+type list[K comparable, V any] struct {
+	head, tail *node[K, V]
+	len        uint64
+	weight     uint64
+}
+
+func newList[K comparable, V any]() list[K, V] {
+	head, tail := &node[K, V]{}, &node[K, V]{}
+	head.next = tail
+	tail.prev = head
+
+	return list[K, V]{head: head, tail: tail}
+}
+
+// Cache implements the S3-FIFO algorithm with Small, Main and Ghost queues.
+//
+// New keys enter Small. Keys requested while in Small, or set again while
+// Ghost remembers them, move to Main, where entries with a non-zero counter
+// are given another round instead of being evicted. Hits never reorder entries.
+//
+// The zero value is not usable; create instances with [New].
+type Cache[K comparable, V any] struct {
+	mu sync.RWMutex
+
+	items  map[K]*node[K, V] // resident and ghost nodes
+	queues [3]list[K, V]     // indexed by queue
+
+	capacity uint64
+	smallCap uint64
+	weigher  func(K, V) uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new S3-FIFO cache with the specified maximum capacity.
+//
+// The capacity determines how many key-value pairs the cache can hold, or their
+// total weight when [cache.WithWeigher] is used. Small gets 10% of it, and
+// at least 1. Options such as [cache.WithDefaultTTL] are applied in order.
+//
+// Example:
+//
+//	cache := s3fifo.New[string, *Object](100000)  // 10000 Small, 90000 Main
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		queues:     [3]list[K, V]{newList[K, V](), newList[K, V](), newList[K, V]()},
+		weigher:    o.Weigher,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	c.setCapacity(capacity)
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - New keys: added to Small
+//   - Keys remembered in Ghost: added to Main
+//   - Existing keys: value updated in place, counted as an access
+//   - If the entry outweighs the whole cache: it is not stored
+//
+// When the cache is full, entries are moved and evicted as described in the
+// package documentation. The overwritten value of an existing key is reported
+// to the [cache.OnEvict] listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set("object:1", obj)
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("object:1", obj, time.Hour)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	weight := c.weigh(key, value)
+	if weight > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		l := &c.queues[n.queue]
+		l.weight = l.weight - n.weight + weight
+		n.value = value
+		n.weight = weight
+		n.expiresAt = expiresAt
+		n.touch()
+		c.schedule(n)
+		c.evict(n)
+
+		return
+	}
+
+	c.stats.RecordSet()
+
+	q := small
+	if g, remembered := c.items[key]; remembered {
+		c.forget(g)
+
+		q = main
+	}
+
+	n := &node[K, V]{key: key, value: value, weight: weight, expiresAt: expiresAt}
+	c.items[key] = n
+	c.pushFront(n, q)
+	c.schedule(n)
+	c.evict(n)
+}
+
+// Get retrieves a value from the cache.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// A hit increments the entry's counter, up to 3, without moving it, and only
+// takes a read lock. A key remembered only in Ghost is a miss. Use
+// [Cache.Peek] to read without counting an access.
+//
+// Example:
+//
+//	if obj, ok := cache.Get("object:1"); ok {
+//	    serve(obj)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+
+	n, ok := c.items[key]
+
+	resident := ok && n.queue != ghost
+	if resident && !n.expired(c.now().UnixNano()) {
+		n.touch()
+
+		value := n.value
+		c.mu.RUnlock()
+		c.stats.RecordHit()
+
+		return value, true
+	}
+
+	c.mu.RUnlock()
+
+	if resident {
+		// Expired: take the write lock to remove it, unless it was refreshed
+		// in the meantime.
+		return c.getLocked(key)
+	}
+
+	c.stats.RecordMiss()
+
+	var zero V
+
+	return zero, false
+}
+
+// Peek retrieves a value without counting an access.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Unlike [Cache.Get], this does not protect the entry from eviction and is
+// not counted in [Cache.Stats].
+//
+// Example:
+//
+//	if obj, ok := cache.Peek("object:1"); ok {
+//	    // Item found, counter unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.RLock()
+
+	n, ok := c.items[key]
+
+	resident := ok && n.queue != ghost
+	if resident && !n.expired(c.now().UnixNano()) {
+		value := n.value
+		c.mu.RUnlock()
+
+		return value, true
+	}
+
+	c.mu.RUnlock()
+
+	if resident {
+		c.mu.Lock()
+		defer c.unlock()
+
+		if n, ok := c.lookup(key); ok {
+			return n.value, true
+		}
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache, regardless of which queue it's in.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted] and is not remembered in Ghost.
+//
+// Example:
+//
+//	cache.Delete("object:1")
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the number of entries in Small and Main.
+//
+// Ghost keys are not counted. Expired entries that have not been removed yet
+// are.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return int(c.queues[small].len + c.queues[main].len)
+}
+
+// Weight returns the total weight of the items in Small and Main.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.weight()
+}
+
+// Resize changes the capacity of the cache, keeping Small at 10% of it.
+//
+// Shrinking evicts entries as a full cache would on insert, reporting each to
+// the [cache.OnEvict] listener with [cache.ReasonEvicted]. Growing keeps every
+// item in place. With [cache.WithWeigher], capacity is a weight.
+//
+// Example:
+//
+//	cache.Resize(cfg.CacheSize)
+func (c *Cache[K, V]) Resize(capacity uint64) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.setCapacity(capacity)
+	c.evict(nil)
+}
+
+// Clear removes every entry and forgets all ghost keys.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], in the order of [Cache.All].
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.removeAll(cache.ReasonCleared)
+}
+
+// Snapshot writes the cache's entries to w, preserving each entry's queue,
+// its position within the queue and its counter.
+//
+// Keys and values are encoded with the given codecs into a versioned binary
+// format with a checksum, which [Cache.Restore] reads back. Expired entries are
+// skipped, ghost keys are not saved and TTLs are kept as absolute deadlines.
+// Entries are copied under the lock and encoded after it is released, so a
+// slow writer does not block the cache.
+//
+// Example:
+//
+//	var buf bytes.Buffer
+//	if err := cache.Snapshot(&buf, keyCodec, objectCodec); err != nil {
+//	    return err
+//	}
+func (c *Cache[K, V]) Snapshot(w io.Writer, keys codec.Codec[K], values codec.Codec[V]) error {
+	return snapshot.Write(w, snapshot.PolicyS3FIFO, c.export(), keys, values)
+}
+
+// Restore replaces the cache's contents with a snapshot written by [Cache.Snapshot].
+//
+// The whole snapshot is read and verified before the cache is touched. A
+// corrupt, truncated or mismatched snapshot is rejected with a
+// [*cache.SnapshotError] and leaves the cache as it was.
+//
+// On success, existing entries are removed with [cache.ReasonCleared], ghost
+// keys are forgotten, entries that expired since the snapshot was taken are
+// dropped, and the rest return to the queue they were saved from, in their
+// saved order and with their counters. If they exceed the current capacity,
+// entries are evicted as by [Cache.Resize].
+//
+// Example:
+//
+//	if err := cache.Restore(&buf, keyCodec, objectCodec); err != nil {
+//	    log.Printf("starting cold: %v", err)
+//	}
+func (c *Cache[K, V]) Restore(r io.Reader, keys codec.Codec[K], values codec.Codec[V]) error {
+	entries, err := snapshot.Read(r, snapshot.PolicyS3FIFO, keys, values)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.Flags&^(flagFreq|flagMain) != 0 {
+			return &cache.SnapshotError{Kind: cache.ErrSnapshotFormat, Err: fmt.Errorf("unknown flags %#x", e.Flags)}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.removeAll(cache.ReasonCleared)
+
+	now := c.now().UnixNano()
+
+	// Entries are saved newest first, so link them oldest first at the heads.
+	for _, e := range slices.Backward(entries) {
+		n := &node[K, V]{key: e.Key, value: e.Value, expiresAt: e.ExpiresAt}
+		if n.expired(now) {
+			continue
+		}
+
+		q := small
+		if e.Flags&flagMain != 0 {
+			q = main
+		}
+
+		n.weight = c.weigh(n.key, n.value)
+		n.freq.Store(uint32(e.Flags & flagFreq))
+		c.items[n.key] = n
+		c.pushFront(n, q)
+		c.schedule(n)
+	}
+
+	c.evict(nil)
+
+	return nil
+}
+
+// All returns an iterator over the cache's entries: Main from newest to
+// oldest, then Small in the same order.
+//
+// The entries are copied under the lock when iteration starts and yielded after
+// it is released, so the loop body may call back into the cache; changes made
+// during iteration are not reflected. Expired entries are skipped. Iterating
+// does not count as an access.
+//
+// Example:
+//
+//	for key, obj := range cache.All() {
+//	    fmt.Println(key, obj)
+//	}
+func (c *Cache[K, V]) All() iter.Seq2[K, V] {
+	return iterate.Seq(func() []iterate.Entry[K, V] { return c.collect(false) })
+}
+
+// Backward returns an iterator over the cache's entries in the reverse order of
+// [Cache.All]: Small from oldest to newest, then Main in the same order. This
+// is the order in which entries are considered for eviction.
+//
+// It has the same snapshot semantics as [Cache.All].
+func (c *Cache[K, V]) Backward() iter.Seq2[K, V] {
+	return iterate.Seq(func() []iterate.Entry[K, V] { return c.collect(true) })
+}
+
+// Keys returns an iterator over the cache's keys, in the order of [Cache.All].
+func (c *Cache[K, V]) Keys() iter.Seq[K] {
+	return iterate.Keys(c.All())
+}
+
+// Values returns an iterator over the cache's values, in the order of [Cache.All].
+func (c *Cache[K, V]) Values() iter.Seq[V] {
+	return iterate.Values(c.All())
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// setCapacity sets the total capacity and Small's share of it, at least 1.
+func (c *Cache[K, V]) setCapacity(capacity uint64) {
+	c.capacity = capacity
+	c.smallCap = max(1, capacity*smallPercent/100)
+}
+
+// getLocked is the slow path of [Cache.Get], taken when the read lock found
+// an expired entry.
+func (c *Cache[K, V]) getLocked(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	n.touch()
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the resident node for key, removing it first if it has
+// expired. Ghost nodes are not returned.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok || n.queue == ghost {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// weight returns the total weight of the resident entries.
+func (c *Cache[K, V]) weight() uint64 {
+	return c.queues[small].weight + c.queues[main].weight
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// evict frees space until the cache fits its capacity, from Small while it is
+// over its share and from Main otherwise, falling back to the other queue when
+// one has nothing left to give. keep, the entry just written if any, is never
+// evicted; it fits on its own, so another entry is always found.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) evict(keep *node[K, V]) {
+	for c.weight() > c.capacity {
+		if c.queues[small].weight > c.smallCap || c.queues[main].len == 0 {
+			if c.evictSmall(keep) {
+				continue
+			}
+		}
+
+		// When Small has nothing to evict either, it has moved all its
+		// entries but keep to Main, so Main gets another try.
+		if !c.evictMain(keep) && !c.evictSmall(keep) && !c.evictMain(keep) {
+			return
+		}
+	}
+}
+
+// evictSmall scans Small from its oldest entry, moving entries that were
+// requested while in Small to Main with their counter reset, until it evicts
+// one that was not into Ghost. It reports whether an entry was evicted.
+func (c *Cache[K, V]) evictSmall(keep *node[K, V]) bool {
+	l := &c.queues[small]
+
+	for n := l.tail.prev; n != l.head; {
+		prev := n.prev
+
+		switch {
+		case n == keep:
+		case n.freq.Load() > 0:
+			n.freq.Store(0)
+			c.move(n, main)
+		default:
+			c.demote(n)
+
+			return true
+		}
+
+		n = prev
+	}
+
+	return false
+}
+
+// evictMain scans Main from its oldest entry, reinserting entries with a
+// non-zero counter at the head with the counter decremented, until it evicts
+// one whose counter is zero. It reports whether an entry was evicted.
+func (c *Cache[K, V]) evictMain(keep *node[K, V]) bool {
+	l := &c.queues[main]
+
+	for l.len > 1 || (l.len == 1 && l.head.next != keep) {
+		n := l.tail.prev
+		if n == keep {
+			n = n.prev
+		}
+
+		if f := n.freq.Load(); f > 0 {
+			n.freq.Store(f - 1)
+			c.move(n, main)
+
+			continue
+		}
+
+		c.removeEntry(n, cache.ReasonEvicted)
+
+		return true
+	}
+
+	return false
+}
+
+// demote evicts a Small entry and remembers its key in Ghost, forgetting the
+// oldest ghost keys beyond the number of resident entries.
+func (c *Cache[K, V]) demote(n *node[K, V]) {
+	c.removals.Push(n.key, n.value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.unlink(n)
+
+	var zero V
+
+	n.value = zero
+	n.weight = 0
+	n.expiresAt = 0
+	c.pushFront(n, ghost)
+
+	l := &c.queues[ghost]
+	for l.len > max(1, c.queues[small].len+c.queues[main].len) {
+		c.forget(l.tail.prev)
+	}
+}
+
+// removeEntry unlinks a resident node, drops it from the index, cancels its
+// expiration and queues a removal notification.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.forget(n)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// forget unlinks a node and drops it from the index without notifying anyone.
+func (c *Cache[K, V]) forget(n *node[K, V]) {
+	c.unlink(n)
+	delete(c.items, n.key)
+}
+
+// collect copies the live entries in the order of [Cache.All], or the reverse
+// when backward is set.
+func (c *Cache[K, V]) collect(backward bool) []iterate.Entry[K, V] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now().UnixNano()
+	entries := make([]iterate.Entry[K, V], 0, c.queues[small].len+c.queues[main].len)
+
+	appendLive := func(n *node[K, V]) {
+		if !n.expired(now) {
+			entries = append(entries, iterate.Entry[K, V]{Key: n.key, Value: n.value})
+		}
+	}
+
+	if backward {
+		for _, q := range []queue{small, main} {
+			l := &c.queues[q]
+			for n := l.tail.prev; n != l.head; n = n.prev {
+				appendLive(n)
+			}
+		}
+
+		return entries
+	}
+
+	for _, q := range []queue{main, small} {
+		l := &c.queues[q]
+		for n := l.head.next; n != l.tail; n = n.next {
+			appendLive(n)
+		}
+	}
+
+	return entries
+}
+
+// removeAll removes every resident entry for reason in the order of
+// [Cache.All], and forgets all ghost keys.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) removeAll(reason cache.RemovalReason) {
+	for _, q := range []queue{main, small} {
+		l := &c.queues[q]
+		for n := l.head.next; n != l.tail; n = n.next {
+			c.removeEntry(n, reason)
+		}
+	}
+
+	l := &c.queues[ghost]
+	for n := l.head.next; n != l.tail; n = n.next {
+		c.forget(n)
+	}
+}
+
+// export copies the live entries for a snapshot in the order of [Cache.All],
+// recording each entry's queue and counter in its flags.
+func (c *Cache[K, V]) export() []snapshot.Entry[K, V] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now().UnixNano()
+	entries := make([]snapshot.Entry[K, V], 0, c.queues[small].len+c.queues[main].len)
+
+	for _, q := range []queue{main, small} {
+		l := &c.queues[q]
+		for n := l.head.next; n != l.tail; n = n.next {
+			if n.expired(now) {
+				continue
+			}
+
+			flags := uint8(n.freq.Load())
+			if q == main {
+				flags |= flagMain
+			}
+
+			entries = append(entries, snapshot.Entry[K, V]{
+				Key:       n.key,
+				Value:     n.value,
+				ExpiresAt: n.expiresAt,
+				Flags:     flags,
+			})
+		}
+	}
+
+	return entries
+}
+
+// unlock releases the write lock and then delivers the removal notifications
+// queued while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
+
+// move relinks a node at the head of the given queue.
+func (c *Cache[K, V]) move(n *node[K, V], to queue) {
+	c.unlink(n)
+	c.pushFront(n, to)
+}
+
+// unlink removes a node from its queue.
+func (c *Cache[K, V]) unlink(n *node[K, V]) {
+	l := &c.queues[n.queue]
+
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	l.len--
+	l.weight -= n.weight
+}
+
+// pushFront adds a node at the head of the given queue.
+func (c *Cache[K, V]) pushFront(n *node[K, V], q queue) {
+	l := &c.queues[q]
+
+	n.queue = q
+	n.next = l.head.next
+	n.prev = l.head
+	l.head.next.prev = n
+	l.head.next = n
+	l.len++
+	l.weight += n.weight
+}
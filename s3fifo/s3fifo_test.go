@@ -0,0 +1,684 @@
+package s3fifo_test
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
+	"github.com/serroba/cache/fifo"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/s3fifo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+// fill leaves a capacity-3 cache with "b" and "a" in Main and "d" in Small,
+// after evicting "c" to Ghost.
+func fill(c *s3fifo.Cache[string, int]) {
+	c.Set("a", 1)
+	c.Get("a")
+	c.Set("b", 2)
+	c.Get("b")
+	c.Set("c", 3)
+	c.Set("d", 4)
+}
+
+func TestS3FIFOCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := s3fifo.New[string, int](10)
+
+	v, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, v)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestS3FIFOCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := s3fifo.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestS3FIFOCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := s3fifo.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestS3FIFOCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := s3fifo.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestS3FIFOCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := s3fifo.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestS3FIFOCache_OneHitWondersLeaveQuickly(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := s3fifo.New[string, int](10, record(&log))
+
+	for i := range 11 {
+		c.Set(fmt.Sprintf("k%d", i), i)
+	}
+
+	assert.Equal(t, []removal{{"k0", 0, cache.ReasonEvicted}}, log)
+}
+
+func TestS3FIFOCache_RequestedInSmallMovesToMain(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := s3fifo.New[string, int](3, record(&log))
+	fill(c)
+
+	assert.Equal(t, []removal{{"c", 3, cache.ReasonEvicted}}, log)
+	assert.Equal(t, []string{"b", "a", "d"}, slices.Collect(c.Keys()))
+}
+
+func TestS3FIFOCache_GhostKeyGoesToMain(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := s3fifo.New[string, int](3, record(&log))
+	fill(c)
+
+	_, ok := c.Get("c")
+	assert.False(t, ok, "ghost keys hold no value")
+
+	c.Get("a")
+	c.Get("a")
+
+	// "c" returns to Main. Small is within its share, so Main makes room:
+	// "a" has a count of 2 and goes around again, "b" has none left.
+	c.Set("c", 30)
+
+	assert.Equal(t, []removal{
+		{"c", 3, cache.ReasonEvicted},
+		{"b", 2, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, []string{"a", "c", "d"}, slices.Collect(c.Keys()))
+}
+
+func TestS3FIFOCache_CounterIsCapped(t *testing.T) {
+	t.Parallel()
+
+	run := func(hits int) []removal {
+		var log []removal
+
+		c := s3fifo.New[string, int](3, record(&log))
+		fill(c)
+
+		for range hits {
+			c.Get("a")
+		}
+
+		for i := range 12 {
+			c.Set(fmt.Sprintf("k%d", i%3), i)
+		}
+
+		return log
+	}
+
+	assert.Equal(t, run(3), run(10), "hits beyond 3 are not counted")
+	assert.NotEqual(t, run(2), run(3))
+}
+
+func TestS3FIFOCache_PeekDoesNotCount(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := s3fifo.New[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Peek("a")
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4)
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestS3FIFOCache_BeatsLRUWithOneHitWonders(t *testing.T) {
+	t.Parallel()
+
+	s3 := s3fifo.New[string, int](10)
+	lr := lru.New[string, int](10)
+
+	for _, c := range []cache.Cache[string, int]{s3, lr} {
+		for i := range 5 {
+			c.Set(fmt.Sprintf("hot%d", i), i)
+			c.Get(fmt.Sprintf("hot%d", i))
+		}
+
+		for round := range 50 {
+			for i := range 5 {
+				key := fmt.Sprintf("hot%d", i)
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, i)
+				}
+			}
+
+			// More one-off keys than LRU can hold alongside the hot set.
+			for i := range 8 {
+				c.Set(fmt.Sprintf("once%d-%d", round, i), i)
+			}
+		}
+	}
+
+	assert.Equal(t, uint64(5+50*5), s3.Stats().Hits)
+	assert.Equal(t, uint64(5+5), lr.Stats().Hits, "only hits before the first one-off keys")
+}
+
+func TestS3FIFOCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := s3fifo.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestS3FIFOCache_PeekExpired(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := s3fifo.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.SetWithTTL("a", 1, time.Second)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonExpired}}, log)
+}
+
+func TestS3FIFOCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := s3fifo.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestS3FIFOCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := s3fifo.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestS3FIFOCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := s3fifo.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	s3fifo.New[string, int](10).Close()
+}
+
+func TestS3FIFOCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := s3fifo.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestS3FIFOCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := s3fifo.New[string, int](3, record(&log))
+	fill(c)
+
+	log = nil
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonCleared},
+		{"a", 1, cache.ReasonCleared},
+		{"d", 4, cache.ReasonCleared},
+	}, log)
+
+	// "c" was forgotten too, so it starts over in Small.
+	c.Set("c", 3)
+	c.Set("x", 0)
+	c.Set("y", 0)
+	c.Set("z", 0)
+
+	assert.Equal(t, removal{"c", 3, cache.ReasonEvicted}, log[len(log)-1])
+}
+
+func TestS3FIFOCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *s3fifo.Cache[string, int]
+
+	c = s3fifo.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestS3FIFOCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := s3fifo.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestS3FIFOCache_WeightedEvictsUntilFits(t *testing.T) {
+	t.Parallel()
+
+	c := s3fifo.New[string, int](10, weighByValue())
+	c.Set("a", 3)
+	c.Set("b", 3)
+	c.Set("c", 3)
+	c.Get("a")
+
+	c.Set("d", 7)
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(10), c.Weight())
+
+	_, ok := c.Peek("a")
+	assert.True(t, ok)
+	_, ok = c.Peek("d")
+	assert.True(t, ok)
+}
+
+func TestS3FIFOCache_WeightedUpdateKeepsEntry(t *testing.T) {
+	t.Parallel()
+
+	c := s3fifo.New[string, int](10, weighByValue())
+	c.Set("a", 4)
+	c.Set("b", 4)
+
+	// "a" is the oldest entry, but growing it must evict "b" instead.
+	c.Set("a", 8)
+
+	v, ok := c.Peek("a")
+	require.True(t, ok)
+	assert.Equal(t, 8, v)
+
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(8), c.Weight())
+}
+
+func TestS3FIFOCache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := s3fifo.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 2)
+	c.Set("big", 11)
+	c.Set("a", 20)
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"big", 11, cache.ReasonEvicted},
+		{"a", 2, cache.ReasonReplaced},
+		{"a", 20, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestS3FIFOCache_Resize(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := s3fifo.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Get("a")
+
+	for i, key := range []string{"b", "c", "d", "e"} {
+		c.Set(key, i)
+	}
+
+	// "a" was requested, so it moves to Main while Small shrinks to "e".
+	c.Resize(2)
+
+	assert.Equal(t, []removal{
+		{"b", 0, cache.ReasonEvicted},
+		{"c", 1, cache.ReasonEvicted},
+		{"d", 2, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, []string{"a", "e"}, slices.Collect(c.Keys()))
+
+	c.Resize(100)
+
+	for i := range 50 {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+
+	assert.Equal(t, 52, c.Len())
+	assert.Len(t, log, 3)
+}
+
+func TestS3FIFOCache_All(t *testing.T) {
+	t.Parallel()
+
+	c := s3fifo.New[string, int](3)
+	fill(c)
+
+	// Main newest to oldest, then Small.
+	assert.Equal(t, []string{"b", "a", "d"}, slices.Collect(c.Keys()))
+	assert.Equal(t, []int{2, 1, 4}, slices.Collect(c.Values()))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "d": 4}, maps.Collect(c.All()))
+
+	var backward []string
+	for k := range c.Backward() {
+		backward = append(backward, k)
+	}
+
+	assert.Equal(t, []string{"d", "a", "b"}, backward)
+}
+
+func TestS3FIFOCache_AllSkipsExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := s3fifo.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	assert.Equal(t, []string{"b"}, slices.Collect(c.Keys()))
+}
+
+func TestS3FIFOCache_SnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	var srcLog, dstLog []removal
+
+	src := s3fifo.New[string, int](3, record(&srcLog))
+	fill(src)
+	src.Get("a")
+	src.Get("a")
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	dst := s3fifo.New[string, int](3, record(&dstLog))
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, slices.Collect(src.Keys()), slices.Collect(dst.Keys()))
+
+	// Queues and counters came back, so both caches evict alike.
+	srcLog = nil
+
+	for _, c := range []*s3fifo.Cache[string, int]{src, dst} {
+		for i := range 5 {
+			key := fmt.Sprintf("new%d", i)
+			c.Set(key, i)
+			c.Set(key, i)
+			c.Set(key, i)
+		}
+	}
+
+	assert.Equal(t, srcLog, dstLog)
+	assert.Equal(t, slices.Collect(src.Keys()), slices.Collect(dst.Keys()))
+}
+
+func TestS3FIFOCache_RestoreIntoSmallerCache(t *testing.T) {
+	t.Parallel()
+
+	src := s3fifo.New[string, int](3)
+	fill(src)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	var log []removal
+
+	dst := s3fifo.New[string, int](2, record(&log))
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	// Small is within its share, so the oldest Main entry, with a zero
+	// count, makes room.
+	assert.Equal(t, []string{"b", "d"}, slices.Collect(dst.Keys()))
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestS3FIFOCache_RestoreRejectsOtherPolicy(t *testing.T) {
+	t.Parallel()
+
+	src := fifo.New[string, int](10)
+	src.Set("a", 1)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	dst := s3fifo.New[string, int](10)
+	dst.Set("b", 2)
+
+	err := dst.Restore(&buf, codec.String{}, codec.Varint[int]{})
+	require.ErrorIs(t, err, cache.ErrSnapshotPolicy)
+
+	_, ok := dst.Peek("b")
+	assert.True(t, ok, "a rejected snapshot leaves the cache untouched")
+}
+
+func TestS3FIFOCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+
+	var nanos atomic.Int64
+
+	c := s3fifo.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return now.Add(time.Duration(nanos.Add(1))) }),
+	)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				if j%3 == 0 {
+					c.SetWithTTL(key, j, time.Duration(j%50))
+				}
+
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
@@ -0,0 +1,162 @@
+// Package sharded spreads keys across independent caches to reduce lock contention.
+//
+// # When to Use Sharded
+//
+// Every cache in this module serializes its operations behind one mutex. On
+// machines with many cores, that single lock can dominate profiles. A sharded
+// cache hashes each key to one of N independent shards, so goroutines touching
+// different keys usually take different locks.
+//
+// # Trade-offs
+//
+// Each shard runs its eviction policy on its own slice of the key space, so
+// eviction is only policy-exact within a shard. Total capacity is the sum of
+// the shards' capacities, and a skewed key distribution can evict from a busy
+// shard while others have room.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use, provided the shards are.
+//
+// # Example Usage
+//
+//	// 16 LRU shards of 1000 items each
+//	c := sharded.New[string, int](16, func() cache.Cache[string, int] {
+//	    return lru.New[string, int](1000)
+//	})
+//	c.Set("key", 42)
+package sharded
+
+import (
+	"hash/maphash"
+
+	"github.com/serroba/cache"
+)
+
+// Cache distributes keys across a fixed set of shards by hash.
+//
+// The zero value is not usable; create instances with [New].
+type Cache[K comparable, V any] struct {
+	seed   maphash.Seed
+	shards []cache.Cache[K, V]
+	mask   uint64
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a sharded cache with the given number of shards, each built by newShard.
+//
+// The shard count is rounded up to the next power of two so a key's shard can
+// be found with a mask; values below 1 are treated as 1. newShard is called once
+// per shard and must return a distinct cache each time.
+//
+// Example:
+//
+//	c := sharded.New[int, []byte](64, func() cache.Cache[int, []byte] {
+//	    return slru.New[int, []byte](10000)
+//	})
+func New[K comparable, V any](shards int, newShard func() cache.Cache[K, V]) *Cache[K, V] {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+
+	c := &Cache[K, V]{
+		seed:   maphash.MakeSeed(),
+		shards: make([]cache.Cache[K, V], n),
+		mask:   uint64(n - 1),
+	}
+
+	for i := range c.shards {
+		c.shards[i] = newShard()
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the key's shard.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.shard(key).Set(key, value)
+}
+
+// Get retrieves a value from the key's shard, with that shard's policy semantics.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	return c.shard(key).Get(key)
+}
+
+// Peek retrieves a value from the key's shard without affecting eviction order.
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	return c.shard(key).Peek(key)
+}
+
+// Delete removes a key from its shard.
+//
+// Returns true if the key existed and was removed, false if the key was not found.
+func (c *Cache[K, V]) Delete(key K) bool {
+	return c.shard(key).Delete(key)
+}
+
+// Len returns the total number of items across all shards.
+//
+// Shards are counted one after another, so under concurrent writes the result
+// is not an atomic snapshot.
+func (c *Cache[K, V]) Len() int {
+	total := 0
+	for _, s := range c.shards {
+		total += s.Len()
+	}
+
+	return total
+}
+
+// Stats returns the sum of the statistics of every shard that reports them.
+//
+// Example:
+//
+//	fmt.Printf("hit ratio %.2f\n", c.Stats().HitRatio())
+func (c *Cache[K, V]) Stats() cache.Stats {
+	var total cache.Stats
+
+	for _, s := range c.shards {
+		if r, ok := s.(cache.StatsReporter); ok {
+			total = total.Add(r.Stats())
+		}
+	}
+
+	return total
+}
+
+// ResetStats resets the statistics of every shard that reports them.
+func (c *Cache[K, V]) ResetStats() {
+	for _, s := range c.shards {
+		if r, ok := s.(cache.StatsReporter); ok {
+			r.ResetStats()
+		}
+	}
+}
+
+// Clear removes every entry from every shard that supports clearing.
+func (c *Cache[K, V]) Clear() {
+	for _, s := range c.shards {
+		if cl, ok := s.(interface{ Clear() }); ok {
+			cl.Clear()
+		}
+	}
+}
+
+// Close closes every shard that has a Close method, stopping their janitors.
+func (c *Cache[K, V]) Close() {
+	for _, s := range c.shards {
+		if cl, ok := s.(interface{ Close() }); ok {
+			cl.Close()
+		}
+	}
+}
+
+// shard returns the shard responsible for key.
+func (c *Cache[K, V]) shard(key K) cache.Cache[K, V] {
+	return c.shards[maphash.Comparable(c.seed, key)&c.mask]
+}
@@ -0,0 +1,175 @@
+package sharded_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/clock"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/sharded"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLRUShards(shards int, capacity uint64) (*sharded.Cache[string, int], *[]*lru.Cache[string, int]) {
+	var created []*lru.Cache[string, int]
+
+	c := sharded.New(shards, func() cache.Cache[string, int] {
+		s := lru.New[string, int](capacity)
+		created = append(created, s)
+
+		return s
+	})
+
+	return c, &created
+}
+
+func TestShardedCache_BasicOperations(t *testing.T) {
+	t.Parallel()
+
+	c, _ := newLRUShards(4, 100)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+
+	assert.Equal(t, 2, c.Len())
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestShardedCache_ShardCountRoundedToPowerOfTwo(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct{ requested, want int }{{0, 1}, {1, 1}, {3, 4}, {16, 16}, {17, 32}} {
+		_, created := newLRUShards(tc.requested, 10)
+		assert.Len(t, *created, tc.want, "requested %d shards", tc.requested)
+	}
+}
+
+func TestShardedCache_SpreadsKeys(t *testing.T) {
+	t.Parallel()
+
+	c, created := newLRUShards(8, 1000)
+
+	for i := range 800 {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+
+	assert.Equal(t, 800, c.Len())
+
+	for i, s := range *created {
+		assert.Positive(t, s.Len(), "shard %d received no keys", i)
+	}
+}
+
+func TestShardedCache_AggregatesStats(t *testing.T) {
+	t.Parallel()
+
+	c, _ := newLRUShards(4, 100)
+
+	for i := range 10 {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+
+	for i := range 20 {
+		c.Get(fmt.Sprintf("key%d", i))
+	}
+
+	c.Delete("key0")
+
+	s := c.Stats()
+	assert.Equal(t, uint64(10), s.Sets)
+	assert.Equal(t, uint64(10), s.Hits)
+	assert.Equal(t, uint64(10), s.Misses)
+	assert.Equal(t, uint64(1), s.Deletions)
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+type plainCache struct {
+	cache.Cache[string, int]
+}
+
+func TestShardedCache_ShardsWithoutOptionalMethods(t *testing.T) {
+	t.Parallel()
+
+	c := sharded.New(2, func() cache.Cache[string, int] {
+		return plainCache{lru.New[string, int](10)}
+	})
+
+	c.Set("a", 1)
+	c.Get("a")
+
+	assert.Equal(t, cache.Stats{}, c.Stats())
+	assert.NotPanics(t, c.ResetStats)
+	assert.NotPanics(t, c.Clear)
+	assert.NotPanics(t, c.Close)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestShardedCache_ClearAndClose(t *testing.T) {
+	t.Parallel()
+
+	c := sharded.New(4, func() cache.Cache[string, int] {
+		return clock.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	})
+
+	for i := range 20 {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+
+	c.Clear()
+	assert.Equal(t, 0, c.Len())
+
+	c.Close()
+}
+
+func TestShardedCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c, _ := newLRUShards(16, 100)
+
+	var wg sync.WaitGroup
+
+	for i := range 32 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 200 {
+				key := fmt.Sprintf("key%d", (id*200+j)%500)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 1600)
+}
@@ -0,0 +1,578 @@
+// Package sieve provides a thread-safe SIEVE cache implementation.
+//
+// # When to Use SIEVE
+//
+// Use SIEVE when you want a better hit ratio than LRU on web-style workloads
+// with little more machinery than FIFO. SIEVE is ideal for:
+//   - Web, CDN and API object caches with many one-hit wonders
+//   - Read-heavy caches where LRU's reordering on every hit causes lock contention
+//   - Replacing Clock or FIFO when a few popular keys should survive longer
+//
+// # How SIEVE Works
+//
+// Entries are kept in a FIFO queue, newest at the head, each with a visited bit:
+//  1. New entries are inserted at the head with the bit clear
+//  2. A hit only sets the entry's visited bit; entries never move
+//  3. On eviction, a hand walks from its last position towards the head,
+//     clearing visited bits, and evicts the first entry whose bit is clear
+//  4. When the hand reaches the head it wraps around to the tail
+//
+// Unlike Clock, survivors stay where they are instead of being moved, so new
+// entries that are not requested again are quickly swept out between the hand
+// and the head, while popular entries stay behind the hand.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. Get and Peek only take a read lock,
+// since a hit sets the visited bit atomically instead of reordering the queue,
+// so concurrent hits do not serialize on each other.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1) amortized.
+//
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and a single Set may evict several entries to make room.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// Counters are updated atomically, so reading them never contends with cache
+// operations.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := sieve.New[string, int](100)
+//	cache.Set("key", 42)
+//	cache.Get("key")        // Sets visited bit
+//	// On eviction, the hand clears the bit and passes over "key" once
+package sieve
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+type node[K comparable, V any] struct {
+	key        K
+	value      V
+	weight     uint64
+	visited    atomic.Bool // set under the read lock by Get
+	expiresAt  int64       // unix nanoseconds, 0 means no expiration
+	timer      wheel.Timer[*node[K, V]]
+	prev, next *node[K, V]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// Cache implements a SIEVE cache.
+//
+// It keeps entries in insertion order and evicts with a hand that sweeps from
+// the oldest entry towards the newest, sparing entries that were visited since
+// it last passed them. Hits never reorder entries.
+//
+// The zero value is not usable; create instances with [New].
+type Cache[K comparable, V any] struct {
+	mu         sync.RWMutex
+	items      map[K]*node[K, V]
+	head, tail *node[K, V] // head = newest, tail = oldest
+	hand       *node[K, V] // next eviction candidate, nil to start at the tail
+	capacity   uint64
+	weight     uint64
+	weigher    func(K, V) uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new SIEVE cache with the specified maximum capacity.
+//
+// The capacity determines how many key-value pairs the cache can hold, or their
+// total weight when [cache.WithWeigher] is used. When this limit is exceeded,
+// items are evicted using the SIEVE hand.
+// Options such as [cache.WithDefaultTTL] are applied in order.
+//
+// Example:
+//
+//	cache := sieve.New[string, *Response](10000)
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	head := &node[K, V]{}
+	tail := &node[K, V]{}
+	head.next = tail
+	tail.prev = head
+
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		head:       head,
+		tail:       tail,
+		capacity:   capacity,
+		weigher:    o.Weigher,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - If the key exists: updates the value in place and sets its visited bit
+//   - If the key is new and cache is full: the hand evicts an unvisited item first
+//   - If the key is new and cache has space: adds item as newest, unvisited
+//   - If the entry outweighs the whole cache: it is not stored
+//
+// The overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set("user:123", user)
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("session:abc", session, 30*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	weight := c.weigh(key, value)
+	if weight > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+		c.weight = c.weight - n.weight + weight
+		n.value = value
+		n.weight = weight
+		n.expiresAt = expiresAt
+		n.visited.Store(true)
+		c.schedule(n)
+		c.evict(n)
+
+		return
+	}
+
+	n := &node[K, V]{key: key, value: value, weight: weight, expiresAt: expiresAt}
+	c.addToHead(n)
+
+	c.items[key] = n
+	c.weight += weight
+	c.schedule(n)
+	c.stats.RecordSet()
+
+	c.evict(n)
+}
+
+// Get retrieves a value from the cache.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// A hit sets the entry's visited bit so the hand passes over it once, without
+// moving it. Hits only need a read lock. Use [Cache.Peek] to read without
+// setting the bit.
+//
+// Example:
+//
+//	if user, ok := cache.Get("user:123"); ok {
+//	    fmt.Println(user.Name)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+
+	n, ok := c.items[key]
+	if ok && !n.expired(c.now().UnixNano()) {
+		if !n.visited.Load() {
+			n.visited.Store(true)
+		}
+
+		value := n.value
+		c.mu.RUnlock()
+		c.stats.RecordHit()
+
+		return value, true
+	}
+
+	c.mu.RUnlock()
+
+	if ok {
+		// Expired: take the write lock to remove it, unless it was refreshed
+		// in the meantime.
+		return c.getLocked(key)
+	}
+
+	c.stats.RecordMiss()
+
+	var zero V
+
+	return zero, false
+}
+
+// Peek retrieves a value without setting its visited bit.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Unlike [Cache.Get], this does not protect the entry from eviction and is
+// not counted in [Cache.Stats].
+//
+// Example:
+//
+//	if user, ok := cache.Peek("user:123"); ok {
+//	    // Item found, visited bit unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.RLock()
+
+	n, ok := c.items[key]
+	if ok && !n.expired(c.now().UnixNano()) {
+		value := n.value
+		c.mu.RUnlock()
+
+		return value, true
+	}
+
+	c.mu.RUnlock()
+
+	if ok {
+		c.mu.Lock()
+		defer c.unlock()
+
+		if n, ok := c.lookup(key); ok {
+			return n.value, true
+		}
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted].
+//
+// Example:
+//
+//	cache.Delete("user:123")
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the current number of items in the cache.
+//
+// Without a weigher, this value is always <= the capacity specified in [New].
+// Expired entries that have not been removed yet are still counted.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.items)
+}
+
+// Weight returns the total weight of the items in the cache.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.weight
+}
+
+// Clear removes every entry from the cache.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], from oldest to newest.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for n := c.tail.prev; n != c.head; n = n.prev {
+		c.removeEntry(n, cache.ReasonCleared)
+	}
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// getLocked is the slow path of [Cache.Get], taken when the read lock found
+// an expired entry.
+func (c *Cache[K, V]) getLocked(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	n.visited.Store(true)
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the node for key, removing it first if it has expired.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// evict moves the hand towards the head until the cache fits its capacity,
+// clearing visited bits and evicting unvisited entries. keep, the entry just
+// written, is skipped; it fits on its own, so another entry is always found.
+// Must be called with the write lock held.
+func (c *Cache[K, V]) evict(keep *node[K, V]) {
+	for c.weight > c.capacity {
+		n := c.hand
+		if n == nil {
+			n = c.tail.prev
+		}
+
+		for n == keep || n.visited.Load() {
+			if n != keep {
+				n.visited.Store(false)
+			}
+
+			n = n.prev
+			if n == c.head {
+				n = c.tail.prev
+			}
+		}
+
+		c.hand = n
+		c.removeEntry(n, cache.ReasonEvicted)
+	}
+}
+
+// removeEntry unlinks a node, drops it from the index, cancels its expiration
+// and queues a removal notification. If the hand points at the node, it moves
+// on to the next newer entry. Must be called with the write lock held.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	if c.hand == n {
+		c.hand = n.prev
+		if c.hand == c.head {
+			c.hand = nil
+		}
+	}
+
+	c.removeNode(n)
+	delete(c.items, n.key)
+	c.weight -= n.weight
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// unlock releases the write lock and then delivers the removal notifications
+// queued while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
+
+// addToHead links a node in as the newest entry.
+func (c *Cache[K, V]) addToHead(n *node[K, V]) {
+	n.next = c.head.next
+	n.prev = c.head
+	c.head.next.prev = n
+	c.head.next = n
+}
+
+// removeNode removes a node from the linked list.
+func (c *Cache[K, V]) removeNode(n *node[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+}
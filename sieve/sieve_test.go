@@ -0,0 +1,533 @@
+package sieve_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/sieve"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+func TestSIEVECache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := sieve.New[string, int](10)
+
+	v, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, v)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestSIEVECache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := sieve.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestSIEVECache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := sieve.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestSIEVECache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := sieve.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestSIEVECache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := sieve.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestSIEVECache_VisitedEntriesSurviveInPlace(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := sieve.New[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+
+	c.Set("d", 4) // hand clears "a", evicts "b"
+	c.Set("e", 5) // hand continues from "c", not from the tail
+	c.Set("f", 6) // "d" was never visited
+
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonEvicted},
+		{"d", 4, cache.ReasonEvicted},
+	}, log)
+
+	_, ok := c.Peek("a")
+	assert.True(t, ok, "a stays at the tail, behind the hand")
+}
+
+func TestSIEVECache_HandWrapsAround(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := sieve.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Get("b")
+
+	c.Set("c", 3) // clears both bits, wraps to the tail and evicts "a"
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestSIEVECache_UpdateCountsAsVisit(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := sieve.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("a", 10)
+	c.Set("c", 3)
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"b", 2, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestSIEVECache_PeekDoesNotVisit(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := sieve.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Peek("a")
+	c.Set("c", 3)
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestSIEVECache_DeleteAtHand(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := sieve.New[string, int](3, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("d", 4) // evicts "b", hand now at "c"
+
+	c.Delete("c") // hand moves on to "d"
+	c.Set("e", 5)
+	c.Set("f", 6)
+
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonDeleted},
+		{"d", 4, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestSIEVECache_BeatsLRUWithOneHitWonders(t *testing.T) {
+	t.Parallel()
+
+	sv := sieve.New[string, int](10)
+	lr := lru.New[string, int](10)
+
+	for _, c := range []cache.Cache[string, int]{sv, lr} {
+		for i := range 5 {
+			c.Set(fmt.Sprintf("hot%d", i), i)
+			c.Get(fmt.Sprintf("hot%d", i))
+		}
+
+		for round := range 50 {
+			for i := range 5 {
+				key := fmt.Sprintf("hot%d", i)
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, i)
+				}
+			}
+
+			// More one-off keys than LRU can hold alongside the hot set.
+			for i := range 8 {
+				c.Set(fmt.Sprintf("once%d-%d", round, i), i)
+			}
+		}
+	}
+
+	assert.Equal(t, uint64(5+50*5), sv.Stats().Hits)
+	assert.Equal(t, uint64(5+5), lr.Stats().Hits, "only hits before the first one-off keys")
+}
+
+func TestSIEVECache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := sieve.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestSIEVECache_PeekExpired(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := sieve.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.SetWithTTL("a", 1, time.Second)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonExpired}}, log)
+}
+
+func TestSIEVECache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := sieve.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestSIEVECache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := sieve.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestSIEVECache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := sieve.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	sieve.New[string, int](10).Close()
+}
+
+func TestSIEVECache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := sieve.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestSIEVECache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := sieve.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3) // leaves the hand on "c"
+
+	log = nil
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"c", 3, cache.ReasonCleared},
+	}, log)
+
+	c.Set("d", 4)
+	c.Set("e", 5)
+	c.Set("f", 6)
+
+	assert.Equal(t, removal{"d", 4, cache.ReasonEvicted}, log[len(log)-1])
+}
+
+func TestSIEVECache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *sieve.Cache[string, int]
+
+	c = sieve.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestSIEVECache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := sieve.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestSIEVECache_WeightedEvictsUntilFits(t *testing.T) {
+	t.Parallel()
+
+	c := sieve.New[string, int](10, weighByValue())
+	c.Set("a", 3)
+	c.Set("b", 3)
+	c.Set("c", 3)
+	c.Get("a")
+
+	c.Set("d", 7)
+
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(10), c.Weight())
+
+	_, ok := c.Peek("a")
+	assert.True(t, ok)
+	_, ok = c.Peek("d")
+	assert.True(t, ok)
+}
+
+func TestSIEVECache_WeightedUpdateKeepsEntry(t *testing.T) {
+	t.Parallel()
+
+	c := sieve.New[string, int](10, weighByValue())
+	c.Set("a", 4)
+	c.Set("b", 4)
+	c.Get("b")
+
+	// "a" is the hand's first candidate, but growing it must evict "b" instead.
+	c.Set("a", 8)
+
+	v, ok := c.Peek("a")
+	require.True(t, ok)
+	assert.Equal(t, 8, v)
+
+	_, ok = c.Peek("b")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(8), c.Weight())
+}
+
+func TestSIEVECache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := sieve.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 2)
+	c.Set("big", 11)
+	c.Set("a", 20)
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"big", 11, cache.ReasonEvicted},
+		{"a", 2, cache.ReasonReplaced},
+		{"a", 20, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestSIEVECache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+
+	var nanos atomic.Int64
+
+	c := sieve.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return now.Add(time.Duration(nanos.Add(1))) }),
+	)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				if j%3 == 0 {
+					c.SetWithTTL(key, j, time.Duration(j%50))
+				}
+
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
@@ -19,13 +19,56 @@
 // When protected is full, its least recently used item is demoted back to probation.
 // Eviction always happens from probation first, protecting frequently used items.
 //
+// # More Segments
+//
+// [NewSegmented] generalizes this to any number of segments, stacked from
+// probation up to the most protected. Each hit promotes an item one segment up,
+// and a segment that overflows demotes its least recently used items one
+// segment down, which may cascade all the way to probation. An item has to be
+// hit once per segment to reach the top, so the segments act as tiers of
+// access frequency.
+//
 // # Thread Safety
 //
 // All methods are safe for concurrent use. The cache uses a mutex internally.
 //
 // # Performance
 //
-// All operations (Get, Set, Delete, Peek, Len) are O(1).
+// All operations (Get, Set, Delete, Peek, Len) are O(1). With [NewSegmented],
+// a promotion can demote one item per segment, so Get is O(s) for s segments.
+//
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and both segment sizes are measured in weight. A single
+// Set may evict several probation entries to make room; an entry heavier than
+// the whole probation segment is still admitted, evicting protected entries
+// if the cache as a whole would otherwise not fit.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// Counters are updated atomically, so reading them never contends with cache
+// operations.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Persistence
+//
+// [Cache.Snapshot] writes the entries together with each entry's segment and
+// recency to an [io.Writer], and [Cache.Restore] loads them back, so a restarted
+// process can start warm. Keys and values are encoded with a [codec.Codec].
 //
 // # Example Usage
 //
@@ -34,61 +77,101 @@
 //	cache.Get("key")                       // Promoted to protected
 package slru
 
-import "sync"
-
-type segment uint8
+import (
+	"io"
+	"iter"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
+	"github.com/serroba/cache/internal/iterate"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/segment"
+	"github.com/serroba/cache/internal/snapshot"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
 
 const (
-	probation segment = iota
-	protected
+	// probation is the segment new items enter; higher segments are more protected.
+	probation = 0
+
+	// maxSegments is the number of segments a snapshot's flags can address.
+	maxSegments = 255
 )
 
 type node[K comparable, V any] struct {
-	key        K
-	value      V
-	segment    segment
-	prev, next *node[K, V]
+	segment.Links[*node[K, V]]
+
+	key       K
+	value     V
+	expiresAt int64 // unix nanoseconds, 0 means no expiration
+	timer     wheel.Timer[*node[K, V]]
 }
 
-// Cache implements a Segmented LRU (SLRU) cache with probation and protected segments.
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// Cache implements a Segmented LRU (SLRU) cache with a probation segment and
+// one or more protected segments.
 //
 // New items enter the probation segment. When accessed again via [Cache.Get], they are
-// promoted to the protected segment. This two-tier structure provides scan resistance:
+// promoted to the protected segment above. This tiered structure provides scan resistance:
 // a burst of new items will only evict other new items in probation, not the frequently
 // accessed items in protected.
 //
-// The zero value is not usable; create instances with [New] or [NewWithRatio].
+// The zero value is not usable; create instances with [New], [NewWithRatio] or
+// [NewSegmented].
 type Cache[K comparable, V any] struct {
 	mu sync.Mutex
 
-	items map[K]*node[K, V]
+	items    map[K]*node[K, V]
+	segments segment.Stack[*node[K, V]] // probation first, most protected last
+
+	capacity uint64
+	ratios   []uint8
+	weigher  func(K, V) uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
 
-	probationHead, probationTail *node[K, V]
-	protectedHead, protectedTail *node[K, V]
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
 
-	probationCap, protectedCap uint64
-	probationLen, protectedLen uint64
+	removals removal.Queue[K, V]
+	stats    stats.Counters
 }
 
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
 // New creates a new SLRU cache with the given capacity using the default 80/20 split.
 //
 // The capacity is divided as:
 //   - Protected segment: 80% (frequently accessed items)
 //   - Probation segment: 20% (new items awaiting promotion)
 //
-// Use [NewWithRatio] if you need a different split.
+// Use [NewWithRatio] if you need a different split. Options such as
+// [cache.WithDefaultTTL] are applied in order.
 //
 // Example:
 //
 //	cache := slru.New[string, *Page](10000)  // 8000 protected, 2000 probation
-func New[K comparable, V any](capacity uint64) *Cache[K, V] {
-	return NewWithRatio[K, V](capacity, 80)
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	return NewWithRatio(capacity, 80, opts...)
 }
 
 // NewWithRatio creates a new SLRU cache with a custom protected/probation ratio.
 //
 // Parameters:
-//   - capacity: total number of items the cache can hold
+//   - capacity: total number of items the cache can hold, or their total weight
+//     when [cache.WithWeigher] is used
 //   - protectedPercent: percentage of capacity for the protected segment (0-100)
 //
 // The probation segment gets the remaining capacity. Both segments are guaranteed
@@ -101,41 +184,76 @@ func New[K comparable, V any](capacity uint64) *Cache[K, V] {
 //
 //	// 90/10 split for highly skewed access patterns
 //	cache := slru.NewWithRatio[string, int](1000, 90)
-func NewWithRatio[K comparable, V any](capacity uint64, protectedPercent uint8) *Cache[K, V] {
+func NewWithRatio[K comparable, V any](
+	capacity uint64, protectedPercent uint8, opts ...cache.Option[K, V],
+) *Cache[K, V] {
 	if protectedPercent > 100 {
 		protectedPercent = 100
 	}
 
-	protectedCap := capacity * uint64(protectedPercent) / 100
-	probationCap := capacity - protectedCap
+	return NewSegmented(capacity, []uint8{100 - protectedPercent, protectedPercent}, opts...)
+}
 
-	if protectedCap == 0 {
-		protectedCap = 1
+// NewSegmented creates a new SLRU cache with any number of segments.
+//
+// ratios gives the relative size of each segment, from probation, where new
+// items start, up to the most protected segment. Each hit promotes an item one
+// segment up; when a segment overflows, its least recently used items are
+// demoted one segment down, cascading to probation, which evicts.
+//
+// Ratios are relative, so they need not add up to 100, and if they are all
+// zero the segments get equal shares. Two segments are split as by
+// [NewWithRatio], each with at least 1 slot. With more, the segment limits add
+// up to the capacity: a protected segment whose share rounds down to nothing
+// gets no room, and probation always gets at least 1 slot. Without ratios the
+// cache has the default 20/80 split of [New], and a single ratio gives one
+// segment that behaves like a plain LRU cache. Ratios beyond the 255th are
+// ignored.
+//
+// ratios is a slice rather than a variadic parameter because the cache
+// options already take the variadic position.
+//
+// Example:
+//
+//	// 200 probation, then tiers of 300 and 500 for items hit at least once and twice
+//	cache := slru.NewSegmented[string, *Page](1000, []uint8{20, 30, 50})
+func NewSegmented[K comparable, V any](
+	capacity uint64, ratios []uint8, opts ...cache.Option[K, V],
+) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	switch {
+	case len(ratios) == 0:
+		ratios = []uint8{20, 80}
+	case len(ratios) > maxSegments:
+		ratios = ratios[:maxSegments]
 	}
 
-	if probationCap == 0 {
-		probationCap = 1
+	ratios = slices.Clone(ratios)
+	if !slices.ContainsFunc(ratios, func(r uint8) bool { return r > 0 }) {
+		for i := range ratios {
+			ratios[i] = 1
+		}
 	}
 
-	probationHead := &node[K, V]{segment: probation}
-	probationTail := &node[K, V]{segment: probation}
-	probationHead.next = probationTail
-	probationTail.prev = probationHead
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		segments:   segment.NewStack[*node[K, V]](len(ratios)),
+		ratios:     ratios,
+		weigher:    o.Weigher,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
 
-	protectedHead := &node[K, V]{segment: protected}
-	protectedTail := &node[K, V]{segment: protected}
-	protectedHead.next = protectedTail
-	protectedTail.prev = protectedHead
+	c.setCapacity(capacity)
 
-	return &Cache[K, V]{
-		items:         make(map[K]*node[K, V]),
-		probationHead: probationHead,
-		probationTail: probationTail,
-		protectedHead: protectedHead,
-		protectedTail: protectedTail,
-		probationCap:  probationCap,
-		protectedCap:  protectedCap,
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
 	}
+
+	return c
 }
 
 // Set adds or updates a key-value pair in the cache.
@@ -143,47 +261,81 @@ func NewWithRatio[K comparable, V any](capacity uint64, protectedPercent uint8)
 // Behavior:
 //   - New keys: added to the probation segment
 //   - Existing keys: value updated in place, item stays in its current segment
+//   - Entries that outweigh the whole cache: not stored (see [cache.WithWeigher])
 //
 // New items must "earn" their place in the protected segment by being accessed
-// again via [Cache.Get]. This is what gives SLRU its scan resistance.
+// again via [Cache.Get]. This is what gives SLRU its scan resistance. The
+// overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
 //
 // Example:
 //
 //	cache.Set("page:1", pageData)   // Enters probation
 //	cache.Set("page:1", newData)    // Updates value, stays in probation
 //	cache.Get("page:1")             // NOW promoted to protected
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
 func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("page:1", pageData, 5*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if n, ok := c.items[key]; ok {
-		n.value = value
-		c.moveToHead(n)
+	weight := c.weigh(key, value)
+	if c.weigher != nil && weight > c.capacity {
+		c.reject(key, value)
 
 		return
 	}
 
-	n := &node[K, V]{key: key, value: value, segment: probation}
-	c.items[key] = n
-	c.addToHead(n, probation)
-	c.probationLen++
+	expiresAt := c.expiry(ttl)
 
-	if c.probationLen > c.probationCap {
-		c.evictFromProbation()
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		c.segments.Reweigh(n, weight)
+		n.value = value
+		n.expiresAt = expiresAt
+		c.schedule(n)
+		c.segments.MoveToFront(n)
+		c.rebalance(n)
+
+		return
 	}
+
+	n := &node[K, V]{key: key, value: value, expiresAt: expiresAt}
+	c.items[key] = n
+	c.schedule(n)
+	c.stats.RecordSet()
+	c.segments.PushFront(n, probation, weight)
+	c.rebalance(n)
 }
 
-// Get retrieves a value and promotes probation items to protected.
+// Get retrieves a value and promotes it one segment up.
 //
 // Returns:
 //   - (value, true) if the key exists
-//   - (zero value, false) if the key does not exist
+//   - (zero value, false) if the key does not exist or has expired
 //
 // Promotion behavior:
 //   - Items in probation are promoted to the protected segment
-//   - Items already in protected are moved to the front (most recently used)
+//   - Items already in the most protected segment are moved to the front (most recently used)
 //   - If protected is full, its LRU item is demoted back to probation
 //
+// With [NewSegmented], items in any segment but the last move one segment up,
+// and overflow is demoted one segment down at a time.
+//
 // This promotion mechanism is what provides SLRU's scan resistance. Use
 // [Cache.Peek] if you need to read without promoting.
 //
@@ -194,21 +346,26 @@ func (c *Cache[K, V]) Set(key K, value V) {
 //	cache.Get("item")                 // Stays in protected, moved to front
 func (c *Cache[K, V]) Get(key K) (V, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	n, ok := c.items[key]
+	n, ok := c.lookup(key)
 	if !ok {
+		c.stats.RecordMiss()
+
 		var zero V
 
 		return zero, false
 	}
 
-	if n.segment == probation {
-		c.promote(n)
+	if n.Segment() < c.segments.Len()-1 {
+		c.segments.Promote(n)
+		c.rebalance(n)
 	} else {
-		c.moveToHead(n)
+		c.segments.MoveToFront(n)
 	}
 
+	c.stats.RecordHit()
+
 	return n.value, true
 }
 
@@ -216,7 +373,7 @@ func (c *Cache[K, V]) Get(key K) (V, bool) {
 //
 // Returns:
 //   - (value, true) if the key exists
-//   - (zero value, false) if the key does not exist
+//   - (zero value, false) if the key does not exist or has expired
 //
 // Unlike [Cache.Get], this does not promote probation items to protected.
 // Use Peek when you need to check a value without affecting the cache's
@@ -230,9 +387,9 @@ func (c *Cache[K, V]) Get(key K) (V, bool) {
 //	}
 func (c *Cache[K, V]) Peek(key K) (V, bool) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	if n, ok := c.items[key]; ok {
+	if n, ok := c.lookup(key); ok {
 		return n.value, true
 	}
 
@@ -243,36 +400,31 @@ func (c *Cache[K, V]) Peek(key K) (V, bool) {
 
 // Delete removes a key from the cache, regardless of which segment it's in.
 //
-// Returns true if the key existed and was removed, false if the key was not found.
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted].
 //
 // Example:
 //
 //	cache.Delete("expired-session")
 func (c *Cache[K, V]) Delete(key K) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	n, ok := c.items[key]
+	n, ok := c.lookup(key)
 	if !ok {
 		return false
 	}
 
-	c.removeNode(n)
-
-	if n.segment == probation {
-		c.probationLen--
-	} else {
-		c.protectedLen--
-	}
-
-	delete(c.items, key)
+	c.removeEntry(n, cache.ReasonDeleted)
 
 	return true
 }
 
-// Len returns the total number of items across both segments.
+// Len returns the total number of items across all segments.
 //
 // This is the combined count of items in probation and protected segments.
+// Expired entries that have not been removed yet are still counted.
 //
 // Example:
 //
@@ -284,71 +436,442 @@ func (c *Cache[K, V]) Len() int {
 	return len(c.items)
 }
 
-// promote moves a node from probation to protected segment.
-func (c *Cache[K, V]) promote(n *node[K, V]) {
-	c.removeNode(n)
-	c.probationLen--
+// Weight returns the total weight of the items across all segments.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.segments.Weight()
+}
+
+// Resize changes the capacity of the cache, keeping its segment ratios.
+//
+// All segment limits are recomputed. Shrinking first demotes the least
+// recently used protected items that no longer fit one segment down, towards
+// probation, then evicts from the LRU end of probation, so probation items are
+// lost before protected ones. Each evicted item is reported to the [cache.OnEvict] listener with
+// [cache.ReasonEvicted]. Growing keeps every item in place. With
+// [cache.WithWeigher], capacity is a weight.
+//
+// Example:
+//
+//	cache.Resize(cfg.CacheSize) // apply a config reload without a cold start
+func (c *Cache[K, V]) Resize(capacity uint64) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.setCapacity(capacity)
+	c.rebalance(nil)
+}
 
-	n.segment = protected
-	c.addToHead(n, protected)
-	c.protectedLen++
+// setCapacity sets the total capacity and splits it between the segments
+// according to their ratios, giving probation what rounding leaves over.
+//
+// Two segments keep the split of [NewWithRatio], where each is guaranteed at
+// least 1 slot. With more, a protected segment whose share rounds down to
+// nothing gets no room, and its promotions fall straight back to the segment
+// below. Probation always gets at least 1 slot, taken from the largest
+// protected segment if need be, so the segments add up to the capacity,
+// except in a zero-capacity cache.
+func (c *Cache[K, V]) setCapacity(capacity uint64) {
+	c.capacity = capacity
+
+	var total uint64
+	for _, r := range c.ratios {
+		total += uint64(r)
+	}
+
+	if c.segments.Len() == 2 {
+		protectedCap := capacity * uint64(c.ratios[probation+1]) / total
+		c.segments.SetCapacity(probation+1, max(protectedCap, 1))
+		c.segments.SetCapacity(probation, max(capacity-protectedCap, 1))
 
-	if c.protectedLen > c.protectedCap {
-		c.demoteLRU()
+		return
 	}
+
+	rest := capacity
+	largest := -1
+
+	for i := c.segments.Len() - 1; i > probation; i-- {
+		share := capacity * uint64(c.ratios[i]) / total
+		c.segments.SetCapacity(i, share)
+		rest -= share
+
+		if largest < 0 || share > c.segments.Capacity(largest) {
+			largest = i
+		}
+	}
+
+	if rest == 0 {
+		if largest >= 0 && c.segments.Capacity(largest) > 0 {
+			c.segments.SetCapacity(largest, c.segments.Capacity(largest)-1)
+		}
+
+		rest = 1
+	}
+
+	c.segments.SetCapacity(probation, rest)
 }
 
-// demoteLRU moves the LRU item from protected back to probation.
-// This is only called when protectedLen > protectedCap, so protected is never empty.
-// Note: This cannot cause probation overflow because:
-// - promote() removes 1 from probation and demoteLRU adds 1 back (net zero change)
-// - probationLen never exceeds probationCap after Set() completes.
-func (c *Cache[K, V]) demoteLRU() {
-	lru := c.protectedTail.prev
+// Clear removes every entry from all segments.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], most protected entries first.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
 
-	c.removeNode(lru)
-	c.protectedLen--
+	c.removeAll(cache.ReasonCleared)
+}
 
-	lru.segment = probation
-	c.addToHead(lru, probation)
-	c.probationLen++
+// Snapshot writes the cache's entries to w, preserving each entry's segment
+// and its recency within that segment.
+//
+// Keys and values are encoded with the given codecs into a versioned binary
+// format with a checksum, which [Cache.Restore] reads back. Expired entries are
+// skipped and TTLs are kept as absolute deadlines. Entries are copied under the
+// lock and encoded after it is released, so a slow writer does not block the cache.
+//
+// Example:
+//
+//	f, err := os.Create("pages.snap")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//
+//	return cache.Snapshot(f, keyCodec, pageCodec)
+func (c *Cache[K, V]) Snapshot(w io.Writer, keys codec.Codec[K], values codec.Codec[V]) error {
+	return snapshot.Write(w, snapshot.PolicySLRU, c.export(), keys, values)
 }
 
-// evictFromProbation removes the LRU item from the probation segment.
-// This is only called when probationLen > probationCap, so probation is never empty.
-func (c *Cache[K, V]) evictFromProbation() {
-	lru := c.probationTail.prev
+// Restore replaces the cache's contents with a snapshot written by [Cache.Snapshot].
+//
+// The whole snapshot is read and verified before the cache is touched. A
+// corrupt, truncated or mismatched snapshot is rejected with a
+// [*cache.SnapshotError] and leaves the cache as it was.
+//
+// On success, existing entries are removed with [cache.ReasonCleared], entries
+// that expired since the snapshot was taken are dropped, and the rest return to
+// the segment they were saved from, in their saved order. If a segment exceeds
+// its current limit, entries are demoted and evicted as by [Cache.Resize], so
+// a snapshot can be restored into a cache of a different size or ratio.
+// Entries saved from a segment this cache does not have go to its most
+// protected segment.
+//
+// Example:
+//
+//	f, err := os.Open("pages.snap")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//
+//	return cache.Restore(f, keyCodec, pageCodec)
+func (c *Cache[K, V]) Restore(r io.Reader, keys codec.Codec[K], values codec.Codec[V]) error {
+	entries, err := snapshot.Read(r, snapshot.PolicySLRU, keys, values)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.removeAll(cache.ReasonCleared)
+
+	now := c.now().UnixNano()
+
+	top := c.segments.Len() - 1
+
+	// Entries are saved most recent first, so link them oldest first at the fronts.
+	for _, e := range slices.Backward(entries) {
+		n := &node[K, V]{key: e.Key, value: e.Value, expiresAt: e.ExpiresAt}
+		if n.expired(now) {
+			continue
+		}
+
+		c.items[n.key] = n
+		c.schedule(n)
+		c.segments.PushFront(n, min(int(e.Flags), top), c.weigh(n.key, n.value))
+	}
+
+	c.rebalance(nil)
+
+	return nil
+}
 
-	c.removeNode(lru)
-	c.probationLen--
+// All returns an iterator over the cache's entries: the protected segment from
+// most to least recently used, then the probation segment in the same order.
+// With more than two segments, they are visited from the most protected down.
+//
+// The entries are copied under the lock when iteration starts and yielded after
+// it is released, so the loop body may call back into the cache; changes made
+// during iteration are not reflected. Expired entries are skipped. Iterating
+// does not promote entries or affect recency.
+//
+// Example:
+//
+//	for key, page := range cache.All() {
+//	    fmt.Println(key, len(page))
+//	}
+func (c *Cache[K, V]) All() iter.Seq2[K, V] {
+	return iterate.Seq(func() []iterate.Entry[K, V] { return c.collect(false) })
+}
 
-	delete(c.items, lru.key)
+// Backward returns an iterator over the cache's entries in the reverse order of
+// [Cache.All]: probation from least to most recently used, then each protected
+// segment in the same order. This is the order entries would be evicted in.
+//
+// It has the same snapshot semantics as [Cache.All].
+func (c *Cache[K, V]) Backward() iter.Seq2[K, V] {
+	return iterate.Seq(func() []iterate.Entry[K, V] { return c.collect(true) })
 }
 
-// removeNode removes a node from its current linked list.
-func (c *Cache[K, V]) removeNode(n *node[K, V]) {
-	n.prev.next = n.next
-	n.next.prev = n.prev
+// Keys returns an iterator over the cache's keys, in the order of [Cache.All].
+func (c *Cache[K, V]) Keys() iter.Seq[K] {
+	return iterate.Keys(c.All())
 }
 
-// addToHead adds a node to the head of the specified segment's list.
-func (c *Cache[K, V]) addToHead(n *node[K, V], seg segment) {
-	var head *node[K, V]
+// Values returns an iterator over the cache's values, in the order of [Cache.All].
+func (c *Cache[K, V]) Values() iter.Seq[V] {
+	return iterate.Values(c.All())
+}
 
-	if seg == probation {
-		head = c.probationHead
-	} else {
-		head = c.protectedHead
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the node for key, removing it first if it has expired.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// removeEntry unlinks a node from its segment, drops it from the index, cancels
+// its expiration and queues a removal notification.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.segments.Remove(n)
+	delete(c.items, n.key)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// collect copies the live entries in the order of [Cache.All], or the reverse
+// when backward is set.
+func (c *Cache[K, V]) collect(backward bool) []iterate.Entry[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixNano()
+	entries := make([]iterate.Entry[K, V], 0, len(c.items))
+
+	appendLive := func(n *node[K, V]) {
+		if !n.expired(now) {
+			entries = append(entries, iterate.Entry[K, V]{Key: n.key, Value: n.value})
+		}
 	}
 
-	n.next = head.next
-	n.prev = head
-	head.next.prev = n
-	head.next = n
+	if backward {
+		for seg := range c.segments.Len() {
+			for n := c.segments.Back(seg); n != nil; n = n.Newer() {
+				appendLive(n)
+			}
+		}
+
+		return entries
+	}
+
+	for seg := c.segments.Len() - 1; seg >= probation; seg-- {
+		for n := c.segments.Front(seg); n != nil; n = n.Older() {
+			appendLive(n)
+		}
+	}
+
+	return entries
+}
+
+// removeAll removes every entry for reason, most protected entries first.
+// Must be called with lock held.
+func (c *Cache[K, V]) removeAll(reason cache.RemovalReason) {
+	for seg := c.segments.Len() - 1; seg >= probation; seg-- {
+		for n := c.segments.Front(seg); n != nil; n = n.Older() {
+			c.removeEntry(n, reason)
+		}
+	}
 }
 
-// moveToHead moves an existing node to the head of its segment's list.
-func (c *Cache[K, V]) moveToHead(n *node[K, V]) {
-	c.removeNode(n)
-	c.addToHead(n, n.segment)
+// export copies the live entries for a snapshot in the order of [Cache.All],
+// recording each entry's segment in its flags.
+func (c *Cache[K, V]) export() []snapshot.Entry[K, V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now().UnixNano()
+	entries := make([]snapshot.Entry[K, V], 0, len(c.items))
+
+	for seg := c.segments.Len() - 1; seg >= probation; seg-- {
+		for n := c.segments.Front(seg); n != nil; n = n.Older() {
+			if !n.expired(now) {
+				entries = append(entries, snapshot.Entry[K, V]{
+					Key:       n.key,
+					Value:     n.value,
+					ExpiresAt: n.expiresAt,
+					Flags:     uint8(seg),
+				})
+			}
+		}
+	}
+
+	return entries
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
+
+// rebalance restores the segment limits after keep was written or promoted,
+// or after a resize, in which case keep is nil.
+//
+// Protected overflow is demoted one segment down, from the most protected
+// segment to probation, and probation overflow is evicted from its LRU end.
+// keep itself is never evicted: if it is heavier than the probation segment on
+// its own, protected entries are evicted instead, least protected first, until
+// the cache as a whole fits. Without a weigher a promotion demotes at most one
+// item per segment and an insert evicts at most one, so probation never
+// overflows. Must be called with lock held.
+func (c *Cache[K, V]) rebalance(keep *node[K, V]) {
+	c.segments.DemoteOverflow(probation)
+
+	for n := c.segments.Back(probation); c.segments.Overflows(probation) && n != nil; {
+		newer := n.Newer()
+
+		if n != keep {
+			c.removeEntry(n, cache.ReasonEvicted)
+		}
+
+		n = newer
+	}
+
+	// Only keep is left in probation, so the rest of the weight is protected.
+	for seg := probation + 1; c.segments.Overflows(probation) && c.segments.Weight() > c.capacity; {
+		if lru := c.segments.Back(seg); lru != nil {
+			c.removeEntry(lru, cache.ReasonEvicted)
+		} else {
+			seg++
+		}
+	}
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
 }
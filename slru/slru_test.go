@@ -1,10 +1,17 @@
 package slru_test
 
 import (
+	"bytes"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/codec"
 	"github.com/serroba/cache/slru"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -495,3 +502,808 @@ func TestSLRUCache_DemoteTriggersProbationEviction(t *testing.T) {
 	// Total items should not exceed capacity
 	assert.LessOrEqual(t, c.Len(), 3)
 }
+
+func TestSLRUCache_SegmentedPromotesOneSegmentPerHit(t *testing.T) {
+	t.Parallel()
+
+	// Three segments of 2: an item needs two hits to reach the top.
+	c := slru.NewSegmented[string, int](6, []uint8{1, 1, 1})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+
+	// A scan only churns probation.
+	for i := range 10 {
+		c.Set(fmt.Sprintf("scan%d", i), i)
+	}
+
+	assert.Equal(t, []string{"a", "b", "scan9", "scan8"}, slices.Collect(c.Keys()))
+}
+
+func TestSLRUCache_SegmentedOverflowCascades(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	// One slot per segment.
+	c := slru.NewSegmented[string, int](3, []uint8{1, 1, 1}, record(&log))
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("a") // a at the top
+	c.Set("b", 2)
+	c.Get("b")
+	c.Get("b") // b takes the top, demoting a one segment
+
+	assert.Equal(t, []string{"b", "a"}, slices.Collect(c.Keys()))
+
+	c.Set("c", 3)
+	c.Get("c") // c takes the middle, demoting a to probation
+
+	assert.Equal(t, []string{"b", "c", "a"}, slices.Collect(c.Keys()))
+
+	c.Set("d", 4)
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+	assert.Equal(t, []string{"b", "c", "d"}, slices.Collect(c.Keys()))
+}
+
+func TestSLRUCache_SegmentedSingleSegmentIsLRU(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := slru.NewSegmented[string, int](3, []uint8{100}, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("d", 4)
+	c.Set("e", 5)
+
+	assert.Equal(t, []removal{
+		{"b", 2, cache.ReasonEvicted},
+		{"c", 3, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, []string{"e", "d", "a"}, slices.Collect(c.Keys()))
+}
+
+func TestSLRUCache_SegmentedEdgeCases(t *testing.T) {
+	t.Parallel()
+
+	for _, ratios := range [][]uint8{
+		nil,
+		{0, 0, 0},
+		{255, 255, 255, 255},
+		{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		make([]uint8, 300),
+	} {
+		c := slru.NewSegmented[int, int](10, ratios)
+
+		for i := range 200 {
+			c.Set(i%30, i)
+			c.Get(i % 7)
+			c.Get(i % 11)
+		}
+
+		assert.LessOrEqual(t, c.Len(), 10, "ratios=%v", ratios)
+		assert.Positive(t, c.Len(), "ratios=%v", ratios)
+	}
+}
+
+func TestSLRUCache_SegmentedTwoSegmentsKeepRatioSplit(t *testing.T) {
+	t.Parallel()
+
+	// Like NewWithRatio, two segments each get at least 1 slot, so with the
+	// whole capacity protected, probation's slot is one beyond it.
+	c := slru.NewSegmented[int, int](10, []uint8{0, 100})
+	d := slru.NewWithRatio[int, int](10, 100)
+
+	for i := range 200 {
+		for _, x := range []*slru.Cache[int, int]{c, d} {
+			x.Set(i%30, i)
+			x.Get(i % 7)
+			x.Get(i % 11)
+		}
+	}
+
+	assert.Equal(t, slices.Collect(d.Keys()), slices.Collect(c.Keys()))
+	assert.Equal(t, 11, c.Len())
+}
+
+func TestSLRUCache_SegmentedDefaultMatchesNew(t *testing.T) {
+	t.Parallel()
+
+	run := func(c *slru.Cache[int, int]) []int {
+		for i := range 500 {
+			c.Set(i%37, i)
+			c.Get(i % 13)
+			c.Get(i % 5)
+		}
+
+		return slices.Collect(c.Keys())
+	}
+
+	assert.Equal(t, run(slru.New[int, int](20)), run(slru.NewSegmented[int, int](20, nil)))
+	assert.Equal(t,
+		run(slru.NewWithRatio[int, int](20, 60)),
+		run(slru.NewSegmented[int, int](20, []uint8{40, 60})),
+	)
+}
+
+func TestSLRUCache_SegmentedWeightedEvictsLeastProtected(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	// Probation holds weight 2, the two protected segments 4 each.
+	c := slru.NewSegmented[string, int](10, []uint8{2, 4, 4}, weighByValue(), record(&log))
+	c.Set("top", 2)
+	c.Get("top")
+	c.Get("top")
+	c.Set("mid", 2)
+	c.Get("mid")
+
+	// Heavier than probation on its own: the cache makes room from the
+	// lowest protected segment first.
+	c.Set("x", 8)
+
+	assert.Equal(t, []removal{{"mid", 2, cache.ReasonEvicted}}, log)
+	assert.Equal(t, []string{"top", "x"}, slices.Collect(c.Keys()))
+	assert.Equal(t, uint64(10), c.Weight())
+}
+
+func TestSLRUCache_SegmentedResize(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := slru.NewSegmented[string, int](30, []uint8{1, 1, 1}, record(&log))
+
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(key, 0)
+		c.Get(key)
+		c.Get(key)
+	}
+
+	c.Set("p", 0)
+
+	// One slot per segment: c stays at the top, b is demoted one segment and
+	// a two, pushing p out of probation.
+	c.Resize(3)
+
+	assert.Equal(t, []string{"c", "b", "a"}, slices.Collect(c.Keys()))
+	assert.Equal(t, []removal{{"p", 0, cache.ReasonEvicted}}, log)
+}
+
+func TestSLRUCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := slru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	now = now.Add(time.Second)
+
+	_, ok = c.Get("a")
+	assert.False(t, ok, "expected 'a' to be expired")
+	assert.Equal(t, 1, c.Len(), "expired entry should be removed on access")
+
+	v, ok = c.Get("b")
+	require.True(t, ok, "entries without TTL never expire")
+	assert.Equal(t, 2, v)
+}
+
+func TestSLRUCache_PeekExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := slru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(time.Minute + 1)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestSLRUCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := slru.New[string, int](10,
+		cache.WithDefaultTTL[string, int](time.Minute),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, 0) // overrides the default: never expires
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok, "expected 'a' to expire after the default TTL")
+
+	_, ok = c.Get("b")
+	assert.True(t, ok, "expected 'b' to ignore the default TTL")
+}
+
+func TestSLRUCache_UpdateRefreshesTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := slru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Minute)
+
+	now = now.Add(30 * time.Second)
+	c.SetWithTTL("a", 2, time.Minute)
+
+	now = now.Add(45 * time.Second)
+
+	v, ok := c.Get("a")
+	require.True(t, ok, "expected update to reset the expiration")
+	assert.Equal(t, 2, v)
+
+	c.Set("a", 3) // no default TTL, so expiration is cleared
+
+	now = now.Add(time.Hour)
+
+	v, ok = c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestSLRUCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := slru.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	for _, key := range []string{"b", "c", "d"} {
+		_, ok = c.Peek(key)
+		assert.True(t, ok, "expected %q to survive the janitor", key)
+	}
+}
+
+func TestSLRUCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := slru.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close() // safe to call twice
+
+	// The cache stays usable after Close.
+	c.SetWithTTL("a", 1, time.Hour)
+	c.Delete("a")
+	c.Set("b", 2)
+
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+
+	// Close is a no-op without a janitor.
+	slru.New[string, int](10).Close()
+}
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestSLRUCache_OnEvictCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := slru.New[string, int](2, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	require.NotEmpty(t, log)
+	assert.Equal(t, removal{"a", 1, cache.ReasonEvicted}, log[0])
+}
+
+func TestSLRUCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := slru.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestSLRUCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := slru.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.ElementsMatch(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"b", 2, cache.ReasonCleared},
+	}, log)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("c", 3)
+
+	v, ok := c.Get("c")
+	require.True(t, ok, "cache should be usable after Clear")
+	assert.Equal(t, 3, v)
+}
+
+func TestSLRUCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *slru.Cache[string, int]
+
+	c = slru.New[string, int](2, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestSLRUCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := slru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	s := c.Stats()
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, s)
+	assert.InDelta(t, 1.0/3, s.HitRatio(), 1e-9)
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestSLRUCache_StatsEvictions(t *testing.T) {
+	t.Parallel()
+
+	c := slru.New[int, int](4)
+
+	for i := range 20 {
+		c.Set(i, i)
+	}
+
+	s := c.Stats()
+	assert.Equal(t, uint64(20), s.Sets)
+	assert.Equal(t, s.Sets-uint64(c.Len()), s.Evictions)
+}
+
+func TestSLRUCache_ConcurrentStats(t *testing.T) {
+	t.Parallel()
+
+	c := slru.New[int, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 10 {
+		wg.Add(2)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 100 {
+				c.Set(id*100+j, j)
+				c.Get(j)
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				c.Stats()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, uint64(1000), c.Stats().Requests())
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+func TestSLRUCache_WeightedEvictsUntilFits(t *testing.T) {
+	t.Parallel()
+
+	// 80/20 split: protected holds weight 16, probation weight 4.
+	c := slru.New[string, int](20, weighByValue())
+	c.Set("a", 1)
+	c.Set("b", 1)
+	c.Set("c", 1)
+	assert.Equal(t, uint64(3), c.Weight())
+
+	c.Set("d", 3)
+
+	assert.Equal(t, uint64(4), c.Weight())
+
+	for _, key := range []string{"a", "b"} {
+		_, ok := c.Peek(key)
+		assert.False(t, ok, key)
+	}
+
+	_, ok := c.Peek("c")
+	assert.True(t, ok)
+}
+
+func TestSLRUCache_WeightedHeavyEntryEvictsProtected(t *testing.T) {
+	t.Parallel()
+
+	// 80/20 split: protected holds weight 8, probation weight 2.
+	c := slru.New[string, int](10, weighByValue())
+	c.Set("p1", 4)
+	c.Get("p1")
+	c.Set("p2", 4)
+	c.Get("p2")
+
+	// Heavier than probation on its own: admitted, and the cache as a whole
+	// makes room by evicting the least recently used protected entry.
+	c.Set("x", 5)
+
+	v, ok := c.Peek("x")
+	require.True(t, ok)
+	assert.Equal(t, 5, v)
+
+	_, ok = c.Peek("p1")
+	assert.False(t, ok)
+	_, ok = c.Peek("p2")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(9), c.Weight())
+}
+
+func TestSLRUCache_WeightedPromotionDemotes(t *testing.T) {
+	t.Parallel()
+
+	// 50/50 split: both segments hold weight 8.
+	c := slru.NewWithRatio[string, int](16, 50, weighByValue())
+	c.Set("a", 4)
+	c.Get("a")
+	c.Set("b", 4)
+	c.Get("b")
+	c.Set("d", 2)
+	c.Set("c", 6)
+
+	// Promoting c overflows protected, demoting both a and b into probation,
+	// which then evicts its least recently used entry, d, to fit.
+	c.Get("c")
+
+	assert.Equal(t, uint64(14), c.Weight())
+
+	_, ok := c.Peek("d")
+	assert.False(t, ok)
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, ok := c.Peek(key)
+		assert.True(t, ok, key)
+	}
+}
+
+func TestSLRUCache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := slru.New[string, int](10, weighByValue(), record(&log))
+	c.Set("a", 2)
+	c.Set("big", 11)
+	c.Set("a", 20)
+
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+	assert.Equal(t, []removal{
+		{"big", 11, cache.ReasonEvicted},
+		{"a", 2, cache.ReasonReplaced},
+		{"a", 20, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestSLRUCache_Resize(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := slru.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Get("b")
+	c.Set("c", 3)
+	c.Set("d", 4)
+
+	// 4 protected, 1 probation: probation overflows and loses c.
+	c.Resize(5)
+
+	assert.Equal(t, []removal{{"c", 3, cache.ReasonEvicted}}, log)
+
+	// 1 protected, 1 probation: a is demoted, pushing d out of probation.
+	c.Resize(2)
+
+	assert.Equal(t, []removal{
+		{"c", 3, cache.ReasonEvicted},
+		{"d", 4, cache.ReasonEvicted},
+	}, log)
+
+	for _, key := range []string{"a", "b"} {
+		_, ok := c.Peek(key)
+		assert.True(t, ok, key)
+	}
+
+	c.Resize(100)
+
+	// 80 protected, 20 probation, which already holds a.
+	for i := range 19 {
+		c.Set(fmt.Sprintf("key%d", i), i)
+	}
+
+	assert.Equal(t, 21, c.Len(), "growing should enlarge probation too")
+	assert.Len(t, log, 2)
+}
+
+func TestSLRUCache_All(t *testing.T) {
+	t.Parallel()
+
+	c := slru.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Get("b")
+	c.Set("x", 3)
+	c.Set("y", 4)
+
+	// Protected MRU to LRU, then probation MRU to LRU.
+	assert.Equal(t, []string{"b", "a", "y", "x"}, slices.Collect(c.Keys()))
+	assert.Equal(t, []int{2, 1, 4, 3}, slices.Collect(c.Values()))
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "x": 3, "y": 4}, maps.Collect(c.All()))
+
+	var backward []string
+	for k := range c.Backward() {
+		backward = append(backward, k)
+	}
+
+	assert.Equal(t, []string{"x", "y", "a", "b"}, backward)
+}
+
+func TestSLRUCache_AllDoesNotPromote(t *testing.T) {
+	t.Parallel()
+
+	c := slru.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	_ = maps.Collect(c.All())
+
+	// Both entries are still in probation, which holds 2, so a third evicts a.
+	c.Set("c", 3)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestSLRUCache_AllSkipsExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := slru.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+	c.Get("a")
+
+	now = now.Add(time.Second)
+
+	assert.Equal(t, []string{"b"}, slices.Collect(c.Keys()))
+}
+
+func TestSLRUCache_SnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	src := slru.New[string, int](10)
+	src.Set("a", 1)
+	src.Set("b", 2)
+	src.Get("a")
+	src.Get("b")
+	src.Set("x", 3)
+	src.Set("y", 4)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	dst := slru.New[string, int](10)
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, slices.Collect(src.Keys()), slices.Collect(dst.Keys()))
+
+	// a and b came back protected: a probation burst cannot evict them.
+	for i := range 5 {
+		dst.Set(fmt.Sprintf("scan%d", i), i)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		_, ok := dst.Peek(key)
+		assert.True(t, ok, key)
+	}
+}
+
+func TestSLRUCache_RestoreIntoSmallerCache(t *testing.T) {
+	t.Parallel()
+
+	src := slru.New[string, int](100)
+	for i, key := range []string{"a", "b", "c"} {
+		src.Set(key, i)
+		src.Get(key)
+	}
+
+	src.Set("p", 9)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	// 1 protected, 1 probation: c stays protected, b is demoted, a and p are evicted.
+	var log []removal
+
+	dst := slru.New[string, int](2, record(&log))
+	require.NoError(t, dst.Restore(&buf, codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, []string{"c", "b"}, slices.Collect(dst.Keys()))
+	assert.ElementsMatch(t, []removal{
+		{"a", 0, cache.ReasonEvicted},
+		{"p", 9, cache.ReasonEvicted},
+	}, log)
+}
+
+func TestSLRUCache_RestoreRejectsCorruption(t *testing.T) {
+	t.Parallel()
+
+	src := slru.New[string, int](10)
+	src.Set("a", 1)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+
+	dst := slru.New[string, int](10)
+	err := dst.Restore(bytes.NewReader(data), codec.String{}, codec.Varint[int]{})
+
+	var snapErr *cache.SnapshotError
+	require.ErrorAs(t, err, &snapErr)
+	assert.Equal(t, cache.ErrSnapshotChecksum, snapErr.Kind)
+}
+
+func TestSLRUCache_RestoreAcrossSegmentCounts(t *testing.T) {
+	t.Parallel()
+
+	src := slru.NewSegmented[string, int](9, []uint8{1, 1, 1})
+	src.Set("top", 1)
+	src.Get("top")
+	src.Get("top")
+	src.Set("mid", 2)
+	src.Get("mid")
+	src.Set("new", 3)
+
+	var buf bytes.Buffer
+
+	require.NoError(t, src.Snapshot(&buf, codec.String{}, codec.Varint[int]{}))
+
+	// The two-segment cache has no third segment, so "top" joins "mid" in protected.
+	dst := slru.New[string, int](10)
+	require.NoError(t, dst.Restore(bytes.NewReader(buf.Bytes()), codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, []string{"top", "mid", "new"}, slices.Collect(dst.Keys()))
+
+	for i := range 5 {
+		dst.Set(fmt.Sprintf("scan%d", i), i)
+	}
+
+	for _, key := range []string{"top", "mid"} {
+		_, ok := dst.Peek(key)
+		assert.True(t, ok, key)
+	}
+
+	// A cache with more segments keeps every entry where it was saved.
+	wide := slru.NewSegmented[string, int](9, []uint8{1, 1, 1, 1})
+	require.NoError(t, wide.Restore(bytes.NewReader(buf.Bytes()), codec.String{}, codec.Varint[int]{}))
+
+	assert.Equal(t, []string{"top", "mid", "new"}, slices.Collect(wide.Keys()))
+}
@@ -0,0 +1,58 @@
+package cache
+
+import "errors"
+
+// Sentinel errors describing why a snapshot could not be restored.
+//
+// Restore methods return them wrapped in a [*SnapshotError], so callers can
+// test for a specific failure with [errors.Is].
+var (
+	// ErrSnapshotFormat means the data is not a snapshot or is truncated or malformed.
+	ErrSnapshotFormat = errors.New("cache: malformed snapshot")
+
+	// ErrSnapshotVersion means the snapshot was written in a format version
+	// this build does not understand.
+	ErrSnapshotVersion = errors.New("cache: unsupported snapshot version")
+
+	// ErrSnapshotChecksum means the snapshot's contents do not match its checksum.
+	ErrSnapshotChecksum = errors.New("cache: snapshot checksum mismatch")
+
+	// ErrSnapshotPolicy means the snapshot was written by a different eviction policy.
+	ErrSnapshotPolicy = errors.New("cache: snapshot written by a different policy")
+)
+
+// SnapshotError is returned when a snapshot is rejected during Restore.
+//
+// The cache is left untouched when a snapshot is rejected.
+//
+// Example:
+//
+//	if err := c.Restore(f, keys, values); errors.Is(err, cache.ErrSnapshotChecksum) {
+//	    log.Printf("ignoring corrupt snapshot: %v", err)
+//	}
+type SnapshotError struct {
+	// Kind is one of ErrSnapshotFormat, ErrSnapshotVersion, ErrSnapshotChecksum
+	// or ErrSnapshotPolicy.
+	Kind error
+
+	// Err is the underlying cause, such as a codec error, or nil.
+	Err error
+}
+
+// Error describes the failure, including the underlying cause if any.
+func (e *SnapshotError) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns Kind and, if set, Err, so [errors.Is] matches either.
+func (e *SnapshotError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+
+	return []error{e.Kind, e.Err}
+}
@@ -0,0 +1,69 @@
+package cache
+
+// Stats is a point-in-time snapshot of a cache's counters.
+//
+// Counters start at zero when the cache is created and can be reset with the
+// cache's ResetStats method. Peek and Clear are not counted.
+type Stats struct {
+	// Hits is the number of Get calls that found a live entry.
+	Hits uint64
+
+	// Misses is the number of Get calls that found no entry or an expired one.
+	Misses uint64
+
+	// Sets is the number of Set calls that inserted a new key.
+	Sets uint64
+
+	// Updates is the number of Set calls that overwrote an existing key.
+	Updates uint64
+
+	// Evictions is the number of entries removed by the policy to make room.
+	Evictions uint64
+
+	// Deletions is the number of entries removed by Delete.
+	Deletions uint64
+
+	// Expirations is the number of entries removed because their TTL elapsed.
+	Expirations uint64
+}
+
+// StatsReporter is implemented by caches that keep [Stats].
+//
+// Every eviction policy in this module implements it; wrappers such as the
+// sharded cache use it to aggregate statistics from the caches they hold.
+type StatsReporter interface {
+	// Stats returns a snapshot of the cache's counters.
+	Stats() Stats
+
+	// ResetStats sets all counters back to zero.
+	ResetStats()
+}
+
+// Add returns the field-wise sum of s and other.
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		Hits:        s.Hits + other.Hits,
+		Misses:      s.Misses + other.Misses,
+		Sets:        s.Sets + other.Sets,
+		Updates:     s.Updates + other.Updates,
+		Evictions:   s.Evictions + other.Evictions,
+		Deletions:   s.Deletions + other.Deletions,
+		Expirations: s.Expirations + other.Expirations,
+	}
+}
+
+// Requests returns the total number of Get calls, Hits plus Misses.
+func (s Stats) Requests() uint64 {
+	return s.Hits + s.Misses
+}
+
+// HitRatio returns the fraction of Get calls that were hits, in [0, 1].
+// It returns 0 when there have been no requests.
+func (s Stats) HitRatio() float64 {
+	requests := s.Requests()
+	if requests == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(requests)
+}
@@ -0,0 +1,645 @@
+// Package tinylfu provides a thread-safe W-TinyLFU cache implementation.
+//
+// # When to Use W-TinyLFU
+//
+// Use W-TinyLFU when access frequencies are skewed and a stream of keys that
+// are requested once would otherwise push popular entries out of an LRU cache.
+// It is usually the best general-purpose choice in this module for:
+//   - Zipf-like workloads such as web, API and database object caches
+//   - Caches hit by crawlers, batch jobs or other one-off scans
+//   - Workloads where the hot set changes slowly over time
+//
+// # How W-TinyLFU Works
+//
+// The cache has two regions:
+//   - Window: a small LRU (1% of capacity) that every new key enters
+//   - Main: an SLRU with probation and protected segments (80% of main is
+//     protected), built on the same segments as [github.com/serroba/cache/slru]
+//
+// When the window overflows, its least recently used entry becomes a candidate
+// for the main region. If main is full, the candidate is compared with main's
+// eviction victim, the least recently used probation entry, and only the one
+// that has been accessed more often stays. Access frequencies come from a
+// compact Count-Min Sketch guarded by a doorkeeper Bloom filter, and are halved
+// periodically so that keys that were popular long ago can be replaced.
+//
+// The window lets a burst of new keys build up frequency before competing for
+// a place in main, while the admission filter stops keys seen only once from
+// displacing entries that are used over and over.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1). The frequency sketch
+// adds about one byte per unit of capacity, or per entry with a weigher.
+//
+// # Weighted Capacity
+//
+// By default capacity counts entries. With [cache.WithWeigher], it bounds the
+// total weight instead, and the window and both main segments are measured in
+// weight. A candidate leaving the window may then have to displace several of
+// main's victims, least recently used probation entries first: it is compared
+// with each in turn, every victim it beats is evicted, and as soon as one is
+// used at least as often, the candidate is evicted instead. An entry heavier
+// than the main region is never admitted.
+//
+// The frequency sketch cannot be sized by a weight, so it is sized for the
+// number of entries and grown twice as large whenever the cache outgrows it.
+// Growing keeps the recorded frequencies, so popular keys keep winning
+// admission across a resize.
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+// Candidates rejected by the admission filter count as evictions.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why,
+// including candidates rejected by the admission filter. The listener runs after
+// the cache's lock is released, so it may call back into the cache.
+//
+// # Example Usage
+//
+//	cache := tinylfu.New[string, int](1000)
+//	cache.Set("key", 42)  // Enters the window
+//	cache.Get("key")      // Counts towards "key"'s admission to main
+package tinylfu
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/segment"
+	"github.com/serroba/cache/internal/sketch"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+// The window and the main region's two segments share one segment stack.
+// Promotion takes probation entries to protected, and only protected demotes
+// into probation; the window is never promoted from or demoted into.
+const (
+	window = iota
+	probation
+	protected
+)
+
+const (
+	// windowPercent is the share of capacity given to the admission window.
+	windowPercent = 1
+
+	// protectedPercent is the share of the main region given to its protected segment.
+	protectedPercent = 80
+
+	// weightedSketchSize is the number of entries the frequency sketch is
+	// first sized for when capacity is a weight.
+	weightedSketchSize = 64
+)
+
+type node[K comparable, V any] struct {
+	segment.Links[*node[K, V]]
+
+	key       K
+	value     V
+	hash      uint64
+	expiresAt int64 // unix nanoseconds, 0 means no expiration
+	timer     wheel.Timer[*node[K, V]]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// Cache implements a W-TinyLFU cache: an LRU admission window in front of a
+// segmented LRU main region, guarded by a frequency-based admission filter.
+//
+// New items enter the window. Items leaving the window are admitted to the main
+// region only if they have been accessed more often than the item they would
+// displace, which keeps one-hit wonders from evicting popular entries.
+//
+// The zero value is not usable; create instances with [New].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	items    map[K]*node[K, V]
+	segments segment.Stack[*node[K, V]] // window, probation, protected
+
+	capacity uint64
+	weigher  func(K, V) uint64
+
+	seed       maphash.Seed
+	frequency  *sketch.Frequency
+	sketchSize uint64 // number of entries the sketch is sized for
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new W-TinyLFU cache that holds up to capacity items, or items
+// of up to capacity total weight with [cache.WithWeigher].
+//
+// The capacity is divided as:
+//   - Window: 1%, at least 1 item
+//   - Main protected segment: 80% of the rest
+//   - Main probation segment: the remainder
+//
+// Options such as [cache.WithDefaultTTL] are applied in order.
+//
+// Example:
+//
+//	cache := tinylfu.New[string, *Page](10000)  // 100 window, 7920 protected, 1980 probation
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+
+	windowCap := capacity * windowPercent / 100
+	if windowCap == 0 && capacity > 0 {
+		windowCap = 1
+	}
+
+	mainCap := capacity - windowCap
+	protectedCap := mainCap * protectedPercent / 100
+
+	sketchSize := capacity
+	if o.Weigher != nil {
+		sketchSize = weightedSketchSize
+	}
+
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		segments:   segment.NewStack[*node[K, V]](3),
+		capacity:   capacity,
+		weigher:    o.Weigher,
+		seed:       maphash.MakeSeed(),
+		frequency:  sketch.New(sketchSize),
+		sketchSize: sketchSize,
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	c.segments.SetCapacity(window, windowCap)
+	c.segments.SetCapacity(probation, mainCap-protectedCap)
+	c.segments.SetCapacity(protected, protectedCap)
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - New keys: added to the window; the window's least recently used item may
+//     then be admitted to the main region or evicted
+//   - Existing keys: value updated in place and treated like a [Cache.Get] hit
+//   - Entries that outweigh the whole cache: not stored (see [cache.WithWeigher])
+//
+// Writing a key counts as an access for the admission filter. The overwritten
+// value of an existing key is reported to the [cache.OnEvict] listener with
+// [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set("page:1", pageData)   // Enters the window
+//	cache.Set("page:1", newData)    // Updates value, moves to the front of the window
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("page:1", pageData, 5*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	// Without a weigher this only rejects every entry of a zero-capacity cache.
+	weight := c.weigh(key, value)
+	if weight > c.capacity {
+		c.reject(key, value)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+		c.frequency.Increment(n.hash)
+
+		c.segments.Reweigh(n, weight)
+		n.value = value
+		n.expiresAt = expiresAt
+		c.schedule(n)
+		c.moveToFront(n)
+		// A protected entry that got heavier may push protected over its limit.
+		c.segments.DemoteOverflow(probation)
+		c.shrinkMain()
+		c.evict()
+
+		return
+	}
+
+	n := &node[K, V]{key: key, value: value, hash: maphash.Comparable(c.seed, key), expiresAt: expiresAt}
+	c.items[key] = n
+	c.schedule(n)
+	c.stats.RecordSet()
+	c.frequency.Increment(n.hash)
+	c.segments.PushFront(n, window, weight)
+	c.evict()
+	c.growSketch()
+}
+
+// weigh returns the weight of an entry, which is 1 when no weigher is configured.
+func (c *Cache[K, V]) weigh(key K, value V) uint64 {
+	if c.weigher == nil {
+		return 1
+	}
+
+	return c.weigher(key, value)
+}
+
+// reject handles an entry heavier than the whole cache as if it were inserted
+// and immediately evicted, dropping any older value stored under key.
+// Must be called with lock held.
+func (c *Cache[K, V]) reject(key K, value V) {
+	if n, ok := c.lookup(key); ok {
+		c.removeEntry(n, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+	} else {
+		c.stats.RecordSet()
+	}
+
+	c.removals.Push(key, value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+}
+
+// Get retrieves a value and marks it as recently used.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Every call, hit or miss, counts as an access for the admission filter, so a
+// key that keeps being requested is admitted once it is set. A hit in the
+// probation segment promotes the item to protected; if protected is full, its
+// least recently used item is demoted back to probation. Use [Cache.Peek] to
+// read without affecting eviction.
+//
+// Example:
+//
+//	if page, ok := cache.Get("page:1"); ok {
+//	    render(page)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.frequency.Increment(maphash.Comparable(c.seed, key))
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	c.frequency.Increment(n.hash)
+	c.moveToFront(n)
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// Peek retrieves a value without marking it as used.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Unlike [Cache.Get], this neither counts as an access for the admission filter
+// nor changes the item's recency or segment.
+//
+// Example:
+//
+//	if data, ok := cache.Peek("page:1"); ok {
+//	    // Item found, eviction order unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		return n.value, true
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache, regardless of which region it's in.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted]. The key's access frequency is kept, so
+// setting it again soon competes for admission as before.
+//
+// Example:
+//
+//	cache.Delete("page:1")
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the total number of items in the window and main regions.
+//
+// Expired entries that have not been removed yet are still counted.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.items)
+}
+
+// Weight returns the total weight of the items in the window and main regions.
+//
+// Without [cache.WithWeigher] every item weighs 1, so Weight equals [Cache.Len].
+//
+// Example:
+//
+//	fmt.Printf("Cache holds %d of %d bytes\n", cache.Weight(), maxBytes)
+func (c *Cache[K, V]) Weight() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.segments.Weight()
+}
+
+// Clear removes every entry and forgets all recorded access frequencies.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared].
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for _, seg := range []int{protected, probation, window} {
+		for n := c.segments.Front(seg); n != nil; n = n.Older() {
+			c.removeEntry(n, cache.ReasonCleared)
+		}
+	}
+
+	c.frequency.Reset()
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+//
+// Access frequencies used for admission are not affected.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the node for key, removing it first if it has expired.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// evict moves items out of the window once it is over its limit, admitting
+// each one to the main region if there is room or if it is used more often
+// than main's victims, and evicting the losers.
+// Must be called with lock held.
+func (c *Cache[K, V]) evict() {
+	for c.segments.Overflows(window) {
+		c.admit(c.segments.Back(window))
+	}
+}
+
+// admit moves a candidate from the window to the front of probation, first
+// evicting main's victims, least recently used probation entries first, for as
+// long as the main region is full and the candidate is used more often than
+// the victim. A candidate that loses, or that outweighs the main region, is
+// evicted instead. Must be called with lock held.
+func (c *Cache[K, V]) admit(candidate *node[K, V]) {
+	if candidate.Weight() > c.mainCapacity() {
+		c.removeEntry(candidate, cache.ReasonEvicted)
+
+		return
+	}
+
+	for c.mainWeight()+candidate.Weight() > c.mainCapacity() {
+		victim := c.segments.Back(probation)
+		if victim == nil {
+			victim = c.segments.Back(protected)
+		}
+
+		if c.frequency.Estimate(candidate.hash) <= c.frequency.Estimate(victim.hash) {
+			c.removeEntry(candidate, cache.ReasonEvicted)
+
+			return
+		}
+
+		c.removeEntry(victim, cache.ReasonEvicted)
+	}
+
+	c.segments.Move(candidate, probation)
+}
+
+// shrinkMain evicts from the least recently used end of probation, then of
+// protected, until the main region fits its limit again after an update made
+// one of its entries heavier. Must be called with lock held.
+func (c *Cache[K, V]) shrinkMain() {
+	for c.mainWeight() > c.mainCapacity() {
+		victim := c.segments.Back(probation)
+		if victim == nil {
+			victim = c.segments.Back(protected)
+		}
+
+		c.removeEntry(victim, cache.ReasonEvicted)
+	}
+}
+
+// mainWeight returns the total weight of the main region's entries.
+func (c *Cache[K, V]) mainWeight() uint64 {
+	return c.segments.SegmentWeight(probation) + c.segments.SegmentWeight(protected)
+}
+
+// mainCapacity returns the limit of the main region.
+func (c *Cache[K, V]) mainCapacity() uint64 {
+	return c.segments.Capacity(probation) + c.segments.Capacity(protected)
+}
+
+// growSketch grows the frequency sketch twice as large once the cache holds
+// more entries than it was sized for, which only happens with a weigher.
+// Must be called with lock held.
+func (c *Cache[K, V]) growSketch() {
+	if uint64(len(c.items)) <= c.sketchSize {
+		return
+	}
+
+	c.sketchSize *= 2
+	c.frequency.Grow(c.sketchSize)
+}
+
+// moveToFront marks n as most recently used within its region, promoting
+// probation items to protected and demoting protected overflow to probation.
+// Must be called with lock held.
+func (c *Cache[K, V]) moveToFront(n *node[K, V]) {
+	if n.Segment() != probation {
+		c.segments.MoveToFront(n)
+
+		return
+	}
+
+	c.segments.Promote(n)
+	c.segments.DemoteOverflow(probation)
+}
+
+// removeEntry unlinks a node from its segment, drops it from the index, cancels
+// its expiration and queues a removal notification.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.segments.Remove(n)
+	delete(c.items, n.key)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
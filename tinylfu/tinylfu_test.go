@@ -0,0 +1,623 @@
+package tinylfu_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/tinylfu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTinyLFUCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestTinyLFUCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Get("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestTinyLFUCache_FillsToCapacity(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[int, int](100)
+
+	for i := range 100 {
+		c.Set(i, i)
+	}
+
+	assert.Equal(t, 100, c.Len())
+
+	for i := range 100 {
+		_, ok := c.Peek(i)
+		assert.True(t, ok, "expected %d to be cached", i)
+	}
+
+	c.Set(100, 100)
+	assert.Equal(t, 100, c.Len())
+}
+
+func TestTinyLFUCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestTinyLFUCache_Peek(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[string, int](10)
+	c.Set("a", 1)
+
+	v, ok := c.Peek("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	_, ok = c.Peek("missing")
+	assert.False(t, ok)
+}
+
+func TestTinyLFUCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("b") // promoted into main
+
+	assert.True(t, c.Delete("a"))
+	assert.True(t, c.Delete("b"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestTinyLFUCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := tinylfu.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestTinyLFUCache_AdmissionRejectsUnpopularCandidate(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := tinylfu.New[string, int](2, record(&log)) // 1 window, 1 main
+
+	c.Set("a", 1)
+	c.Set("b", 2) // "a" moves to the empty main region
+	c.Set("c", 3) // "b" is no more popular than "a", so it is dropped
+
+	assert.Equal(t, []removal{{"b", 2, cache.ReasonEvicted}}, log)
+
+	_, ok := c.Peek("a")
+	assert.True(t, ok)
+}
+
+func TestTinyLFUCache_AdmissionAcceptsPopularCandidate(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[int, int](100)
+
+	for i := range 100 {
+		c.Set(i, i)
+	}
+
+	for range 5 {
+		c.Get(1000) // misses still count towards admission
+	}
+
+	c.Set(1000, 1000)
+	c.Set(1001, 1001) // pushes 1000 out of the window and into main
+
+	_, ok := c.Peek(1000)
+	assert.True(t, ok)
+	assert.Equal(t, 100, c.Len())
+}
+
+func TestTinyLFUCache_OneHitWondersDoNotEvictHotSet(t *testing.T) {
+	t.Parallel()
+
+	const hot = 50
+
+	tiny := tinylfu.New[string, int](100)
+	plain := lru.New[string, int](100)
+
+	for _, c := range []cache.Cache[string, int]{tiny, plain} {
+		for round := range 20 {
+			for i := range hot {
+				key := fmt.Sprintf("hot%d", i)
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, i)
+				}
+			}
+
+			for i := range 200 {
+				c.Set(fmt.Sprintf("cold%d-%d", round, i), i)
+			}
+		}
+	}
+
+	survivors := func(c cache.Cache[string, int]) int {
+		n := 0
+
+		for i := range hot {
+			if _, ok := c.Peek(fmt.Sprintf("hot%d", i)); ok {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	assert.Equal(t, 0, survivors(plain), "a scan larger than the cache flushes LRU")
+	assert.GreaterOrEqual(t, survivors(tiny), hot*9/10)
+}
+
+func TestTinyLFUCache_ZipfHitRatioBeatsLRU(t *testing.T) {
+	t.Parallel()
+
+	tiny := tinylfu.New[uint64, uint64](500)
+	plain := lru.New[uint64, uint64](500)
+
+	for _, c := range []cache.Cache[uint64, uint64]{tiny, plain} {
+		zipf := rand.NewZipf(rand.New(rand.NewPCG(1, 2)), 1.01, 1, 100000)
+
+		for range 200000 {
+			key := zipf.Uint64()
+			if _, ok := c.Get(key); !ok {
+				c.Set(key, key)
+			}
+		}
+	}
+
+	tinyRatio, lruRatio := tiny.Stats().HitRatio(), plain.Stats().HitRatio()
+	assert.Greater(t, tinyRatio, lruRatio+0.05, "tinylfu %.3f, lru %.3f", tinyRatio, lruRatio)
+}
+
+func TestTinyLFUCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := tinylfu.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestTinyLFUCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := tinylfu.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestTinyLFUCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := tinylfu.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestTinyLFUCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	tinylfu.New[string, int](10).Close()
+}
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestTinyLFUCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := tinylfu.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestTinyLFUCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := tinylfu.New[string, int](10, record(&log))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.ElementsMatch(t, []removal{
+		{"a", 1, cache.ReasonCleared},
+		{"b", 2, cache.ReasonCleared},
+	}, log)
+
+	c.Set("c", 3)
+
+	v, ok := c.Get("c")
+	require.True(t, ok)
+	assert.Equal(t, 3, v)
+}
+
+func TestTinyLFUCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *tinylfu.Cache[string, int]
+
+	c = tinylfu.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestTinyLFUCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := tinylfu.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestTinyLFUCache_StatsEvictions(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[int, int](10)
+
+	for i := range 25 {
+		c.Set(i, i)
+	}
+
+	assert.Equal(t, uint64(15), c.Stats().Evictions)
+	assert.Equal(t, 10, c.Len())
+}
+
+func TestTinyLFUCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[string, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
+
+func weighByValue() cache.Option[string, int] {
+	return cache.WithWeigher(func(_ string, value int) uint64 { return uint64(value) })
+}
+
+func TestTinyLFUCache_WeightedAdmissionEvictsSeveralVictims(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	// A window of 1 and a main region of 99.
+	c := tinylfu.New[string, int](100, weighByValue(), record(&log))
+	c.Set("a", 30)
+	c.Set("b", 30)
+	c.Set("c", 30)
+	assert.Equal(t, uint64(90), c.Weight())
+
+	// Seen once, like every victim, so the candidate loses.
+	c.Set("d", 40)
+	assert.Equal(t, []removal{{"d", 40, cache.ReasonEvicted}}, log)
+
+	// Seen twice, it beats both victims it needs room from.
+	log = nil
+	c.Set("d", 40)
+
+	assert.Equal(t, []removal{
+		{"a", 30, cache.ReasonEvicted},
+		{"b", 30, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, uint64(70), c.Weight())
+
+	_, ok := c.Peek("d")
+	assert.True(t, ok)
+}
+
+func TestTinyLFUCache_WeightedUpdateShrinksMain(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := tinylfu.New[string, int](100, weighByValue(), record(&log))
+	c.Set("a", 30)
+	c.Set("b", 30)
+	c.Set("c", 30)
+
+	// The update promotes "a" and evicts probation's oldest entry for room.
+	c.Set("a", 50)
+
+	assert.Equal(t, []removal{
+		{"a", 30, cache.ReasonReplaced},
+		{"b", 30, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, uint64(80), c.Weight())
+
+	v, ok := c.Peek("a")
+	require.True(t, ok)
+	assert.Equal(t, 50, v)
+}
+
+func TestTinyLFUCache_WeightedRejectsOversized(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := tinylfu.New[string, int](100, weighByValue(), record(&log))
+	c.Set("a", 101) // heavier than the cache
+	c.Set("b", 100) // fits the cache but not the main region
+	c.Set("c", 5)
+	c.Set("c", 200)
+
+	assert.Equal(t, []removal{
+		{"a", 101, cache.ReasonEvicted},
+		{"b", 100, cache.ReasonEvicted},
+		{"c", 5, cache.ReasonReplaced},
+		{"c", 200, cache.ReasonEvicted},
+	}, log)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, uint64(0), c.Weight())
+}
+
+func TestTinyLFUCache_WeightedHoldsManyLightEntries(t *testing.T) {
+	t.Parallel()
+
+	// Far more entries than the sketch is first sized for.
+	c := tinylfu.New[string, int](1000, weighByValue())
+
+	for i := range 500 {
+		c.Set(fmt.Sprint(i), 1)
+	}
+
+	assert.Equal(t, 500, c.Len())
+	assert.Equal(t, uint64(500), c.Weight())
+
+	for i := range 500 {
+		_, ok := c.Peek(fmt.Sprint(i))
+		assert.True(t, ok, "expected %d to be cached", i)
+	}
+}
+
+func TestTinyLFUCache_WeightedHeavierProtectedEntryDemotes(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	// Protected holds 79 of the main region's 99.
+	c := tinylfu.New[string, int](100, weighByValue(), record(&log))
+	c.Set("a", 30)
+	c.Set("b", 30)
+	c.Set("c", 10)
+	c.Get("a")
+	c.Get("b")
+
+	// Protected now weighs 80, so its least recently used entry, "b", is
+	// demoted to probation, ahead of "d".
+	c.Set("a", 50)
+	c.Set("d", 9)
+
+	// "e" beats "c", then loses to "b", which was seen twice; "d" would have
+	// been its next victim had "b" stayed in protected.
+	c.Set("e", 20)
+	c.Set("e", 20)
+
+	assert.Equal(t, []removal{
+		{"a", 30, cache.ReasonReplaced},
+		{"e", 20, cache.ReasonEvicted},
+		{"c", 10, cache.ReasonEvicted},
+		{"e", 20, cache.ReasonEvicted},
+	}, log)
+
+	_, ok := c.Peek("d")
+	assert.True(t, ok)
+}
+
+func TestTinyLFUCache_WeightedSketchGrowthKeepsFrequencies(t *testing.T) {
+	t.Parallel()
+
+	c := tinylfu.New[string, int](100, weighByValue())
+
+	for range 5 {
+		c.Get("hot")
+	}
+
+	c.Set("v", 60)
+
+	// Weightless entries grow the cache past the size of its frequency sketch.
+	for i := range 64 {
+		c.Set(fmt.Sprint(i), 0)
+	}
+
+	for i := range 64 {
+		c.Delete(fmt.Sprint(i))
+	}
+
+	c.Get("v")
+
+	// "hot" needs v's room, and its earlier misses still count.
+	c.Set("hot", 50)
+
+	_, ok := c.Peek("hot")
+	assert.True(t, ok)
+
+	_, ok = c.Peek("v")
+	assert.False(t, ok)
+}
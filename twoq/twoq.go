@@ -0,0 +1,592 @@
+// Package twoq provides a thread-safe 2Q cache implementation.
+//
+// # When to Use 2Q
+//
+// Use 2Q when you want SLRU-style scan resistance but keys are typically
+// requested again only after a while, rather than right after their first use.
+// This is ideal for:
+//   - Database buffer pools and page caches
+//   - Caches hit by periodic batch jobs or crawlers
+//   - Workloads where the first few requests for a key arrive in a burst
+//
+// # How 2Q Works
+//
+// The cache is divided into three queues:
+//   - A1in: a FIFO that every new key enters (default 25% of capacity)
+//   - A1out: a ghost FIFO remembering only the keys recently evicted from
+//     A1in (default 50% of capacity, in keys)
+//   - Am: an LRU of keys that were requested again after leaving A1in
+//
+// Requests for a key still in A1in are assumed to be correlated with its first
+// use and do not promote it. A key set again while A1out still remembers it has
+// proven itself over a longer period and goes straight to Am. When the cache is
+// full, A1in gives up its oldest entry if it is over its share, and Am its least
+// recently used entry otherwise, so one-off keys never displace Am.
+//
+// # Thread Safety
+//
+// All methods are safe for concurrent use. The cache uses a mutex internally.
+//
+// # Performance
+//
+// All operations (Get, Set, Delete, Peek, Len) are O(1).
+//
+// # Weighted Capacity
+//
+// 2Q does not support [cache.WithWeigher], and [New] and [NewWithRatio] panic
+// if given one. A1out holds keys without values, so it has no weight to count,
+// and its size is what decides how long a key may go unused and still reach
+// Am on its second request; measured in weight, that window would shrink
+// whenever large values passed through A1in. For entries of very different
+// sizes that should also resist one-off scans, use
+// [github.com/serroba/cache/s3fifo].
+//
+// # Expiration
+//
+// Entries can be given a time-to-live with [Cache.SetWithTTL] or, for every
+// Set, with [cache.WithDefaultTTL]. Expired entries are treated as misses and
+// removed lazily when Get or Peek encounters them. With [cache.WithJanitor], a
+// background goroutine also removes them proactively; call [Cache.Close] to stop it.
+// Expired and deleted entries are not remembered in A1out.
+//
+// # Statistics
+//
+// [Cache.Stats] reports hits, misses, inserts, updates and removals by reason.
+//
+// # Removal Notifications
+//
+// Pass [cache.OnEvict] to be told about every entry that leaves the cache and why.
+// The listener runs after the cache's lock is released, so it may call back into
+// the cache.
+//
+// # Example Usage
+//
+//	cache := twoq.New[string, int](1000)  // 250 A1in, 500 A1out ghosts
+//	cache.Set("key", 42)                   // Enters A1in
+//	cache.Get("key")                       // Correlated hit, stays in A1in
+package twoq
+
+import (
+	"sync"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/internal/janitor"
+	"github.com/serroba/cache/internal/removal"
+	"github.com/serroba/cache/internal/stats"
+	"github.com/serroba/cache/internal/wheel"
+)
+
+// queue identifies which of the three 2Q queues a node is on.
+type queue uint8
+
+const (
+	a1in queue = iota
+	am
+	a1out
+)
+
+type node[K comparable, V any] struct {
+	key        K
+	value      V // zero while the node is a ghost in A1out
+	queue      queue
+	expiresAt  int64 // unix nanoseconds, 0 means no expiration
+	timer      wheel.Timer[*node[K, V]]
+	prev, next *node[K, V]
+}
+
+func (n *node[K, V]) expired(now int64) bool {
+	return n.expiresAt != 0 && now >= n.expiresAt
+}
+
+// list is a doubly linked list of nodes between two sentinels, newest or most
+// recently used first.
+type list[K comparable, V any] struct {
+	head, tail *node[K, V]
+	len        uint64
+}
+
+func newList[K comparable, V any]() list[K, V] {
+	head, tail := &node[K, V]{}, &node[K, V]{}
+	head.next = tail
+	tail.prev = head
+
+	return list[K, V]{head: head, tail: tail}
+}
+
+// Cache implements the full 2Q algorithm with A1in, A1out and Am queues.
+//
+// New keys enter the A1in FIFO. Keys evicted from A1in are remembered in the
+// A1out ghost queue, and setting one of them again places it in the Am LRU,
+// which a stream of one-off keys cannot flush.
+//
+// The zero value is not usable; create instances with [New] or [NewWithRatio].
+type Cache[K comparable, V any] struct {
+	mu sync.Mutex
+
+	items  map[K]*node[K, V] // resident and ghost nodes
+	queues [3]list[K, V]     // indexed by queue
+
+	capacity      uint64
+	inCap, outCap uint64
+
+	defaultTTL time.Duration
+	now        func() time.Time
+
+	wheel   *wheel.Wheel[*node[K, V]]
+	janitor *janitor.Janitor
+
+	removals removal.Queue[K, V]
+	stats    stats.Counters
+}
+
+var (
+	_ cache.Cache[string, any] = (*Cache[string, any])(nil)
+	_ cache.StatsReporter      = (*Cache[string, any])(nil)
+)
+
+// New creates a new 2Q cache with the given capacity using the recommended
+// queue sizes.
+//
+// The sizes are:
+//   - A1in: 25% of capacity
+//   - A1out: 50% of capacity, counted in keys, which hold no values
+//   - Am: whatever A1in does not use
+//
+// Use [NewWithRatio] if you need different sizes. Options such as
+// [cache.WithDefaultTTL] are applied in order. New panics if the
+// options include [cache.WithWeigher].
+//
+// Example:
+//
+//	cache := twoq.New[string, *Page](10000)  // 2500 A1in, 5000 A1out ghosts
+func New[K comparable, V any](capacity uint64, opts ...cache.Option[K, V]) *Cache[K, V] {
+	return NewWithRatio(capacity, 25, 50, opts...)
+}
+
+// NewWithRatio creates a new 2Q cache with custom queue sizes.
+//
+// Parameters:
+//   - capacity: total number of items the cache can hold
+//   - inPercent: share of capacity for the A1in FIFO (0-100)
+//   - outPercent: number of ghost keys A1out remembers, as a percentage of
+//     capacity (0-255)
+//
+// A larger A1in tolerates longer bursts of correlated requests before a key is
+// pushed out; a larger A1out remembers evicted keys for longer, so keys with a
+// longer reuse distance still reach Am. Both queues are guaranteed at least 1 slot.
+// NewWithRatio panics if the options include [cache.WithWeigher].
+//
+// Example:
+//
+//	// Keys are often re-read after many other keys: remember more ghosts
+//	cache := twoq.NewWithRatio[string, int](1000, 25, 200)
+func NewWithRatio[K comparable, V any](
+	capacity uint64, inPercent, outPercent uint8, opts ...cache.Option[K, V],
+) *Cache[K, V] {
+	o := cache.NewOptions(opts...)
+	if o.Weigher != nil {
+		panic("twoq: cache.WithWeigher is not supported")
+	}
+
+	if inPercent > 100 {
+		inPercent = 100
+	}
+
+	c := &Cache[K, V]{
+		items:      make(map[K]*node[K, V]),
+		queues:     [3]list[K, V]{newList[K, V](), newList[K, V](), newList[K, V]()},
+		capacity:   capacity,
+		inCap:      max(1, capacity*uint64(inPercent)/100),
+		outCap:     max(1, capacity*uint64(outPercent)/100),
+		defaultTTL: o.DefaultTTL,
+		now:        o.Now,
+		removals:   removal.NewQueue(o.OnEvict),
+	}
+
+	if o.JanitorInterval > 0 {
+		c.wheel = wheel.New[*node[K, V]](int64(o.JanitorInterval), c.now().UnixNano())
+		c.janitor = janitor.Start(o.JanitorInterval, c.expire)
+	}
+
+	return c
+}
+
+// Set adds or updates a key-value pair in the cache.
+//
+// Behavior:
+//   - New keys: added to A1in
+//   - Keys remembered in A1out: added to Am
+//   - Existing keys: value updated in place; Am entries become most recently
+//     used, A1in entries keep their place in the FIFO
+//
+// When the cache is full, the oldest A1in entry is evicted to A1out if A1in is
+// over its share, and the least recently used Am entry otherwise. The
+// overwritten value of an existing key is reported to the [cache.OnEvict]
+// listener with [cache.ReasonReplaced].
+//
+// Example:
+//
+//	cache.Set("page:1", pageData)   // Enters A1in
+//	// ... "page:1" is pushed out of A1in and remembered in A1out
+//	cache.Set("page:1", pageData)   // Enters Am
+//
+// The entry expires after the default TTL configured with [cache.WithDefaultTTL], if any.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.defaultTTL)
+}
+
+// SetWithTTL adds or updates a key-value pair that expires after ttl.
+//
+// It behaves like [Cache.Set] but overrides the default TTL for this entry.
+// A zero or negative ttl means the entry never expires.
+//
+// Example:
+//
+//	cache.SetWithTTL("page:1", pageData, 5*time.Minute)
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if c.capacity == 0 {
+		c.stats.RecordSet()
+		c.removals.Push(key, value, cache.ReasonEvicted)
+		c.stats.RecordRemoval(cache.ReasonEvicted)
+
+		return
+	}
+
+	expiresAt := c.expiry(ttl)
+
+	if n, ok := c.lookup(key); ok {
+		c.removals.Push(key, n.value, cache.ReasonReplaced)
+		c.stats.RecordUpdate()
+
+		n.value = value
+		n.expiresAt = expiresAt
+		c.schedule(n)
+
+		if n.queue == am {
+			c.move(n, am)
+		}
+
+		return
+	}
+
+	c.stats.RecordSet()
+
+	// A key remembered in A1out leaves it before room is made, so that the
+	// eviction cannot push it out of A1out first.
+	ghost, remembered := c.items[key]
+	if remembered {
+		c.forget(ghost)
+	}
+
+	c.makeRoom()
+
+	n := &node[K, V]{key: key, value: value, expiresAt: expiresAt}
+	c.items[key] = n
+	c.schedule(n)
+
+	if remembered {
+		c.pushFront(n, am)
+	} else {
+		c.pushFront(n, a1in)
+	}
+}
+
+// Get retrieves a value from the cache.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// A hit in Am makes the entry most recently used. A hit in A1in does not
+// change anything: it is treated as correlated with the key's first use. A key
+// remembered only in A1out is a miss; it is promoted to Am when it is set
+// again. Use [Cache.Peek] to read without affecting eviction.
+//
+// Example:
+//
+//	if page, ok := cache.Get("page:1"); ok {
+//	    render(page)
+//	}
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		c.stats.RecordMiss()
+
+		var zero V
+
+		return zero, false
+	}
+
+	if n.queue == am {
+		c.move(n, am)
+	}
+
+	c.stats.RecordHit()
+
+	return n.value, true
+}
+
+// Peek retrieves a value without affecting eviction.
+//
+// Returns:
+//   - (value, true) if the key exists
+//   - (zero value, false) if the key does not exist or has expired
+//
+// Unlike [Cache.Get], this never changes the recency of Am entries.
+//
+// Example:
+//
+//	if data, ok := cache.Peek("page:1"); ok {
+//	    // Item found, eviction order unchanged
+//	}
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if n, ok := c.lookup(key); ok {
+		return n.value, true
+	}
+
+	var zero V
+
+	return zero, false
+}
+
+// Delete removes a key from the cache, regardless of which queue it's in.
+//
+// Returns true if the key existed and was removed, false if the key was not found
+// or had already expired. The removed entry is reported to the [cache.OnEvict]
+// listener with [cache.ReasonDeleted] and is not remembered in A1out.
+//
+// Example:
+//
+//	cache.Delete("page:1")
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	n, ok := c.lookup(key)
+	if !ok {
+		return false
+	}
+
+	c.removeEntry(n, cache.ReasonDeleted)
+
+	return true
+}
+
+// Len returns the number of entries in A1in and Am.
+//
+// Ghost keys in A1out are not counted. Expired entries that have not been
+// removed yet are.
+//
+// Example:
+//
+//	fmt.Printf("Cache has %d items\n", cache.Len())
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return int(c.queues[a1in].len + c.queues[am].len)
+}
+
+// Clear removes every entry and forgets all ghost keys.
+//
+// Each removed entry is reported to the [cache.OnEvict] listener with
+// [cache.ReasonCleared], Am entries first.
+//
+// Example:
+//
+//	cache.Clear()
+//	fmt.Println(cache.Len()) // 0
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for _, q := range []queue{am, a1in} {
+		l := &c.queues[q]
+		for n := l.head.next; n != l.tail; n = n.next {
+			c.removeEntry(n, cache.ReasonCleared)
+		}
+	}
+
+	l := &c.queues[a1out]
+	for n := l.head.next; n != l.tail; n = n.next {
+		c.forget(n)
+	}
+}
+
+// Stats returns a snapshot of the cache's hit, miss and removal counters.
+//
+// Reading statistics never blocks cache operations.
+//
+// Example:
+//
+//	s := cache.Stats()
+//	fmt.Printf("hit ratio %.2f, %d evictions\n", s.HitRatio(), s.Evictions)
+func (c *Cache[K, V]) Stats() cache.Stats {
+	return c.stats.Snapshot()
+}
+
+// ResetStats sets all statistics counters back to zero.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.Reset()
+}
+
+// Close stops the background janitor started by [cache.WithJanitor].
+//
+// The cache remains usable afterwards, with expiration falling back to lazy
+// removal. Close is a no-op for caches created without a janitor and is safe
+// to call more than once.
+func (c *Cache[K, V]) Close() {
+	c.janitor.Stop()
+}
+
+// expiry converts a TTL into an absolute expiration time.
+func (c *Cache[K, V]) expiry(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return c.now().Add(ttl).UnixNano()
+}
+
+// lookup returns the resident node for key, removing it first if it has
+// expired. Ghost nodes are not returned.
+// Must be called with lock held.
+func (c *Cache[K, V]) lookup(key K) (*node[K, V], bool) {
+	n, ok := c.items[key]
+	if !ok || n.queue == a1out {
+		return nil, false
+	}
+
+	if n.expiresAt != 0 && n.expired(c.now().UnixNano()) {
+		c.removeEntry(n, cache.ReasonExpired)
+
+		return nil, false
+	}
+
+	return n, true
+}
+
+// schedule registers the node's expiration with the janitor, if one is running.
+// Must be called with lock held.
+func (c *Cache[K, V]) schedule(n *node[K, V]) {
+	if c.wheel == nil {
+		return
+	}
+
+	if n.expiresAt == 0 {
+		c.wheel.Cancel(&n.timer)
+
+		return
+	}
+
+	n.timer.Value = n
+	c.wheel.Schedule(&n.timer, n.expiresAt)
+}
+
+// expire removes every entry whose expiration has passed.
+// It runs on the janitor goroutine.
+func (c *Cache[K, V]) expire() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.wheel.Advance(c.now().UnixNano(), func(n *node[K, V]) {
+		c.removeEntry(n, cache.ReasonExpired)
+	})
+}
+
+// makeRoom evicts one resident entry if the cache is full: the oldest A1in
+// entry, remembered in A1out, if A1in is over its share, and the least
+// recently used Am entry otherwise. This is the reclaimfor step of 2Q.
+// Must be called with lock held.
+func (c *Cache[K, V]) makeRoom() {
+	inLen, amLen := c.queues[a1in].len, c.queues[am].len
+	if inLen+amLen < c.capacity {
+		return
+	}
+
+	if amLen > 0 && inLen <= c.inCap {
+		c.removeEntry(c.queues[am].tail.prev, cache.ReasonEvicted)
+
+		return
+	}
+
+	n := c.queues[a1in].tail.prev
+	c.removals.Push(n.key, n.value, cache.ReasonEvicted)
+	c.stats.RecordRemoval(cache.ReasonEvicted)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	var zero V
+
+	n.value = zero
+	n.expiresAt = 0
+	c.move(n, a1out)
+
+	if c.queues[a1out].len > c.outCap {
+		c.forget(c.queues[a1out].tail.prev)
+	}
+}
+
+// removeEntry unlinks a resident node, drops it from the index, cancels its
+// expiration and queues a removal notification.
+func (c *Cache[K, V]) removeEntry(n *node[K, V], reason cache.RemovalReason) {
+	c.forget(n)
+
+	if c.wheel != nil {
+		c.wheel.Cancel(&n.timer)
+	}
+
+	c.removals.Push(n.key, n.value, reason)
+	c.stats.RecordRemoval(reason)
+}
+
+// forget unlinks a node and drops it from the index without notifying anyone.
+func (c *Cache[K, V]) forget(n *node[K, V]) {
+	c.unlink(n)
+	delete(c.items, n.key)
+}
+
+// unlock releases the lock and then delivers the removal notifications queued
+// while it was held.
+func (c *Cache[K, V]) unlock() {
+	pending := c.removals.Take()
+	c.mu.Unlock()
+	c.removals.Deliver(pending)
+}
+
+// move relinks a node at the front of the given queue.
+func (c *Cache[K, V]) move(n *node[K, V], to queue) {
+	c.unlink(n)
+	c.pushFront(n, to)
+}
+
+// unlink removes a node from its queue.
+func (c *Cache[K, V]) unlink(n *node[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	c.queues[n.queue].len--
+}
+
+// pushFront adds a node to the front of the given queue.
+func (c *Cache[K, V]) pushFront(n *node[K, V], q queue) {
+	l := &c.queues[q]
+
+	n.queue = q
+	n.next = l.head.next
+	n.prev = l.head
+	l.head.next.prev = n
+	l.head.next = n
+	l.len++
+}
@@ -0,0 +1,468 @@
+package twoq_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/serroba/cache"
+	"github.com/serroba/cache/lru"
+	"github.com/serroba/cache/twoq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type removal struct {
+	key    string
+	value  int
+	reason cache.RemovalReason
+}
+
+func record(log *[]removal) cache.Option[string, int] {
+	return cache.OnEvict(func(key string, value int, reason cache.RemovalReason) {
+		*log = append(*log, removal{key, value, reason})
+	})
+}
+
+func TestTwoQCache_GetEmpty(t *testing.T) {
+	t.Parallel()
+
+	c := twoq.New[string, int](10)
+
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestTwoQCache_SetAndGet(t *testing.T) {
+	t.Parallel()
+
+	c := twoq.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.Peek("b")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestTwoQCache_UpdateExistingKey(t *testing.T) {
+	t.Parallel()
+
+	c := twoq.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestTwoQCache_Delete(t *testing.T) {
+	t.Parallel()
+
+	c := twoq.New[string, int](10)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestTwoQCache_ZeroCapacity(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := twoq.New[string, int](0, record(&log))
+	c.Set("a", 1)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestTwoQCache_NewWithRatioEdgeCases(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in, out uint8
+	}{{0, 0}, {100, 0}, {150, 255}, {50, 100}} {
+		c := twoq.NewWithRatio[int, int](10, tc.in, tc.out)
+
+		for i := range 100 {
+			c.Set(i%30, i)
+			c.Get(i % 7)
+		}
+
+		assert.LessOrEqual(t, c.Len(), 10, "in=%d out=%d", tc.in, tc.out)
+	}
+}
+
+func TestTwoQCache_A1inIsFIFO(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := twoq.New[string, int](3, record(&log)) // A1in holds 1, Am the rest
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	c.Get("a") // correlated hit: "a" is still the oldest in A1in
+	c.Set("d", 4)
+
+	assert.Equal(t, []removal{{"a", 1, cache.ReasonEvicted}}, log)
+}
+
+func TestTwoQCache_RememberedKeyPromotedToAm(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := twoq.New[string, int](4, record(&log)) // A1in 1, A1out 2
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4)
+	c.Set("e", 5) // "a" evicted to A1out
+
+	c.Set("a", 10) // remembered: goes to Am, "b" evicted to A1out
+
+	// A scan of new keys only cycles through A1in.
+	for i := range 20 {
+		c.Set(fmt.Sprintf("scan%d", i), i)
+	}
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, 10, v)
+
+	assert.Equal(t, removal{"a", 1, cache.ReasonEvicted}, log[0])
+	assert.Equal(t, removal{"b", 2, cache.ReasonEvicted}, log[1])
+}
+
+func TestTwoQCache_GhostsAreNotReturned(t *testing.T) {
+	t.Parallel()
+
+	c := twoq.New[string, int](2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3) // "a" evicted to A1out
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("a")
+	assert.False(t, ok)
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestTwoQCache_A1outIsBounded(t *testing.T) {
+	t.Parallel()
+
+	c := twoq.New[string, int](4) // A1out remembers 2 keys
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4)
+	c.Set("e", 5) // A1out: a
+	c.Set("f", 6) // A1out: b a
+	c.Set("g", 7) // A1out: c b, "a" forgotten
+
+	c.Set("a", 10) // a new key again, enters A1in
+
+	for i := range 4 {
+		c.Set(fmt.Sprintf("scan%d", i), i)
+	}
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok, "a forgotten key is not protected from the scan")
+}
+
+func TestTwoQCache_ScanResistance(t *testing.T) {
+	t.Parallel()
+
+	tq := twoq.New[string, int](20) // A1in 5, A1out 10
+	lr := lru.New[string, int](20)
+
+	for _, c := range []cache.Cache[string, int]{tq, lr} {
+		// Each hot key comes back after 24 other inserts: too late for LRU,
+		// but while A1out still remembers it.
+		for round := range 3 {
+			for i := range 5 {
+				key := fmt.Sprintf("hot%d", i)
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, i)
+				}
+
+				for j := range 4 {
+					c.Set(fmt.Sprintf("cold%d-%d-%d", round, i, j), j)
+				}
+			}
+		}
+
+		for i := range 100 {
+			c.Set(fmt.Sprintf("scan%d", i), i)
+		}
+	}
+
+	hits := func(c cache.Cache[string, int]) int {
+		n := 0
+
+		for i := range 5 {
+			if _, ok := c.Peek(fmt.Sprintf("hot%d", i)); ok {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	assert.Equal(t, 5, hits(tq))
+	assert.Equal(t, 0, hits(lr))
+}
+
+func TestTwoQCache_SetWithTTLExpires(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := twoq.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.Set("b", 2)
+
+	now = now.Add(time.Second)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestTwoQCache_DefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := twoq.New[string, int](10,
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+		cache.WithDefaultTTL[string, int](time.Minute),
+	)
+
+	c.Set("a", 1)
+	c.SetWithTTL("b", 2, time.Hour)
+
+	now = now.Add(time.Minute)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+
+	_, ok = c.Peek("b")
+	assert.True(t, ok)
+}
+
+func TestTwoQCache_JanitorRemovesExpired(t *testing.T) {
+	t.Parallel()
+
+	var now atomic.Int64
+
+	c := twoq.New[string, int](100,
+		cache.WithTimeSource[string, int](func() time.Time { return time.Unix(0, now.Load()) }),
+		cache.WithJanitor[string, int](time.Millisecond),
+	)
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Hour)
+	c.Set("c", 3)
+	c.SetWithTTL("d", 4, time.Second)
+	c.Set("d", 5) // clears the expiration of "d"
+
+	now.Store(int64(2 * time.Second))
+
+	assert.Eventually(t, func() bool { return c.Len() == 3 }, time.Second, time.Millisecond)
+
+	_, ok := c.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestTwoQCache_Close(t *testing.T) {
+	t.Parallel()
+
+	c := twoq.New[string, int](10, cache.WithJanitor[string, int](time.Millisecond))
+	c.Close()
+	c.Close()
+
+	c.Set("a", 1)
+	assert.Equal(t, 1, c.Len())
+
+	twoq.New[string, int](10).Close()
+}
+
+func TestTwoQCache_OnEvictReasons(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	now := time.Unix(0, 0)
+	c := twoq.New[string, int](10,
+		record(&log),
+		cache.WithTimeSource[string, int](func() time.Time { return now }),
+	)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Delete("a")
+	c.Delete("a") // already gone, no notification
+
+	c.SetWithTTL("b", 3, time.Second)
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, []removal{
+		{"a", 1, cache.ReasonReplaced},
+		{"a", 2, cache.ReasonDeleted},
+		{"b", 3, cache.ReasonExpired},
+	}, log)
+}
+
+func TestTwoQCache_Clear(t *testing.T) {
+	t.Parallel()
+
+	var log []removal
+
+	c := twoq.New[string, int](4, record(&log))
+
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		c.Set(key, i) // "a" ends up in A1out
+	}
+
+	log = nil
+
+	c.Clear()
+
+	assert.Equal(t, 0, c.Len())
+	assert.Len(t, log, 4)
+
+	// "a" was forgotten along with the entries, so it starts over in A1in.
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4)
+	c.Set("e", 5)
+
+	assert.Equal(t, removal{"a", 1, cache.ReasonEvicted}, log[len(log)-1])
+}
+
+func TestTwoQCache_OnEvictCanReenter(t *testing.T) {
+	t.Parallel()
+
+	var c *twoq.Cache[string, int]
+
+	c = twoq.New[string, int](10, cache.OnEvict(func(key string, value int, _ cache.RemovalReason) {
+		if key != "evicted" {
+			c.Set("evicted", value)
+		}
+
+		c.Len()
+	}))
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	v, ok := c.Get("evicted")
+	require.True(t, ok)
+	assert.Equal(t, 1, v)
+}
+
+func TestTwoQCache_Stats(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	c := twoq.New[string, int](10, cache.WithTimeSource[string, int](func() time.Time { return now }))
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.SetWithTTL("b", 3, time.Second)
+	c.Get("a")
+	c.Get("missing")
+	c.Peek("a") // not counted
+	c.Delete("a")
+
+	now = now.Add(time.Second)
+
+	c.Get("b")
+
+	assert.Equal(t, cache.Stats{
+		Hits:        1,
+		Misses:      2,
+		Sets:        2,
+		Updates:     1,
+		Deletions:   1,
+		Expirations: 1,
+	}, c.Stats())
+
+	c.ResetStats()
+	assert.Equal(t, cache.Stats{}, c.Stats())
+}
+
+func TestTwoQCache_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	c := twoq.New[string, int](100)
+
+	var wg sync.WaitGroup
+
+	for i := range 16 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for j := range 500 {
+				key := fmt.Sprintf("key%d", (id*500+j)%300)
+				c.Set(key, j)
+				c.Get(key)
+				c.Peek(key)
+
+				if j%10 == 0 {
+					c.Delete(key)
+				}
+			}
+
+			c.Len()
+			c.Stats()
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, c.Len(), 100)
+}
+
+func TestTwoQCache_WeigherPanics(t *testing.T) {
+	t.Parallel()
+
+	weigher := cache.WithWeigher(func(string, int) uint64 { return 1 })
+
+	assert.PanicsWithValue(t, "twoq: cache.WithWeigher is not supported", func() {
+		twoq.New[string, int](10, weigher)
+	})
+	assert.PanicsWithValue(t, "twoq: cache.WithWeigher is not supported", func() {
+		twoq.NewWithRatio[string, int](10, 25, 50, weigher)
+	})
+}